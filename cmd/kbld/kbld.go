@@ -31,6 +31,9 @@ func main() {
 	err := command.Execute()
 	if err != nil {
 		confUI.ErrorLinef("kbld: Error: %s", uierrs.NewMultiLineError(err))
+		// Flush explicitly since deferred functions do not run on exit
+		// (e.g. JSON output of a failing command)
+		confUI.Flush()
 		os.Exit(1)
 	}
 
@@ -0,0 +1,219 @@
+// Copyright 2024 The Carvel Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package artifact
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	ctlb "carvel.dev/kbld/pkg/kbld/builder"
+	ctlconf "carvel.dev/kbld/pkg/kbld/config"
+	ctllog "carvel.dev/kbld/pkg/kbld/logger"
+	ctlreg "carvel.dev/kbld/pkg/kbld/registry"
+	regname "github.com/google/go-containerregistry/pkg/name"
+)
+
+const (
+	builderName = "artifact"
+)
+
+// Artifact pushes pre-built images found in OCI layouts or tarballs
+type Artifact struct {
+	registry ctlreg.Registry
+	logger   ctllog.Logger
+}
+
+func NewArtifact(registry ctlreg.Registry, logger ctllog.Logger) Artifact {
+	return Artifact{registry, logger}
+}
+
+func (a Artifact) BuildAndPush(ctx context.Context, image, directory string,
+	opts ctlconf.SourceArtifactOpts, imageDst string) (string, []ctlconf.Origin, error) {
+
+	artifactPath := opts.Path
+	if !filepath.IsAbs(artifactPath) {
+		artifactPath = filepath.Join(directory, artifactPath)
+	}
+
+	absArtifactPath, err := filepath.Abs(artifactPath)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if opts.Command != nil {
+		err := a.build(ctx, image, directory, *opts.Command)
+		if err != nil {
+			return "", nil, err
+		}
+	}
+
+	prefixedLogger := a.logger.NewPrefixedWriter(imageDst + " | ")
+
+	prefixedLogger.Write([]byte(fmt.Sprintf("starting push (using artifact): %s -> %s\n", absArtifactPath, imageDst)))
+	defer prefixedLogger.Write([]byte("finished push (using artifact)\n"))
+
+	pushEvent := a.logger.StartEvent(ctllog.Event{Type: ctllog.EventPushStart, Image: imageDst, Builder: builderName, Message: absArtifactPath})
+
+	url, err := a.push(ctx, absArtifactPath, imageDst)
+	pushEvent.FinishWith(ctllog.EventPushFinished, url, err)
+	if err != nil {
+		prefixedLogger.Write([]byte(fmt.Sprintf("push error: %s\n", err)))
+		return "", nil, err
+	}
+
+	digestRef, err := regname.NewDigest(url)
+	if err != nil {
+		return "", nil, err
+	}
+
+	origins := []ctlconf.Origin{{
+		Local: &ctlconf.OriginLocal{Path: absArtifactPath, Digest: digestRef.DigestStr()},
+	}}
+
+	return url, origins, nil
+}
+
+func (a Artifact) build(ctx context.Context, image, directory, command string) error {
+	prefixedLogger := a.logger.NewPrefixedWriter(image + " | ")
+
+	prefixedLogger.Write([]byte(fmt.Sprintf("starting build (using artifact command): %s\n", directory)))
+	defer prefixedLogger.Write([]byte("finished build (using artifact command)\n"))
+
+	buildEvent := a.logger.StartEvent(ctllog.Event{Type: ctllog.EventBuildStart, Image: image, Builder: builderName, Message: directory})
+	defer buildEvent.Finish(ctllog.EventBuildFinished)
+
+	buildOutput := a.logger.NewEventWriter(ctllog.EventBuildOutput, image)
+	defer buildOutput.Flush()
+
+	var stdoutBuf, stderrBuf bytes.Buffer
+
+	cmd := ctlb.NewCmd(ctx, "sh", "-c", command)
+	cmd.Dir = directory
+	cmd.Stdout = io.MultiWriter(&stdoutBuf, buildOutput)
+	cmd.Stderr = io.MultiWriter(&stderrBuf, buildOutput)
+
+	err := cmd.Run()
+	if err != nil {
+		prefixedLogger.Write([]byte(fmt.Sprintf("error: %s\n", err)))
+		return err
+	}
+
+	return nil
+}
+
+func (a Artifact) push(ctx context.Context, artifactPath, imageDst string) (string, error) {
+	stat, err := os.Stat(artifactPath)
+	if err != nil {
+		return "", fmt.Errorf("Checking artifact path '%s': %s", artifactPath, err)
+	}
+
+	if stat.IsDir() {
+		return ctlb.PushOCILayout(ctx, a.registry, artifactPath, imageDst)
+	}
+
+	isDockerTarball, err := a.isDockerTarball(artifactPath)
+	if err != nil {
+		return "", err
+	}
+
+	// Docker save tarballs (that may also include OCI layout since Docker v25)
+	// are read directly, otherwise tarball is expected to be an OCI archive
+	// (both may be gzip compressed)
+	if isDockerTarball {
+		return ctlb.PushTarball(ctx, a.registry, artifactPath, imageDst)
+	}
+
+	tmpDir, err := os.MkdirTemp("", "kbld-artifact")
+	if err != nil {
+		return "", fmt.Errorf("Creating tmp dir: %s", err)
+	}
+
+	defer os.RemoveAll(tmpDir)
+
+	err = a.extractTarball(artifactPath, tmpDir)
+	if err != nil {
+		return "", err
+	}
+
+	return ctlb.PushOCILayout(ctx, a.registry, tmpDir, imageDst)
+}
+
+func (a Artifact) isDockerTarball(path string) (bool, error) {
+	var found bool
+
+	err := a.walkTarball(path, func(header *tar.Header, _ io.Reader) error {
+		if filepath.Clean(header.Name) == "manifest.json" {
+			found = true
+		}
+		return nil
+	})
+
+	return found, err
+}
+
+func (a Artifact) extractTarball(path, dstPath string) error {
+	return a.walkTarball(path, func(header *tar.Header, reader io.Reader) error {
+		name := filepath.Clean(header.Name)
+		if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("Expected tarball entry '%s' to be within archive", header.Name)
+		}
+
+		entryPath := filepath.Join(dstPath, name)
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			return os.MkdirAll(entryPath, 0700)
+
+		case tar.TypeReg:
+			err := os.MkdirAll(filepath.Dir(entryPath), 0700)
+			if err != nil {
+				return err
+			}
+
+			file, err := os.OpenFile(entryPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+
+			_, err = io.Copy(file, reader)
+			return err
+
+		default:
+			// OCI layouts only consist of regular files and directories
+			return nil
+		}
+	})
+}
+
+func (a Artifact) walkTarball(path string, walkFunc func(*tar.Header, io.Reader) error) error {
+	file, err := ctlb.OpenTarball(path)
+	if err != nil {
+		return fmt.Errorf("Opening tarball: %s", err)
+	}
+	defer file.Close()
+
+	tarReader := tar.NewReader(file)
+
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("Reading tarball '%s': %s", path, err)
+		}
+
+		err = walkFunc(header, tarReader)
+		if err != nil {
+			return fmt.Errorf("Reading tarball '%s': %s", path, err)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright 2024 The Carvel Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package artifact_test
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"io"
+	"log"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	ctlbart "carvel.dev/kbld/pkg/kbld/builder/artifact"
+	ctlconf "carvel.dev/kbld/pkg/kbld/config"
+	ctllog "carvel.dev/kbld/pkg/kbld/logger"
+	ctlreg "carvel.dev/kbld/pkg/kbld/registry"
+	regname "github.com/google/go-containerregistry/pkg/name"
+	regregistry "github.com/google/go-containerregistry/pkg/registry"
+	regv1 "github.com/google/go-containerregistry/pkg/v1"
+	regempty "github.com/google/go-containerregistry/pkg/v1/empty"
+	reglayout "github.com/google/go-containerregistry/pkg/v1/layout"
+	regrandom "github.com/google/go-containerregistry/pkg/v1/random"
+	regtarball "github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArtifactBuildAndPush(t *testing.T) {
+	server := httptest.NewServer(regregistry.New(regregistry.Logger(log.New(io.Discard, "", 0))))
+	defer server.Close()
+
+	imageDst := strings.TrimPrefix(server.URL, "http://") + "/app"
+
+	img, err := regrandom.Image(1024, 2)
+	require.NoError(t, err)
+
+	imgDigest, err := img.Digest()
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+
+	layoutPath := filepath.Join(dir, "layout")
+	writeOCILayout(t, layoutPath, img)
+
+	archivePath := filepath.Join(dir, "image.tar")
+	writeTarballFromDir(t, archivePath, layoutPath)
+
+	dockerSavePath := filepath.Join(dir, "docker-save.tar")
+	tag, err := regname.NewTag("app:latest")
+	require.NoError(t, err)
+	require.NoError(t, regtarball.WriteToFile(dockerSavePath, tag, img))
+
+	// Equivalent of `docker save | gzip` and nix dockerTools.buildImage output
+	gzipFile(t, archivePath, filepath.Join(dir, "image.tar.gz"))
+	gzipFile(t, dockerSavePath, filepath.Join(dir, "docker-save.tar.gz"))
+
+	for _, ex := range []struct {
+		Description string
+		Path        string
+	}{
+		{"OCI layout directory", "layout"},
+		{"OCI archive", "image.tar"},
+		{"docker save tarball", "docker-save.tar"},
+		{"gzip compressed OCI archive", "image.tar.gz"},
+		{"gzip compressed docker save tarball", "docker-save.tar.gz"},
+	} {
+		t.Run(ex.Description, func(t *testing.T) {
+			url, origins, err := newArtifact(t).BuildAndPush(context.Background(),
+				"app", dir, ctlconf.SourceArtifactOpts{Path: ex.Path}, imageDst)
+			require.NoError(t, err)
+
+			assert.Equal(t, imageDst+"@"+imgDigest.String(), url)
+			require.Len(t, origins, 1)
+			assert.Equal(t, filepath.Join(dir, ex.Path), origins[0].Local.Path)
+			assert.Equal(t, imgDigest.String(), origins[0].Local.Digest)
+		})
+	}
+
+	t.Run("tarball entry outside of archive", func(t *testing.T) {
+		// Archive is extracted into a tmp dir within TMPDIR
+		tmpDir := t.TempDir()
+		t.Setenv("TMPDIR", tmpDir)
+
+		evilPath := filepath.Join(dir, "evil.tar")
+		writeTarball(t, evilPath, map[string]string{"../evil": "content"})
+
+		_, _, err := newArtifact(t).BuildAndPush(context.Background(),
+			"app", dir, ctlconf.SourceArtifactOpts{Path: "evil.tar"}, imageDst)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "Expected tarball entry '../evil' to be within archive")
+
+		_, err = os.Stat(filepath.Join(tmpDir, "evil"))
+		assert.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("missing artifact", func(t *testing.T) {
+		_, _, err := newArtifact(t).BuildAndPush(context.Background(),
+			"app", dir, ctlconf.SourceArtifactOpts{Path: "missing"}, imageDst)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "Checking artifact path '"+filepath.Join(dir, "missing")+"'")
+	})
+}
+
+func newArtifact(t *testing.T) ctlbart.Artifact {
+	registry, err := ctlreg.NewRegistry(ctlreg.Opts{EnvAuthPrefix: "KBLD_TEST_REGISTRY"})
+	require.NoError(t, err)
+
+	return ctlbart.NewArtifact(registry, ctllog.NewLogger(io.Discard))
+}
+
+func writeOCILayout(t *testing.T, path string, img regv1.Image) {
+	layoutPath, err := reglayout.Write(path, regempty.Index)
+	require.NoError(t, err)
+	require.NoError(t, layoutPath.AppendImage(img))
+}
+
+func gzipFile(t *testing.T, srcPath, dstPath string) {
+	content, err := os.ReadFile(srcPath)
+	require.NoError(t, err)
+
+	file, err := os.Create(dstPath)
+	require.NoError(t, err)
+	defer file.Close()
+
+	gzipWriter := gzip.NewWriter(file)
+
+	_, err = gzipWriter.Write(content)
+	require.NoError(t, err)
+	require.NoError(t, gzipWriter.Close())
+}
+
+func writeTarballFromDir(t *testing.T, tarballPath, dir string) {
+	files := map[string]string{}
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		relPath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		content, err := os.ReadFile(path)
+		files[relPath] = string(content)
+		return err
+	})
+	require.NoError(t, err)
+
+	writeTarball(t, tarballPath, files)
+}
+
+func writeTarball(t *testing.T, tarballPath string, files map[string]string) {
+	file, err := os.Create(tarballPath)
+	require.NoError(t, err)
+	defer file.Close()
+
+	tarWriter := tar.NewWriter(file)
+
+	for name, content := range files {
+		err := tarWriter.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: int64(len(content)), Typeflag: tar.TypeReg})
+		require.NoError(t, err)
+
+		_, err = tarWriter.Write([]byte(content))
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, tarWriter.Close())
+}
@@ -5,14 +5,19 @@ package image
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
-	"os/exec"
+	"os"
+	"path/filepath"
 	"regexp"
+	"strings"
 
+	ctlb "carvel.dev/kbld/pkg/kbld/builder"
 	ctlbdk "carvel.dev/kbld/pkg/kbld/builder/docker"
 	"carvel.dev/kbld/pkg/kbld/config"
 	ctllog "carvel.dev/kbld/pkg/kbld/logger"
+	ctlreg "carvel.dev/kbld/pkg/kbld/registry"
 )
 
 var (
@@ -22,20 +27,27 @@ var (
 )
 
 type Bazel struct {
-	docker ctlbdk.Docker
-	logger ctllog.Logger
+	docker   ctlbdk.Docker
+	registry ctlreg.Registry
+	logger   ctllog.Logger
 }
 
-func NewBazel(docker ctlbdk.Docker, logger ctllog.Logger) Bazel {
-	return Bazel{docker: docker, logger: logger}
+func NewBazel(docker ctlbdk.Docker, registry ctlreg.Registry, logger ctllog.Logger) Bazel {
+	return Bazel{docker: docker, registry: registry, logger: logger}
 }
 
-func (b *Bazel) Run(image, directory string, opts config.SourceBazelRunOpts) (ctlbdk.TmpRef, error) {
+func (b *Bazel) Run(ctx context.Context, image, directory string, opts config.SourceBazelRunOpts) (ctlbdk.TmpRef, error) {
 	prefixedLogger := b.logger.NewPrefixedWriter(image + " | ")
 
 	prefixedLogger.Write([]byte(fmt.Sprintf("starting build (using bazel): %s\n", directory)))
 	defer prefixedLogger.Write([]byte("finished build (using bazel)\n"))
 
+	buildEvent := b.logger.StartEvent(ctllog.Event{Type: ctllog.EventBuildStart, Image: image, Builder: "bazel", Message: directory})
+	defer buildEvent.Finish(ctllog.EventBuildFinished)
+
+	buildOutput := b.logger.NewEventWriter(ctllog.EventBuildOutput, image)
+	defer buildOutput.Flush()
+
 	var imageID string
 	{
 		var stdoutBuf, stderrBuf bytes.Buffer
@@ -52,10 +64,10 @@ func (b *Bazel) Run(image, directory string, opts config.SourceBazelRunOpts) (ct
 			cmdArgs = append(cmdArgs, *opts.RawOptions...)
 		}
 
-		cmd := exec.Command("bazel", cmdArgs...)
+		cmd := ctlb.NewCmd(ctx, "bazel", cmdArgs...)
 		cmd.Dir = directory
-		cmd.Stdout = io.MultiWriter(&stdoutBuf, prefixedLogger)
-		cmd.Stderr = io.MultiWriter(&stderrBuf, prefixedLogger)
+		cmd.Stdout = io.MultiWriter(&stdoutBuf, buildOutput)
+		cmd.Stderr = io.MultiWriter(&stderrBuf, buildOutput)
 
 		err := cmd.Run()
 		if err != nil {
@@ -71,5 +83,116 @@ func (b *Bazel) Run(image, directory string, opts config.SourceBazelRunOpts) (ct
 		imageID = "sha256:" + matches[2]
 	}
 
-	return b.docker.RetagStable(ctlbdk.NewTmpRef(imageID), image, imageID, prefixedLogger)
+	return b.docker.RetagStable(ctx, ctlbdk.NewTmpRef(imageID), image, imageID, prefixedLogger)
+}
+
+// BuildAndPush runs `bazel build` for a target producing OCI layout
+// (e.g. rules_oci's oci_image or oci_image_index) and pushes it to destination
+func (b *Bazel) BuildAndPush(ctx context.Context, image, directory string,
+	opts config.SourceBazelBuildOpts, imageDst string) (string, error) {
+
+	layoutPath, err := b.build(ctx, image, directory, opts)
+	if err != nil {
+		return "", err
+	}
+
+	prefixedLogger := b.logger.NewPrefixedWriter(imageDst + " | ")
+
+	prefixedLogger.Write([]byte(fmt.Sprintf("starting push (using bazel OCI layout): %s\n", imageDst)))
+	defer prefixedLogger.Write([]byte("finished push (using bazel OCI layout)\n"))
+
+	pushEvent := b.logger.StartEvent(ctllog.Event{Type: ctllog.EventPushStart, Image: imageDst, Builder: "bazel", Message: layoutPath})
+
+	url, err := ctlb.PushOCILayout(ctx, b.registry, layoutPath, imageDst)
+	pushEvent.FinishWith(ctllog.EventPushFinished, url, err)
+	if err != nil {
+		prefixedLogger.Write([]byte(fmt.Sprintf("push error: %s\n", err)))
+		return "", err
+	}
+
+	return url, nil
+}
+
+func (b *Bazel) build(ctx context.Context, image, directory string, opts config.SourceBazelBuildOpts) (string, error) {
+	prefixedLogger := b.logger.NewPrefixedWriter(image + " | ")
+
+	prefixedLogger.Write([]byte(fmt.Sprintf("starting build (using bazel): %s\n", directory)))
+	defer prefixedLogger.Write([]byte("finished build (using bazel)\n"))
+
+	buildEvent := b.logger.StartEvent(ctllog.Event{Type: ctllog.EventBuildStart, Image: image, Builder: "bazel", Message: directory})
+	defer buildEvent.Finish(ctllog.EventBuildFinished)
+
+	if opts.Target == nil {
+		return "", fmt.Errorf("Expected target to be specified, but was not")
+	}
+
+	var rawOpts []string
+	if opts.RawOptions != nil {
+		rawOpts = *opts.RawOptions
+	}
+
+	buildOutput := b.logger.NewEventWriter(ctllog.EventBuildOutput, image)
+	defer buildOutput.Flush()
+
+	_, err := b.run(ctx, directory, append([]string{"build", *opts.Target}, rawOpts...), buildOutput)
+	if err != nil {
+		prefixedLogger.Write([]byte(fmt.Sprintf("error: %s\n", err)))
+		return "", err
+	}
+
+	// Same options are provided to cquery so that it
+	// evaluates target in the same configuration as build
+	filesOut, err := b.run(ctx, directory, append([]string{"cquery", *opts.Target, "--output=files"}, rawOpts...), buildOutput)
+	if err != nil {
+		prefixedLogger.Write([]byte(fmt.Sprintf("cquery error: %s\n", err)))
+		return "", err
+	}
+
+	execRootOut, err := b.run(ctx, directory, []string{"info", "execution_root"}, buildOutput)
+	if err != nil {
+		prefixedLogger.Write([]byte(fmt.Sprintf("info error: %s\n", err)))
+		return "", err
+	}
+
+	return b.findOCILayout(strings.TrimSpace(execRootOut), filesOut)
+}
+
+// findOCILayout picks target output that is an OCI layout directory
+func (b *Bazel) findOCILayout(execRoot, filesOut string) (string, error) {
+	var layoutPaths []string
+
+	for _, file := range strings.Split(filesOut, "\n") {
+		file = strings.TrimSpace(file)
+		if len(file) == 0 {
+			continue
+		}
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(execRoot, file)
+		}
+		if _, err := os.Stat(filepath.Join(file, "oci-layout")); err == nil {
+			layoutPaths = append(layoutPaths, file)
+		}
+	}
+
+	if len(layoutPaths) != 1 {
+		return "", fmt.Errorf("Expected bazel target to output exactly one OCI layout directory, but found %d", len(layoutPaths))
+	}
+
+	return layoutPaths[0], nil
+}
+
+func (b *Bazel) run(ctx context.Context, directory string, cmdArgs []string, output io.Writer) (string, error) {
+	var stdoutBuf, stderrBuf bytes.Buffer
+
+	cmd := ctlb.NewCmd(ctx, "bazel", cmdArgs...)
+	cmd.Dir = directory
+	cmd.Stdout = io.MultiWriter(&stdoutBuf, output)
+	cmd.Stderr = io.MultiWriter(&stderrBuf, output)
+
+	err := cmd.Run()
+	if err != nil {
+		return "", err
+	}
+
+	return stdoutBuf.String(), nil
 }
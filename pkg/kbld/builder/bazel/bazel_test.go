@@ -0,0 +1,65 @@
+// Copyright 2024 The Carvel Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package image
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBazelFindOCILayout(t *testing.T) {
+	execRoot := t.TempDir()
+
+	writeFile := func(path, content string) {
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0700))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+	}
+
+	relLayoutPath := filepath.Join("bazel-out", "k8-fastbuild", "bin", "app_image")
+	writeFile(filepath.Join(execRoot, relLayoutPath, "oci-layout"), `{"imageLayoutVersion":"1.0.0"}`)
+	writeFile(filepath.Join(execRoot, relLayoutPath, "index.json"), `{}`)
+
+	absLayoutPath := filepath.Join(t.TempDir(), "other_image")
+	writeFile(filepath.Join(absLayoutPath, "oci-layout"), `{"imageLayoutVersion":"1.0.0"}`)
+
+	relTarballPath := filepath.Join("bazel-out", "k8-fastbuild", "bin", "app_image.tar")
+	writeFile(filepath.Join(execRoot, relTarballPath), "tarball")
+
+	relDirPath := filepath.Join("bazel-out", "k8-fastbuild", "bin", "app_files")
+	require.NoError(t, os.MkdirAll(filepath.Join(execRoot, relDirPath), 0700))
+
+	bazel := &Bazel{}
+
+	t.Run("relative path is resolved against execution root", func(t *testing.T) {
+		path, err := bazel.findOCILayout(execRoot, relTarballPath+"\n"+relLayoutPath+"\n\n")
+		require.NoError(t, err)
+		assert.Equal(t, filepath.Join(execRoot, relLayoutPath), path)
+	})
+
+	t.Run("absolute path is used as is", func(t *testing.T) {
+		path, err := bazel.findOCILayout(execRoot, "  "+absLayoutPath+"  \n")
+		require.NoError(t, err)
+		assert.Equal(t, absLayoutPath, path)
+	})
+
+	t.Run("no layout", func(t *testing.T) {
+		_, err := bazel.findOCILayout(execRoot, relTarballPath+"\n"+relDirPath+"\nbazel-out/missing\n")
+		require.Error(t, err)
+		assert.Equal(t, "Expected bazel target to output exactly one OCI layout directory, but found 0", err.Error())
+
+		_, err = bazel.findOCILayout(execRoot, "")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "but found 0")
+	})
+
+	t.Run("more than one layout", func(t *testing.T) {
+		_, err := bazel.findOCILayout(execRoot, relLayoutPath+"\n"+absLayoutPath+"\n")
+		require.Error(t, err)
+		assert.Equal(t, "Expected bazel target to output exactly one OCI layout directory, but found 2", err.Error())
+	})
+}
@@ -0,0 +1,156 @@
+// Copyright 2024 The Carvel Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package builder
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	ctlconf "carvel.dev/kbld/pkg/kbld/config"
+	ctllog "carvel.dev/kbld/pkg/kbld/logger"
+)
+
+// BuildInputs are resolved structured build inputs
+// that are passed to Docker-like builders as flags
+type BuildInputs struct {
+	Args []string
+	// SecretValues should never be shown in logs or origins
+	SecretValues []string
+}
+
+func NewBuildInputs(inputs ctlconf.SourceBuildInputs, directory string) (BuildInputs, error) {
+	var result BuildInputs
+
+	for _, arg := range inputs.BuildArgs {
+		val, err := buildArgValue(arg, directory)
+		if err != nil {
+			return BuildInputs{}, err
+		}
+		result.Args = append(result.Args, "--build-arg", arg.Name+"="+val)
+	}
+
+	for _, secret := range inputs.Secrets {
+		switch {
+		case secret.Env != nil:
+			val, found := os.LookupEnv(*secret.Env)
+			if !found {
+				return BuildInputs{}, fmt.Errorf("Expected environment variable '%s' to be set for secret '%s'", *secret.Env, secret.ID)
+			}
+			result.SecretValues = append(result.SecretValues, val)
+			result.Args = append(result.Args, "--secret", "id="+secret.ID+",env="+*secret.Env)
+
+		case secret.Src != nil:
+			path := pathRelativeTo(*secret.Src, directory)
+			bs, err := os.ReadFile(path)
+			if err != nil {
+				return BuildInputs{}, fmt.Errorf("Reading secret '%s': %s", secret.ID, err)
+			}
+			result.SecretValues = append(result.SecretValues, strings.TrimSpace(string(bs)))
+			result.Args = append(result.Args, "--secret", "id="+secret.ID+",src="+path)
+		}
+	}
+
+	for _, ssh := range inputs.SSH {
+		id := ssh.ID
+		if len(id) == 0 {
+			id = "default"
+		}
+		if len(ssh.Paths) > 0 {
+			id += "=" + strings.Join(ssh.Paths, ",")
+		}
+		result.Args = append(result.Args, "--ssh", id)
+	}
+
+	var labelNames []string
+	for name := range inputs.Labels {
+		labelNames = append(labelNames, name)
+	}
+	sort.Strings(labelNames)
+
+	for _, name := range labelNames {
+		result.Args = append(result.Args, "--label", name+"="+inputs.Labels[name])
+	}
+
+	return result, nil
+}
+
+// WithArgs returns raw options with build input flags appended
+func (b BuildInputs) WithArgs(rawOpts *[]string) *[]string {
+	if len(b.Args) == 0 {
+		return rawOpts
+	}
+
+	var result []string
+	if rawOpts != nil {
+		result = append(result, *rawOpts...)
+	}
+	result = append(result, b.Args...)
+
+	return &result
+}
+
+// RedactOrigins replaces secret values found in origins
+func (b BuildInputs) RedactOrigins(origins []ctlconf.Origin) ([]ctlconf.Origin, error) {
+	if len(b.SecretValues) == 0 {
+		return origins, nil
+	}
+
+	var escapedValues []string
+	for _, val := range b.SecretValues {
+		escapedVal, err := json.Marshal(val)
+		if err != nil {
+			return nil, err
+		}
+		escapedValues = append(escapedValues, strings.TrimSuffix(strings.TrimPrefix(string(escapedVal), `"`), `"`))
+	}
+
+	bs, err := json.Marshal(origins)
+	if err != nil {
+		return nil, fmt.Errorf("Marshaling origins: %s", err)
+	}
+
+	var result []ctlconf.Origin
+
+	err = json.Unmarshal([]byte(ctllog.Redact(string(bs), escapedValues)), &result)
+	if err != nil {
+		return nil, fmt.Errorf("Unmarshaling redacted origins: %s", err)
+	}
+
+	return result, nil
+}
+
+func buildArgValue(arg ctlconf.SourceBuildArg, directory string) (string, error) {
+	switch {
+	case arg.ValueFromEnv != nil:
+		val, found := os.LookupEnv(*arg.ValueFromEnv)
+		if !found {
+			return "", fmt.Errorf("Expected environment variable '%s' to be set for build arg '%s'", *arg.ValueFromEnv, arg.Name)
+		}
+		return val, nil
+
+	case arg.ValueFromFile != nil:
+		bs, err := os.ReadFile(pathRelativeTo(*arg.ValueFromFile, directory))
+		if err != nil {
+			return "", fmt.Errorf("Reading build arg '%s': %s", arg.Name, err)
+		}
+		return strings.TrimSpace(string(bs)), nil
+
+	case arg.Value != nil:
+		return *arg.Value, nil
+
+	default:
+		return "", nil
+	}
+}
+
+func pathRelativeTo(path, directory string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(directory, path)
+}
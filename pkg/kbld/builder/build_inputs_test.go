@@ -0,0 +1,73 @@
+// Copyright 2024 The Carvel Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package builder_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	ctlb "carvel.dev/kbld/pkg/kbld/builder"
+	ctlconf "carvel.dev/kbld/pkg/kbld/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewBuildInputs(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "version"), []byte("1.2.3\n"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "npmrc"), []byte("file-s3cr3t\n"), 0600))
+
+	t.Setenv("KBLD_TEST_COMMIT", "abc123")
+	t.Setenv("KBLD_TEST_TOKEN", "env-s3cr3t")
+
+	val := "debug"
+	commitEnv := "KBLD_TEST_COMMIT"
+	versionFile := "version"
+	tokenEnv := "KBLD_TEST_TOKEN"
+	npmrcFile := "npmrc"
+
+	inputs, err := ctlb.NewBuildInputs(ctlconf.SourceBuildInputs{
+		BuildArgs: []ctlconf.SourceBuildArg{
+			{Name: "MODE", Value: &val},
+			{Name: "COMMIT", ValueFromEnv: &commitEnv},
+			{Name: "VERSION", ValueFromFile: &versionFile},
+		},
+		Secrets: []ctlconf.SourceBuildSecret{
+			{ID: "token", Env: &tokenEnv},
+			{ID: "npmrc", Src: &npmrcFile},
+		},
+		SSH:    []ctlconf.SourceBuildSSH{{}, {ID: "github", Paths: []string{"/keys/a", "/keys/b"}}},
+		Labels: map[string]string{"team": "a", "org": "b"},
+	}, dir)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"--build-arg", "MODE=debug",
+		"--build-arg", "COMMIT=abc123",
+		"--build-arg", "VERSION=1.2.3",
+		"--secret", "id=token,env=KBLD_TEST_TOKEN",
+		"--secret", "id=npmrc,src=" + filepath.Join(dir, "npmrc"),
+		"--ssh", "default",
+		"--ssh", "github=/keys/a,/keys/b",
+		"--label", "org=b",
+		"--label", "team=a",
+	}, inputs.Args)
+	assert.Equal(t, []string{"env-s3cr3t", "file-s3cr3t"}, inputs.SecretValues)
+
+	origins, err := inputs.RedactOrigins([]ctlconf.Origin{
+		{Git: &ctlconf.OriginGit{RemoteURL: "https://env-s3cr3t@github.com/org/repo", SHA: "abc123"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "https://<redacted>@github.com/org/repo", origins[0].Git.RemoteURL)
+}
+
+func TestNewBuildInputsMissingEnv(t *testing.T) {
+	missingEnv := "KBLD_TEST_MISSING_ENV"
+
+	_, err := ctlb.NewBuildInputs(ctlconf.SourceBuildInputs{
+		Secrets: []ctlconf.SourceBuildSecret{{ID: "token", Env: &missingEnv}},
+	}, ".")
+	require.EqualError(t, err, "Expected environment variable 'KBLD_TEST_MISSING_ENV' to be set for secret 'token'")
+}
@@ -0,0 +1,289 @@
+// Copyright 2024 The Carvel Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package buildah
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	ctlb "carvel.dev/kbld/pkg/kbld/builder"
+	ctlconf "carvel.dev/kbld/pkg/kbld/config"
+	ctllog "carvel.dev/kbld/pkg/kbld/logger"
+	ctlreg "carvel.dev/kbld/pkg/kbld/registry"
+	regv1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+const (
+	defaultCommand = "buildah"
+)
+
+type Buildah struct {
+	registry ctlreg.Registry
+	logger   ctllog.Logger
+}
+
+func NewBuildah(registry ctlreg.Registry, logger ctllog.Logger) Buildah {
+	return Buildah{registry, logger}
+}
+
+// CommandName returns executable used for building (buildah or podman)
+func CommandName(opts ctlconf.SourceBuildahOpts) string {
+	if opts.Command != nil && len(*opts.Command) > 0 {
+		return *opts.Command
+	}
+	return defaultCommand
+}
+
+func (b Buildah) BuildAndOptionallyPush(ctx context.Context, image, directory string,
+	imgDst *ctlconf.ImageDestination, opts ctlconf.SourceBuildahOpts) (string, error) {
+
+	err := b.ensureDirectory(directory)
+	if err != nil {
+		return "", err
+	}
+
+	cmdName := CommandName(opts)
+
+	tmpRef, err := b.tmpRef(image)
+	if err != nil {
+		return "", err
+	}
+
+	prefixedLogger := b.logger.NewPrefixedWriter(image + " | ")
+
+	prefixedLogger.Write([]byte(fmt.Sprintf("starting build (using %s): %s -> %s\n", cmdName, directory, tmpRef)))
+	defer prefixedLogger.Write([]byte(fmt.Sprintf("finished build (using %s)\n", cmdName)))
+
+	buildEvent := b.logger.StartEvent(ctllog.Event{Type: ctllog.EventBuildStart, Image: image, Builder: cmdName, Message: directory})
+	defer buildEvent.Finish(ctllog.EventBuildFinished)
+
+	tmpDir, err := os.MkdirTemp("", "kbld-buildah")
+	if err != nil {
+		return "", fmt.Errorf("Creating tmp dir: %s", err)
+	}
+
+	defer os.RemoveAll(tmpDir)
+
+	iidFile := filepath.Join(tmpDir, "iid")
+
+	{
+		cmdArgs := []string{"build", "--iidfile", iidFile}
+
+		if opts.Build.Target != nil {
+			cmdArgs = append(cmdArgs, "--target", *opts.Build.Target)
+		}
+		if opts.Build.Platform != nil {
+			cmdArgs = append(cmdArgs, "--platform", *opts.Build.Platform)
+		}
+		if opts.Build.Pull != nil && *opts.Build.Pull {
+			cmdArgs = append(cmdArgs, "--pull")
+		}
+		if opts.Build.NoCache != nil && *opts.Build.NoCache {
+			cmdArgs = append(cmdArgs, "--no-cache")
+		}
+		if opts.Build.File != nil {
+			// Since buildah command is executed with cwd of directory,
+			// Dockerfile path doesnt need to be joined with it
+			cmdArgs = append(cmdArgs, "--file", *opts.Build.File)
+		}
+		if opts.Build.RawOptions != nil {
+			cmdArgs = append(cmdArgs, *opts.Build.RawOptions...)
+		}
+
+		cmdArgs = append(cmdArgs, "--tag", tmpRef, ".")
+
+		buildOutput := b.logger.NewEventWriter(ctllog.EventBuildOutput, image)
+		defer buildOutput.Flush()
+
+		err := b.run(ctx, cmdName, directory, cmdArgs, buildOutput)
+		if err != nil {
+			prefixedLogger.Write([]byte(fmt.Sprintf("error: %s\n", err)))
+			return "", err
+		}
+	}
+
+	imageID, err := b.readTrimmedFile(iidFile)
+	if err != nil {
+		return "", fmt.Errorf("Reading built image ID: %s", err)
+	}
+
+	if imgDst != nil {
+		defer b.removeTmpRef(ctx, cmdName, tmpRef, prefixedLogger)
+
+		pushEvent := b.logger.StartEvent(ctllog.Event{Type: ctllog.EventPushStart, Image: imgDst.NewImage, Builder: cmdName, Message: tmpRef})
+
+		var url string
+
+		if opts.Push.OCIArchive != nil && *opts.Push.OCIArchive {
+			url, err = b.pushOCIArchive(ctx, cmdName, tmpRef, tmpDir, imgDst.NewImage, opts.Push)
+		} else {
+			url, err = b.push(ctx, cmdName, tmpRef, tmpDir, imgDst.NewImage, opts.Push)
+		}
+
+		pushEvent.FinishWith(ctllog.EventPushFinished, url, err)
+
+		return url, err
+	}
+
+	return b.retagStable(ctx, cmdName, tmpRef, image, imageID, prefixedLogger)
+}
+
+// push uses buildah (or podman) to push image and record pushed manifest digest
+func (b Buildah) push(ctx context.Context, cmdName, tmpRef, tmpDir, imageDst string,
+	opts ctlconf.SourceBuildahPushOpts) (string, error) {
+
+	prefixedLogger := b.logger.NewPrefixedWriter(imageDst + " | ")
+
+	imageDstTagged, err := ctlb.DestinationTagRef(imageDst)
+	if err != nil {
+		return "", err
+	}
+
+	prefixedLogger.Write([]byte(fmt.Sprintf("starting push (using %s): %s -> %s\n", cmdName, tmpRef, imageDstTagged.Name())))
+	defer prefixedLogger.Write([]byte(fmt.Sprintf("finished push (using %s)\n", cmdName)))
+
+	digestFile := filepath.Join(tmpDir, "digest")
+
+	cmdArgs := []string{"push", "--digestfile", digestFile}
+
+	if opts.RawOptions != nil {
+		cmdArgs = append(cmdArgs, *opts.RawOptions...)
+	}
+
+	cmdArgs = append(cmdArgs, tmpRef, "docker://"+imageDstTagged.Name())
+
+	err = b.run(ctx, cmdName, "", cmdArgs, prefixedLogger)
+	if err != nil {
+		prefixedLogger.Write([]byte(fmt.Sprintf("push error: %s\n", err)))
+		return "", err
+	}
+
+	digestStr, err := b.readTrimmedFile(digestFile)
+	if err != nil {
+		return "", fmt.Errorf("Reading pushed image digest: %s", err)
+	}
+
+	digest, err := regv1.NewHash(digestStr)
+	if err != nil {
+		return "", fmt.Errorf("Parsing pushed image digest: %s", err)
+	}
+
+	return ctlb.DigestRef(imageDst, digest)
+}
+
+// pushOCIArchive exports image into an OCI layout and pushes it
+// via kbld's registry client (e.g. when buildah lacks registry credentials)
+func (b Buildah) pushOCIArchive(ctx context.Context, cmdName, tmpRef, tmpDir, imageDst string,
+	opts ctlconf.SourceBuildahPushOpts) (string, error) {
+
+	prefixedLogger := b.logger.NewPrefixedWriter(imageDst + " | ")
+
+	prefixedLogger.Write([]byte(fmt.Sprintf("starting push (using OCI archive from %s): %s -> %s\n", cmdName, tmpRef, imageDst)))
+	defer prefixedLogger.Write([]byte("finished push (using OCI archive)\n"))
+
+	layoutPath := filepath.Join(tmpDir, "oci")
+
+	cmdArgs := []string{"push"}
+
+	if opts.RawOptions != nil {
+		cmdArgs = append(cmdArgs, *opts.RawOptions...)
+	}
+
+	cmdArgs = append(cmdArgs, tmpRef, "oci:"+layoutPath)
+
+	err := b.run(ctx, cmdName, "", cmdArgs, prefixedLogger)
+	if err != nil {
+		prefixedLogger.Write([]byte(fmt.Sprintf("export error: %s\n", err)))
+		return "", err
+	}
+
+	url, err := ctlb.PushOCILayout(ctx, b.registry, layoutPath, imageDst)
+	if err != nil {
+		prefixedLogger.Write([]byte(fmt.Sprintf("push error: %s\n", err)))
+		return "", err
+	}
+
+	return url, nil
+}
+
+func (b Buildah) retagStable(ctx context.Context, cmdName, tmpRef, image, imageID string,
+	prefixedLogger *ctllog.PrefixWriter) (string, error) {
+
+	tb := ctlb.TagBuilder{}
+
+	// Retag image with its ID to produce exact image ref if nothing has changed
+	stableRef := "kbld:" + tb.CheckTagLen128(fmt.Sprintf(
+		"%s-%s",
+		tb.TrimStr(tb.CleanStr(image), 50),
+		tb.CheckLen(tb.CleanStr(imageID), 72),
+	))
+
+	err := b.run(ctx, cmdName, "", []string{"tag", tmpRef, stableRef}, prefixedLogger)
+	if err != nil {
+		prefixedLogger.Write([]byte(fmt.Sprintf("tag error: %s\n", err)))
+		return "", err
+	}
+
+	b.removeTmpRef(ctx, cmdName, tmpRef, prefixedLogger)
+
+	return stableRef, nil
+}
+
+// removeTmpRef removes temporary tag to be nice to `buildah images` output
+func (b Buildah) removeTmpRef(ctx context.Context, cmdName, tmpRef string, prefixedLogger *ctllog.PrefixWriter) {
+	err := b.run(ctx, cmdName, "", []string{"rmi", tmpRef}, prefixedLogger)
+	if err != nil {
+		prefixedLogger.Write([]byte(fmt.Sprintf("untag error: %s\n", err)))
+	}
+}
+
+func (b Buildah) run(ctx context.Context, cmdName, directory string, cmdArgs []string, output io.Writer) error {
+	var stdoutBuf, stderrBuf bytes.Buffer
+
+	cmd := ctlb.NewCmd(ctx, cmdName, cmdArgs...)
+	cmd.Dir = directory
+	cmd.Stdout = io.MultiWriter(&stdoutBuf, output)
+	cmd.Stderr = io.MultiWriter(&stderrBuf, output)
+
+	return cmd.Run()
+}
+
+func (b Buildah) tmpRef(image string) (string, error) {
+	tb := ctlb.TagBuilder{}
+
+	randPrefix50, err := tb.RandomStr50()
+	if err != nil {
+		return "", fmt.Errorf("Generating tmp image suffix: %s", err)
+	}
+
+	return "kbld:" + tb.CheckTagLen128(fmt.Sprintf(
+		"%s-%s",
+		randPrefix50,
+		tb.TrimStr(tb.CleanStr(image), 50),
+	)), nil
+}
+
+func (b Buildah) readTrimmedFile(path string) (string, error) {
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(bs)), nil
+}
+
+func (b Buildah) ensureDirectory(directory string) error {
+	stat, err := os.Stat(directory)
+	if err != nil {
+		return fmt.Errorf("Checking if path '%s' is a directory: %s", directory, err)
+	}
+	if !stat.IsDir() {
+		return fmt.Errorf("Expected path '%s' to be a directory, but was not", directory)
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+// Copyright 2024 The Carvel Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package builder
+
+import (
+	"context"
+	"os/exec"
+	"time"
+)
+
+const cmdInterruptWaitDelay = 10 * time.Second
+
+// NewCmd returns command that is interrupted when context is done,
+// giving it some time to clean up before being killed. On unix command
+// runs in its own process group so that interrupt also reaches processes
+// it started (e.g. `sh -c` children, bazel server); processes that ignore
+// interrupt are not killed and may outlive kbld.
+func NewCmd(ctx context.Context, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	setProcessGroup(cmd)
+	cmd.Cancel = func() error { return interruptProcessGroup(cmd) }
+	cmd.WaitDelay = cmdInterruptWaitDelay
+	return cmd
+}
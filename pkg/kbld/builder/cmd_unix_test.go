@@ -0,0 +1,34 @@
+// Copyright 2024 The Carvel Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !windows
+
+package builder_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	ctlb "carvel.dev/kbld/pkg/kbld/builder"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewCmdInterruptsChildProcesses(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Shell waits for its foreground child, so command only exits
+	// (before being killed after wait delay) if child is interrupted too
+	cmd := ctlb.NewCmd(ctx, "sh", "-c", "sleep 30; true")
+	require.NoError(t, cmd.Start())
+
+	time.Sleep(200 * time.Millisecond)
+	cancel()
+
+	startedAt := time.Now()
+	err := cmd.Wait()
+	require.Error(t, err)
+	assert.Less(t, time.Since(startedAt), 5*time.Second)
+}
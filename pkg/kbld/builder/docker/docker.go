@@ -5,15 +5,17 @@ package docker
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"os"
-	"os/exec"
+	"path/filepath"
 	"strings"
 
 	ctlb "carvel.dev/kbld/pkg/kbld/builder"
 	ctllog "carvel.dev/kbld/pkg/kbld/logger"
+	ctlreg "carvel.dev/kbld/pkg/kbld/registry"
 	regname "github.com/google/go-containerregistry/pkg/name"
 )
 
@@ -51,7 +53,7 @@ func New(logger ctllog.Logger) Docker {
 	return Docker{logger}
 }
 
-func (d Docker) Build(image, directory string, opts BuildOpts) (TmpRef, error) {
+func (d Docker) Build(ctx context.Context, image, directory string, opts BuildOpts) (TmpRef, error) {
 	err := d.ensureDirectory(directory)
 	if err != nil {
 		return TmpRef{}, err
@@ -75,6 +77,12 @@ func (d Docker) Build(image, directory string, opts BuildOpts) (TmpRef, error) {
 	prefixedLogger.Write([]byte(fmt.Sprintf("starting build (using Docker): %s -> %s\n", directory, tmpRef.AsString())))
 	defer prefixedLogger.Write([]byte("finished build (using Docker)\n"))
 
+	buildEvent := d.logger.StartEvent(ctllog.Event{Type: ctllog.EventBuildStart, Image: image, Builder: "docker", Message: directory})
+	defer buildEvent.Finish(ctllog.EventBuildFinished)
+
+	buildOutput := d.logger.NewEventWriter(ctllog.EventBuildOutput, image)
+	defer buildOutput.Flush()
+
 	{
 		var stdoutBuf, stderrBuf bytes.Buffer
 
@@ -100,10 +108,10 @@ func (d Docker) Build(image, directory string, opts BuildOpts) (TmpRef, error) {
 
 		cmdArgs = append(cmdArgs, "--tag", tmpRef.AsString(), ".")
 
-		cmd := exec.Command("docker", cmdArgs...)
+		cmd := ctlb.NewCmd(ctx, "docker", cmdArgs...)
 		cmd.Dir = directory
-		cmd.Stdout = io.MultiWriter(&stdoutBuf, prefixedLogger)
-		cmd.Stderr = io.MultiWriter(&stderrBuf, prefixedLogger)
+		cmd.Stdout = io.MultiWriter(&stdoutBuf, buildOutput)
+		cmd.Stderr = io.MultiWriter(&stderrBuf, buildOutput)
 
 		if opts.Buildkit != nil {
 			cmd.Env = append(os.Environ(), "DOCKER_BUILDKIT=1")
@@ -116,16 +124,16 @@ func (d Docker) Build(image, directory string, opts BuildOpts) (TmpRef, error) {
 		}
 	}
 
-	inspectData, err := d.Inspect(tmpRef.AsString())
+	inspectData, err := d.Inspect(ctx, tmpRef.AsString())
 	if err != nil {
 		prefixedLogger.Write([]byte(fmt.Sprintf("inspect error: %s\n", err)))
 		return TmpRef{}, err
 	}
 
-	return d.RetagStable(tmpRef, image, inspectData.ID, prefixedLogger)
+	return d.RetagStable(ctx, tmpRef, image, inspectData.ID, prefixedLogger)
 }
 
-func (d Docker) RetagStable(tmpRef TmpRef, image, imageID string,
+func (d Docker) RetagStable(ctx context.Context, tmpRef TmpRef, image, imageID string,
 	prefixedLogger *ctllog.PrefixWriter) (TmpRef, error) {
 
 	tb := ctlb.TagBuilder{}
@@ -142,7 +150,7 @@ func (d Docker) RetagStable(tmpRef TmpRef, image, imageID string,
 	{
 		var stdoutBuf, stderrBuf bytes.Buffer
 
-		cmd := exec.Command("docker", "tag", tmpRef.AsString(), stableTmpRef.AsString())
+		cmd := ctlb.NewCmd(ctx, "docker", "tag", tmpRef.AsString(), stableTmpRef.AsString())
 		cmd.Stdout = io.MultiWriter(&stdoutBuf, prefixedLogger)
 		cmd.Stderr = io.MultiWriter(&stderrBuf, prefixedLogger)
 
@@ -158,7 +166,7 @@ func (d Docker) RetagStable(tmpRef TmpRef, image, imageID string,
 	if !strings.HasPrefix(tmpRef.AsString(), "sha256:") {
 		var stdoutBuf, stderrBuf bytes.Buffer
 
-		cmd := exec.Command("docker", "rmi", tmpRef.AsString())
+		cmd := ctlb.NewCmd(ctx, "docker", "rmi", tmpRef.AsString())
 		cmd.Stdout = io.MultiWriter(&stdoutBuf, prefixedLogger)
 		cmd.Stderr = io.MultiWriter(&stderrBuf, prefixedLogger)
 
@@ -172,7 +180,20 @@ func (d Docker) RetagStable(tmpRef TmpRef, image, imageID string,
 	return stableTmpRef, nil
 }
 
-func (d Docker) Push(tmpRef TmpRef, imageDst string) (ImageDigest, error) {
+func (d Docker) Push(ctx context.Context, tmpRef TmpRef, imageDst string) (ImageDigest, error) {
+	pushEvent := d.logger.StartEvent(ctllog.Event{Type: ctllog.EventPushStart, Image: imageDst, Builder: "docker", Message: tmpRef.AsString()})
+
+	digest, err := d.push(ctx, tmpRef, imageDst)
+	if err != nil {
+		pushEvent.FinishWith(ctllog.EventPushFinished, "", err)
+		return ImageDigest{}, err
+	}
+
+	pushEvent.FinishWith(ctllog.EventPushFinished, imageDst+"@"+digest.AsString(), nil)
+	return digest, nil
+}
+
+func (d Docker) push(ctx context.Context, tmpRef TmpRef, imageDst string) (ImageDigest, error) {
 	prefixedLogger := d.logger.NewPrefixedWriter(imageDst + " | ")
 
 	tb := ctlb.TagBuilder{}
@@ -200,7 +221,7 @@ func (d Docker) Push(tmpRef TmpRef, imageDst string) (ImageDigest, error) {
 	prefixedLogger.Write([]byte(fmt.Sprintf("starting push (using Docker): %s -> %s\n", tmpRef.AsString(), imageDst)))
 	defer prefixedLogger.Write([]byte("finished push (using Docker)\n"))
 
-	prevInspectData, err := d.Inspect(tmpRef.AsString())
+	prevInspectData, err := d.Inspect(ctx, tmpRef.AsString())
 	if err != nil {
 		prefixedLogger.Write([]byte(fmt.Sprintf("inspect error: %s\n", err)))
 		return ImageDigest{}, err
@@ -209,7 +230,7 @@ func (d Docker) Push(tmpRef TmpRef, imageDst string) (ImageDigest, error) {
 	{
 		var stdoutBuf, stderrBuf bytes.Buffer
 
-		cmd := exec.Command("docker", "tag", tmpRef.AsString(), imageDst)
+		cmd := ctlb.NewCmd(ctx, "docker", "tag", tmpRef.AsString(), imageDst)
 		cmd.Stdout = io.MultiWriter(&stdoutBuf, prefixedLogger)
 		cmd.Stderr = io.MultiWriter(&stderrBuf, prefixedLogger)
 
@@ -223,7 +244,7 @@ func (d Docker) Push(tmpRef TmpRef, imageDst string) (ImageDigest, error) {
 	{
 		var stdoutBuf, stderrBuf bytes.Buffer
 
-		cmd := exec.Command("docker", "push", imageDst)
+		cmd := ctlb.NewCmd(ctx, "docker", "push", imageDst)
 		cmd.Stdout = io.MultiWriter(&stdoutBuf, prefixedLogger)
 		cmd.Stderr = io.MultiWriter(&stderrBuf, prefixedLogger)
 
@@ -234,7 +255,7 @@ func (d Docker) Push(tmpRef TmpRef, imageDst string) (ImageDigest, error) {
 		}
 	}
 
-	currInspectData, err := d.Inspect(imageDst)
+	currInspectData, err := d.Inspect(ctx, imageDst)
 	if err != nil {
 		prefixedLogger.Write([]byte(fmt.Sprintf("inspect error: %s\n", err)))
 		return ImageDigest{}, err
@@ -251,6 +272,59 @@ func (d Docker) Push(tmpRef TmpRef, imageDst string) (ImageDigest, error) {
 	return d.determineRepoDigest(currInspectData, prefixedLogger)
 }
 
+// PushDaemonless exports image from Docker daemon and pushes it
+// with kbld's registry client instead of relying on `docker push`
+func (d Docker) PushDaemonless(ctx context.Context, tmpRef TmpRef, imageDst string, registry ctlreg.Registry) (ImageDigest, error) {
+	prefixedLogger := d.logger.NewPrefixedWriter(imageDst + " | ")
+
+	prefixedLogger.Write([]byte(fmt.Sprintf("starting push (using Docker save): %s -> %s\n", tmpRef.AsString(), imageDst)))
+	defer prefixedLogger.Write([]byte("finished push (using Docker save)\n"))
+
+	pushEvent := d.logger.StartEvent(ctllog.Event{Type: ctllog.EventPushStart, Image: imageDst, Builder: "docker-save", Message: tmpRef.AsString()})
+
+	url, err := d.pushDaemonless(ctx, tmpRef, imageDst, registry, prefixedLogger)
+	pushEvent.FinishWith(ctllog.EventPushFinished, url, err)
+	if err != nil {
+		prefixedLogger.Write([]byte(fmt.Sprintf("push error: %s\n", err)))
+		return ImageDigest{}, err
+	}
+
+	digestRef, err := regname.NewDigest(url, regname.WeakValidation)
+	if err != nil {
+		return ImageDigest{}, err
+	}
+
+	return ImageDigest{digestRef.DigestStr()}, nil
+}
+
+func (d Docker) pushDaemonless(ctx context.Context, tmpRef TmpRef, imageDst string,
+	registry ctlreg.Registry, prefixedLogger *ctllog.PrefixWriter) (string, error) {
+
+	tmpDir, err := os.MkdirTemp("", "kbld-docker-save")
+	if err != nil {
+		return "", fmt.Errorf("Creating tmp dir: %s", err)
+	}
+
+	defer os.RemoveAll(tmpDir)
+
+	tarballPath := filepath.Join(tmpDir, "image.tar")
+
+	{
+		var stdoutBuf, stderrBuf bytes.Buffer
+
+		cmd := ctlb.NewCmd(ctx, "docker", "save", "--output", tarballPath, tmpRef.AsString())
+		cmd.Stdout = io.MultiWriter(&stdoutBuf, prefixedLogger)
+		cmd.Stderr = io.MultiWriter(&stderrBuf, prefixedLogger)
+
+		err := cmd.Run()
+		if err != nil {
+			return "", fmt.Errorf("Saving image: %s", err)
+		}
+	}
+
+	return ctlb.PushTarball(ctx, registry, tarballPath, imageDst)
+}
+
 func (d Docker) ensureDirectory(directory string) error {
 	stat, err := os.Stat(directory)
 	if err != nil {
@@ -299,12 +373,17 @@ func (d Docker) determineRepoDigest(inspectData InspectData,
 type InspectData struct {
 	ID          string
 	RepoDigests []string
+	Config      InspectConfig
+}
+
+type InspectConfig struct {
+	Labels map[string]string
 }
 
-func (d Docker) Inspect(ref string) (InspectData, error) {
+func (d Docker) Inspect(ctx context.Context, ref string) (InspectData, error) {
 	var stdoutBuf, stderrBuf bytes.Buffer
 
-	cmd := exec.Command("docker", "inspect", ref)
+	cmd := ctlb.NewCmd(ctx, "docker", "inspect", ref)
 	cmd.Stdout = &stdoutBuf
 	cmd.Stderr = &stderrBuf
 
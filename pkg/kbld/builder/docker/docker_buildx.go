@@ -5,17 +5,21 @@ package docker
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
-	"os/exec"
+	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 
 	ctlb "carvel.dev/kbld/pkg/kbld/builder"
 	ctlconf "carvel.dev/kbld/pkg/kbld/config"
 	ctllog "carvel.dev/kbld/pkg/kbld/logger"
 	regname "github.com/google/go-containerregistry/pkg/name"
+	regv1 "github.com/google/go-containerregistry/pkg/v1"
 )
 
 /*
@@ -91,17 +95,27 @@ func NewBuildx(docker Docker, logger ctllog.Logger) Buildx {
 // BuildAndOptionallyPush either loads built image into Docker daemon
 // or pushes it to specified registry.
 func (d Buildx) BuildAndOptionallyPush(
-	image, directory string, imgDst *ctlconf.ImageDestination,
-	opts ctlconf.SourceDockerBuildxOpts) (string, error) {
+	ctx context.Context, image, directory string, imgDst *ctlconf.ImageDestination,
+	opts ctlconf.SourceDockerBuildxOpts) (string, []ctlconf.Origin, error) {
 
 	err := d.ensureDirectory(directory)
 	if err != nil {
-		return "", err
+		return "", nil, err
+	}
+
+	if len(opts.Platforms) > 1 && imgDst == nil {
+		return "", nil, fmt.Errorf("Expected image destination to be specified when building for multiple platforms " +
+			"since multi-platform images cannot be loaded into local Docker")
+	}
+
+	origins, err := d.platformOrigins(opts.Platforms)
+	if err != nil {
+		return "", nil, err
 	}
 
 	tagRef, err := d.tagRef(image, imgDst)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 
 	prefixedLogger := d.logger.NewPrefixedWriter(image + " | ")
@@ -109,6 +123,21 @@ func (d Buildx) BuildAndOptionallyPush(
 	prefixedLogger.Write([]byte(fmt.Sprintf("starting build (using Docker buildx): %s -> %s\n", directory, tagRef)))
 	defer prefixedLogger.Write([]byte("finished build (using Docker buildx)\n"))
 
+	buildEvent := d.logger.StartEvent(ctllog.Event{Type: ctllog.EventBuildStart, Image: image, Builder: "docker-buildx", Message: directory})
+	defer buildEvent.Finish(ctllog.EventBuildFinished)
+
+	buildOutput := d.logger.NewEventWriter(ctllog.EventBuildOutput, image)
+	defer buildOutput.Flush()
+
+	tmpDir, err := os.MkdirTemp("", "kbld-buildx")
+	if err != nil {
+		return "", nil, fmt.Errorf("Creating tmp dir: %s", err)
+	}
+
+	defer os.RemoveAll(tmpDir)
+
+	metadataPath := filepath.Join(tmpDir, "metadata.json")
+
 	var stdoutBuf, stderrBuf bytes.Buffer
 	{
 		cmdArgs := []string{"buildx", "build", "--progress=plain"}
@@ -127,6 +156,21 @@ func (d Buildx) BuildAndOptionallyPush(
 			// Dockerfile path doesnt need to be joined with it
 			cmdArgs = append(cmdArgs, "--file", *opts.File)
 		}
+		if len(opts.Platforms) > 0 {
+			cmdArgs = append(cmdArgs, "--platform", strings.Join(opts.Platforms, ","))
+		}
+		for _, cache := range opts.CacheFrom {
+			cmdArgs = append(cmdArgs, "--cache-from", d.cacheArg(cache, false))
+		}
+		for _, cache := range opts.CacheTo {
+			cmdArgs = append(cmdArgs, "--cache-to", d.cacheArg(cache, true))
+		}
+		if opts.Provenance != nil {
+			cmdArgs = append(cmdArgs, "--provenance="+strconv.FormatBool(*opts.Provenance))
+		}
+		if opts.SBOM != nil {
+			cmdArgs = append(cmdArgs, "--sbom="+strconv.FormatBool(*opts.SBOM))
+		}
 		if opts.RawOptions != nil {
 			cmdArgs = append(cmdArgs, *opts.RawOptions...)
 		}
@@ -135,15 +179,15 @@ func (d Buildx) BuildAndOptionallyPush(
 
 		// Load built image into Docker daemon, otherwise it's not being used anywhere
 		if imgDst != nil {
-			cmdArgs = append(cmdArgs, "--push")
+			cmdArgs = append(cmdArgs, "--push", "--metadata-file", metadataPath)
 		} else {
 			cmdArgs = append(cmdArgs, "--load")
 		}
 
-		cmd := exec.Command("docker", cmdArgs...)
+		cmd := ctlb.NewCmd(ctx, "docker", cmdArgs...)
 		cmd.Dir = directory
-		cmd.Stdout = io.MultiWriter(&stdoutBuf, prefixedLogger)
-		cmd.Stderr = io.MultiWriter(&stderrBuf, prefixedLogger)
+		cmd.Stdout = io.MultiWriter(&stdoutBuf, buildOutput)
+		cmd.Stderr = io.MultiWriter(&stderrBuf, buildOutput)
 
 		err := cmd.Run()
 		if err != nil {
@@ -151,40 +195,112 @@ func (d Buildx) BuildAndOptionallyPush(
 				prefixedLogger.Write([]byte("(hint: Specify image destination as multi-platform builds are not supported on local Docker)\n"))
 			}
 			prefixedLogger.Write([]byte(fmt.Sprintf("error: %s\n", err)))
-			return "", err
+			return "", nil, err
 		}
 	}
 
 	if imgDst != nil {
-		// Digest is only printed when push option was selected
-		digestMatches := dockerBuildxPushDigest.FindStringSubmatch(stderrBuf.String())
-		if len(digestMatches) != 2 {
-			return "", fmt.Errorf("Expected to find image digest in build output but did not")
+		digest, err := d.pushedDigest(metadataPath, stderrBuf.String())
+		if err != nil {
+			return "", nil, err
 		}
 
-		digestRefStr := imgDst.NewImage + "@sha256:" + digestMatches[1]
+		digestRefStr := imgDst.NewImage + "@" + digest
 
 		digestRef, err := regname.NewDigest(digestRefStr, regname.WeakValidation)
 		if err != nil {
-			return "", fmt.Errorf("Validating destination digest ref '%s': %s", digestRefStr, err)
+			return "", nil, fmt.Errorf("Validating destination digest ref '%s': %s", digestRefStr, err)
 		}
 
-		return digestRef.Name(), nil
+		return digestRef.Name(), origins, nil
 	}
 
 	// Work with locally stored image in Docker daemon
-	inspectData, err := d.docker.Inspect(tagRef)
+	inspectData, err := d.docker.Inspect(ctx, tagRef)
 	if err != nil {
 		prefixedLogger.Write([]byte(fmt.Sprintf("inspect error: %s\n", err)))
-		return "", err
+		return "", nil, err
 	}
 
-	tmpRef, err := d.docker.RetagStable(TmpRef{tagRef}, image, inspectData.ID, prefixedLogger)
+	tmpRef, err := d.docker.RetagStable(ctx, TmpRef{tagRef}, image, inspectData.ID, prefixedLogger)
 	if err != nil {
-		return "", err
+		return "", nil, err
+	}
+
+	return tmpRef.AsString(), origins, nil
+}
+
+// pushedDigest prefers digest recorded in metadata file since for multi-platform
+// builds it is the digest of pushed index; build output is used as a fallback
+func (d Buildx) pushedDigest(metadataPath, output string) (string, error) {
+	bs, err := os.ReadFile(metadataPath)
+	if err == nil {
+		var metadata struct {
+			Digest string `json:"containerimage.digest"`
+		}
+
+		err := json.Unmarshal(bs, &metadata)
+		if err != nil {
+			return "", fmt.Errorf("Unmarshaling buildx metadata: %s", err)
+		}
+
+		if len(metadata.Digest) > 0 {
+			return metadata.Digest, nil
+		}
+	}
+
+	// Digest is only printed when push option was selected
+	digestMatches := dockerBuildxPushDigest.FindStringSubmatch(output)
+	if len(digestMatches) != 2 {
+		return "", fmt.Errorf("Expected to find image digest in build output but did not")
+	}
+
+	return "sha256:" + digestMatches[1], nil
+}
+
+func (d Buildx) cacheArg(cache ctlconf.SourceDockerBuildxCache, export bool) string {
+	parts := []string{"type=" + cache.Type}
+
+	switch cache.Type {
+	case ctlconf.SourceDockerBuildxCacheRegistry:
+		parts = append(parts, "ref="+cache.Ref)
+	case ctlconf.SourceDockerBuildxCacheLocal:
+		if export {
+			parts = append(parts, "dest="+cache.Path)
+		} else {
+			parts = append(parts, "src="+cache.Path)
+		}
+	}
+
+	if len(cache.Scope) > 0 {
+		parts = append(parts, "scope="+cache.Scope)
+	}
+	if export && len(cache.Mode) > 0 {
+		parts = append(parts, "mode="+cache.Mode)
+	}
+
+	return strings.Join(parts, ",")
+}
+
+func (d Buildx) platformOrigins(platforms []string) ([]ctlconf.Origin, error) {
+	var origins []ctlconf.Origin
+
+	for _, platformStr := range platforms {
+		platform, err := regv1.ParsePlatform(platformStr)
+		if err != nil {
+			return nil, fmt.Errorf("Parsing platform '%s': %s", platformStr, err)
+		}
+
+		origins = append(origins, ctlconf.Origin{
+			BuiltPlatform: &ctlconf.OriginBuiltPlatform{
+				OS:           platform.OS,
+				Architecture: platform.Architecture,
+				Variant:      platform.Variant,
+			},
+		})
 	}
 
-	return tmpRef.AsString(), nil
+	return origins, nil
 }
 
 func (d Buildx) tagRef(image string, imgDst *ctlconf.ImageDestination) (string, error) {
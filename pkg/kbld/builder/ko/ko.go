@@ -5,14 +5,20 @@ package ko
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
-	"os/exec"
+	"os"
+	"path/filepath"
 	"strings"
 
+	ctlb "carvel.dev/kbld/pkg/kbld/builder"
 	ctlbdk "carvel.dev/kbld/pkg/kbld/builder/docker"
 	"carvel.dev/kbld/pkg/kbld/config"
 	ctllog "carvel.dev/kbld/pkg/kbld/logger"
+	ctlreg "carvel.dev/kbld/pkg/kbld/registry"
+	regname "github.com/google/go-containerregistry/pkg/name"
+	regv1 "github.com/google/go-containerregistry/pkg/v1"
 )
 
 type Ko struct {
@@ -23,30 +29,205 @@ func NewKo(logger ctllog.Logger) Ko {
 	return Ko{logger: logger}
 }
 
-func (k *Ko) Build(image, directory string, opts config.SourceKoBuildOpts) (ctlbdk.TmpRef, error) {
+func (k *Ko) Build(ctx context.Context, image, directory string, opts config.SourceKoBuildOpts) (ctlbdk.TmpRef, error) {
+	out, err := k.build(ctx, image, directory, opts, []string{"--local"}, nil)
+	if err != nil {
+		return ctlbdk.TmpRef{}, err
+	}
+
+	return ctlbdk.NewTmpRef(out), nil
+}
+
+// BuildAndPush builds image into a tarball (without loading it into Docker daemon)
+// and pushes it with kbld's registry client
+func (k *Ko) BuildAndPush(ctx context.Context, image, directory string, opts config.SourceKoBuildOpts,
+	imageDst string, registry ctlreg.Registry) (string, error) {
+
+	tmpDir, err := os.MkdirTemp("", "kbld-ko")
+	if err != nil {
+		return "", fmt.Errorf("Creating tmp dir: %s", err)
+	}
+
+	defer os.RemoveAll(tmpDir)
+
+	tarballPath := filepath.Join(tmpDir, "image.tar")
+
+	_, err = k.build(ctx, image, directory, opts, []string{"--push=false", "--tarball", tarballPath}, nil)
+	if err != nil {
+		return "", err
+	}
+
+	prefixedLogger := k.logger.NewPrefixedWriter(imageDst + " | ")
+
+	prefixedLogger.Write([]byte(fmt.Sprintf("starting push (using ko tarball): %s\n", imageDst)))
+	defer prefixedLogger.Write([]byte("finished push (using ko tarball)\n"))
+
+	pushEvent := k.logger.StartEvent(ctllog.Event{Type: ctllog.EventPushStart, Image: imageDst, Builder: "ko", Message: tarballPath})
+
+	url, err := ctlb.PushTarball(ctx, registry, tarballPath, imageDst)
+	pushEvent.FinishWith(ctllog.EventPushFinished, url, err)
+	if err != nil {
+		prefixedLogger.Write([]byte(fmt.Sprintf("push error: %s\n", err)))
+		return "", err
+	}
+
+	return url, nil
+}
+
+// Publish lets ko push image (or image index for multiple platforms)
+// directly to destination repository and returns pushed digest reference
+func (k *Ko) Publish(ctx context.Context, image, directory string,
+	opts config.SourceKoBuildOpts, imageDst string) (string, error) {
+
+	tmpDir, err := os.MkdirTemp("", "kbld-ko")
+	if err != nil {
+		return "", fmt.Errorf("Creating tmp dir: %s", err)
+	}
+
+	defer os.RemoveAll(tmpDir)
+
+	imageRefsPath := filepath.Join(tmpDir, "image-refs")
+
+	// Image is always pushed to destination repository as is
+	// (ko would otherwise append import path to the repository name)
+	outputArgs := []string{"--push", "--image-refs", imageRefsPath}
+	if opts.Bare == nil || !*opts.Bare {
+		outputArgs = append(outputArgs, "--bare")
+	}
+
+	// Avoid overwriting ko's default 'latest' tag
+	if len(opts.Tags) == 0 {
+		imageDstTagged, err := ctlb.DestinationTagRef(imageDst)
+		if err != nil {
+			return "", err
+		}
+		outputArgs = append(outputArgs, "--tags", imageDstTagged.TagStr())
+	}
+
+	prefixedLogger := k.logger.NewPrefixedWriter(imageDst + " | ")
+
+	prefixedLogger.Write([]byte(fmt.Sprintf("starting push (using ko): %s\n", imageDst)))
+	defer prefixedLogger.Write([]byte("finished push (using ko)\n"))
+
+	pushEvent := k.logger.StartEvent(ctllog.Event{Type: ctllog.EventPushStart, Image: imageDst, Builder: "ko", Message: directory})
+
+	url, err := k.publish(ctx, image, directory, opts, outputArgs, imageRefsPath, imageDst)
+	pushEvent.FinishWith(ctllog.EventPushFinished, url, err)
+	if err != nil {
+		prefixedLogger.Write([]byte(fmt.Sprintf("push error: %s\n", err)))
+		return "", err
+	}
+
+	return url, nil
+}
+
+func (k *Ko) publish(ctx context.Context, image, directory string, opts config.SourceKoBuildOpts,
+	outputArgs []string, imageRefsPath, imageDst string) (string, error) {
+
+	_, err := k.build(ctx, image, directory, opts, outputArgs, []string{"KO_DOCKER_REPO=" + imageDst})
+	if err != nil {
+		return "", err
+	}
+
+	imageRefsBs, err := os.ReadFile(imageRefsPath)
+	if err != nil {
+		return "", fmt.Errorf("Reading pushed image reference: %s", err)
+	}
+
+	imageRefStr := strings.TrimSpace(string(imageRefsBs))
+
+	imageRef, err := regname.NewDigest(imageRefStr, regname.WeakValidation)
+	if err != nil {
+		return "", fmt.Errorf("Parsing pushed image reference '%s': %s", imageRefStr, err)
+	}
+
+	digest, err := regv1.NewHash(imageRef.DigestStr())
+	if err != nil {
+		return "", fmt.Errorf("Parsing pushed image digest: %s", err)
+	}
+
+	return ctlb.DigestRef(imageDst, digest)
+}
+
+func (k *Ko) build(ctx context.Context, image, directory string, opts config.SourceKoBuildOpts,
+	outputArgs []string, env []string) (string, error) {
+
 	prefixedLogger := k.logger.NewPrefixedWriter(image + " | ")
 
 	prefixedLogger.Write([]byte(fmt.Sprintf("starting build (using ko): %s\n", directory)))
 	defer prefixedLogger.Write([]byte("finished build (using ko)\n"))
 
+	buildEvent := k.logger.StartEvent(ctllog.Event{Type: ctllog.EventBuildStart, Image: image, Builder: "ko", Message: directory})
+	defer buildEvent.Finish(ctllog.EventBuildFinished)
+
+	buildOutput := k.logger.NewEventWriter(ctllog.EventBuildOutput, image)
+	defer buildOutput.Flush()
+
 	var stdoutBuf, stderrBuf bytes.Buffer
 
-	cmdArgs := []string{"publish", ".", "--local"}
+	cmdArgs := append([]string{"publish", "."}, outputArgs...)
 
+	if len(opts.Platforms) > 0 {
+		cmdArgs = append(cmdArgs, "--platform", strings.Join(opts.Platforms, ","))
+	}
+	if len(opts.Tags) > 0 {
+		cmdArgs = append(cmdArgs, "--tags", strings.Join(opts.Tags, ","))
+	}
+	if opts.Bare != nil && *opts.Bare {
+		cmdArgs = append(cmdArgs, "--bare")
+	}
+	if opts.PreserveImportPaths != nil && *opts.PreserveImportPaths {
+		cmdArgs = append(cmdArgs, "--preserve-import-paths")
+	}
+	if opts.SBOM != nil {
+		cmdArgs = append(cmdArgs, "--sbom", *opts.SBOM)
+	}
 	if opts.RawOptions != nil {
 		cmdArgs = append(cmdArgs, *opts.RawOptions...)
 	}
 
-	cmd := exec.Command("ko", cmdArgs...)
+	if opts.BaseImage != nil {
+		env = append(env, "KO_DEFAULTBASEIMAGE="+*opts.BaseImage)
+	}
+	if len(opts.Ldflags) > 0 {
+		goflags, err := k.goflagsWithLdflags(os.Getenv("GOFLAGS"), opts.Ldflags)
+		if err != nil {
+			return "", err
+		}
+		env = append(env, "GOFLAGS="+goflags)
+	}
+
+	cmd := ctlb.NewCmd(ctx, "ko", cmdArgs...)
 	cmd.Dir = directory
-	cmd.Stdout = io.MultiWriter(&stdoutBuf, prefixedLogger)
-	cmd.Stderr = io.MultiWriter(&stderrBuf, prefixedLogger)
+	cmd.Stdout = io.MultiWriter(&stdoutBuf, buildOutput)
+	cmd.Stderr = io.MultiWriter(&stderrBuf, buildOutput)
+
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
 
 	err := cmd.Run()
 	if err != nil {
 		prefixedLogger.Write([]byte(fmt.Sprintf("error: %s\n", err)))
-		return ctlbdk.TmpRef{}, err
+		return "", err
+	}
+
+	return strings.Trim(stdoutBuf.String(), "\n"), nil
+}
+
+// goflagsWithLdflags appends quoted -ldflags to GOFLAGS
+// since ko does not provide a flag to configure them
+// (GOFLAGS does not support escaping quotes within quoted values)
+func (k *Ko) goflagsWithLdflags(goflags string, ldflags []string) (string, error) {
+	flag := "-ldflags=" + strings.Join(ldflags, " ")
+
+	quote := "'"
+	if strings.Contains(flag, quote) {
+		quote = `"`
+		if strings.Contains(flag, quote) {
+			return "", fmt.Errorf("Expected ldflags to not contain both single and double quotes")
+		}
 	}
 
-	return ctlbdk.NewTmpRef(strings.Trim(stdoutBuf.String(), "\n")), nil
+	return strings.TrimSpace(goflags + " " + quote + flag + quote), nil
 }
@@ -0,0 +1,27 @@
+// Copyright 2024 The Carvel Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package ko
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKoGoflagsWithLdflags(t *testing.T) {
+	ko := &Ko{}
+
+	goflags, err := ko.goflagsWithLdflags("", []string{"-s", "-w"})
+	require.NoError(t, err)
+	assert.Equal(t, "'-ldflags=-s -w'", goflags)
+
+	goflags, err = ko.goflagsWithLdflags("-mod=vendor", []string{"-X 'main.Name=app v1'"})
+	require.NoError(t, err)
+	assert.Equal(t, `-mod=vendor "-ldflags=-X 'main.Name=app v1'"`, goflags)
+
+	_, err = ko.goflagsWithLdflags("", []string{`-X 'main.Name=app "v1"'`})
+	require.Error(t, err)
+	assert.Equal(t, "Expected ldflags to not contain both single and double quotes", err.Error())
+}
@@ -5,9 +5,9 @@ package image
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
-	"os/exec"
 	"regexp"
 
 	ctlb "carvel.dev/kbld/pkg/kbld/builder"
@@ -38,7 +38,7 @@ func NewKubectlBuildkit(logger ctllog.Logger) KubectlBuildkit {
 	return KubectlBuildkit{logger}
 }
 
-func (d KubectlBuildkit) BuildAndPush(image, directory string,
+func (d KubectlBuildkit) BuildAndPush(ctx context.Context, image, directory string,
 	imgDst *ctlconf.ImageDestination, opts ctlconf.SourceKubectlBuildkitOpts) (string, error) {
 
 	tagRef, err := d.tagRef(image, imgDst)
@@ -51,6 +51,12 @@ func (d KubectlBuildkit) BuildAndPush(image, directory string,
 	prefixedLogger.Write([]byte(fmt.Sprintf("starting build (using kubectl buildkit): %s -> %s\n", directory, tagRef)))
 	defer prefixedLogger.Write([]byte("finished build (using kubectl buildkit)\n"))
 
+	buildEvent := d.logger.StartEvent(ctllog.Event{Type: ctllog.EventBuildStart, Image: image, Builder: "kubectl-buildkit", Message: directory})
+	defer buildEvent.Finish(ctllog.EventBuildFinished)
+
+	buildOutput := d.logger.NewEventWriter(ctllog.EventBuildOutput, image)
+	defer buildOutput.Flush()
+
 	var stdoutBuf, stderrBuf bytes.Buffer
 
 	cmdArgs := []string{"buildkit", "build", "--progress=plain"}
@@ -84,10 +90,10 @@ func (d KubectlBuildkit) BuildAndPush(image, directory string,
 
 	cmdArgs = append(cmdArgs, "--tag", tagRef, ".")
 
-	cmd := exec.Command("kubectl", cmdArgs...)
+	cmd := ctlb.NewCmd(ctx, "kubectl", cmdArgs...)
 	cmd.Dir = directory
-	cmd.Stdout = io.MultiWriter(&stdoutBuf, prefixedLogger)
-	cmd.Stderr = io.MultiWriter(&stderrBuf, prefixedLogger)
+	cmd.Stdout = io.MultiWriter(&stdoutBuf, buildOutput)
+	cmd.Stderr = io.MultiWriter(&stderrBuf, buildOutput)
 
 	err = cmd.Run()
 	if err != nil {
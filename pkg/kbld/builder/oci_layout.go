@@ -0,0 +1,98 @@
+// Copyright 2024 The Carvel Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package builder
+
+import (
+	"context"
+	"fmt"
+
+	ctlreg "carvel.dev/kbld/pkg/kbld/registry"
+	regname "github.com/google/go-containerregistry/pkg/name"
+	regv1 "github.com/google/go-containerregistry/pkg/v1"
+	reglayout "github.com/google/go-containerregistry/pkg/v1/layout"
+)
+
+// PushOCILayout pushes single image (or index) found in OCI layout
+// to destination repository and returns its digest reference
+func PushOCILayout(ctx context.Context, registry ctlreg.Registry, layoutPath, imageDst string) (string, error) {
+	tagRef, err := DestinationTagRef(imageDst)
+	if err != nil {
+		return "", err
+	}
+
+	path, err := reglayout.FromPath(layoutPath)
+	if err != nil {
+		return "", fmt.Errorf("Reading OCI layout: %s", err)
+	}
+
+	idx, err := path.ImageIndex()
+	if err != nil {
+		return "", fmt.Errorf("Reading OCI layout index: %s", err)
+	}
+
+	idxManifest, err := idx.IndexManifest()
+	if err != nil {
+		return "", fmt.Errorf("Reading OCI layout index manifest: %s", err)
+	}
+
+	if len(idxManifest.Manifests) != 1 {
+		return "", fmt.Errorf("Expected OCI layout to contain exactly one manifest, but found %d", len(idxManifest.Manifests))
+	}
+
+	desc := idxManifest.Manifests[0]
+
+	if desc.MediaType.IsIndex() {
+		childIdx, err := idx.ImageIndex(desc.Digest)
+		if err != nil {
+			return "", fmt.Errorf("Reading OCI layout image index: %s", err)
+		}
+
+		err = registry.WriteIndex(ctx, tagRef, childIdx)
+		if err != nil {
+			return "", err
+		}
+	} else {
+		img, err := idx.Image(desc.Digest)
+		if err != nil {
+			return "", fmt.Errorf("Reading OCI layout image: %s", err)
+		}
+
+		err = registry.WriteImage(ctx, tagRef, img)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return DigestRef(imageDst, desc.Digest)
+}
+
+// DestinationTagRef generates random tag for pushed image
+// since digest is not known upfront
+func DestinationTagRef(imageDst string) (regname.Tag, error) {
+	randSuffix, err := TagBuilder{}.RandomStr50()
+	if err != nil {
+		return regname.Tag{}, fmt.Errorf("Generating image dst suffix: %s", err)
+	}
+
+	tagRefStr := imageDst + ":kbld-" + randSuffix
+
+	tagRef, err := regname.NewTag(tagRefStr, regname.WeakValidation)
+	if err != nil {
+		return regname.Tag{}, fmt.Errorf("Validating destination tag ref '%s': %s", tagRefStr, err)
+	}
+
+	return tagRef, nil
+}
+
+// DigestRef validates and returns digest reference within destination repository
+func DigestRef(imageDst string, digest regv1.Hash) (string, error) {
+	digestRefStr := imageDst + "@" + digest.String()
+
+	digestRef, err := regname.NewDigest(digestRefStr, regname.WeakValidation)
+	if err != nil {
+		return "", fmt.Errorf("Validating destination digest ref '%s': %s", digestRefStr, err)
+	}
+
+	return digestRef.Name(), nil
+}
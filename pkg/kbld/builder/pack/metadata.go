@@ -0,0 +1,107 @@
+// Copyright 2024 The Carvel Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package image
+
+import (
+	"encoding/json"
+	"fmt"
+
+	ctlconf "carvel.dev/kbld/pkg/kbld/config"
+)
+
+const (
+	buildMetadataLabel     = "io.buildpacks.build.metadata"
+	lifecycleMetadataLabel = "io.buildpacks.lifecycle.metadata"
+)
+
+type buildMetadata struct {
+	BOM []struct {
+		Name     string
+		Version  string
+		Metadata struct {
+			Version string
+		}
+		Buildpack struct {
+			ID string
+		}
+	}
+	Buildpacks []struct {
+		ID       string
+		Version  string
+		Homepage string
+	}
+}
+
+type lifecycleMetadata struct {
+	RunImage struct {
+		Image string
+	} `json:"runImage"`
+	Stack struct {
+		RunImage struct {
+			Image string
+		} `json:"runImage"`
+	}
+}
+
+// BuildpacksOrigins converts buildpacks metadata labels
+// found on built image into kbld origins
+func BuildpacksOrigins(labels map[string]string) ([]ctlconf.Origin, error) {
+	buildMetaStr, buildFound := labels[buildMetadataLabel]
+	lifecycleMetaStr, lifecycleFound := labels[lifecycleMetadataLabel]
+
+	if !buildFound && !lifecycleFound {
+		return nil, nil
+	}
+
+	result := &ctlconf.OriginBuildpacks{}
+
+	if buildFound {
+		var buildMeta buildMetadata
+
+		err := json.Unmarshal([]byte(buildMetaStr), &buildMeta)
+		if err != nil {
+			return nil, fmt.Errorf("Unmarshaling label '%s': %s", buildMetadataLabel, err)
+		}
+
+		for _, bp := range buildMeta.Buildpacks {
+			result.Buildpacks = append(result.Buildpacks, ctlconf.OriginBuildpack{
+				ID:       bp.ID,
+				Version:  bp.Version,
+				Homepage: bp.Homepage,
+			})
+		}
+
+		for _, entry := range buildMeta.BOM {
+			version := entry.Version
+			if len(version) == 0 {
+				version = entry.Metadata.Version
+			}
+
+			result.BOM = append(result.BOM, ctlconf.OriginBuildpacksBOMEntry{
+				Name:      entry.Name,
+				Version:   version,
+				Buildpack: entry.Buildpack.ID,
+			})
+		}
+	}
+
+	if lifecycleFound {
+		var lifecycleMeta lifecycleMetadata
+
+		err := json.Unmarshal([]byte(lifecycleMetaStr), &lifecycleMeta)
+		if err != nil {
+			return nil, fmt.Errorf("Unmarshaling label '%s': %s", lifecycleMetadataLabel, err)
+		}
+
+		// Older lifecycle versions only record run image within stack metadata
+		switch {
+		case len(lifecycleMeta.RunImage.Image) > 0:
+			result.RunImage = lifecycleMeta.RunImage.Image
+		case len(lifecycleMeta.Stack.RunImage.Image) > 0:
+			result.RunImage = lifecycleMeta.Stack.RunImage.Image
+		}
+	}
+
+	return []ctlconf.Origin{{Buildpacks: result}}, nil
+}
@@ -0,0 +1,52 @@
+// Copyright 2024 The Carvel Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package image_test
+
+import (
+	"testing"
+
+	ctlbpk "carvel.dev/kbld/pkg/kbld/builder/pack"
+	ctlconf "carvel.dev/kbld/pkg/kbld/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildpacksOrigins(t *testing.T) {
+	labels := map[string]string{
+		"io.buildpacks.build.metadata": `{
+  "bom": [
+    {"name": "node", "metadata": {"version": "18.17.1"}, "buildpack": {"id": "paketo-buildpacks/node-engine", "version": "1.2.3"}},
+    {"name": "npm", "version": "9.6.7", "buildpack": {"id": "paketo-buildpacks/npm-install"}}
+  ],
+  "buildpacks": [
+    {"id": "paketo-buildpacks/node-engine", "version": "1.2.3", "homepage": "https://github.com/paketo-buildpacks/node-engine"}
+  ]
+}`,
+		"io.buildpacks.lifecycle.metadata": `{"runImage": {"image": "paketobuildpacks/run:base-cnb"}}`,
+	}
+
+	origins, err := ctlbpk.BuildpacksOrigins(labels)
+	require.NoError(t, err)
+
+	assert.Equal(t, []ctlconf.Origin{{
+		Buildpacks: &ctlconf.OriginBuildpacks{
+			RunImage: "paketobuildpacks/run:base-cnb",
+			Buildpacks: []ctlconf.OriginBuildpack{{
+				ID:       "paketo-buildpacks/node-engine",
+				Version:  "1.2.3",
+				Homepage: "https://github.com/paketo-buildpacks/node-engine",
+			}},
+			BOM: []ctlconf.OriginBuildpacksBOMEntry{
+				{Name: "node", Version: "18.17.1", Buildpack: "paketo-buildpacks/node-engine"},
+				{Name: "npm", Version: "9.6.7", Buildpack: "paketo-buildpacks/npm-install"},
+			},
+		},
+	}}, origins)
+}
+
+func TestBuildpacksOriginsWithoutLabels(t *testing.T) {
+	origins, err := ctlbpk.BuildpacksOrigins(map[string]string{"other": "label"})
+	require.NoError(t, err)
+	assert.Nil(t, origins)
+}
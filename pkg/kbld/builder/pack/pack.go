@@ -5,13 +5,18 @@ package image
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
-	"os/exec"
 	"regexp"
+	"sort"
 
+	ctlb "carvel.dev/kbld/pkg/kbld/builder"
 	ctlbdk "carvel.dev/kbld/pkg/kbld/builder/docker"
+	ctlconf "carvel.dev/kbld/pkg/kbld/config"
 	ctllog "carvel.dev/kbld/pkg/kbld/logger"
+	ctlreg "carvel.dev/kbld/pkg/kbld/registry"
+	regname "github.com/google/go-containerregistry/pkg/name"
 )
 
 var (
@@ -24,74 +29,202 @@ var (
 )
 
 type Pack struct {
-	docker ctlbdk.Docker
-	logger ctllog.Logger
+	docker   ctlbdk.Docker
+	registry ctlreg.Registry
+	logger   ctllog.Logger
 }
 
 type PackBuildOpts struct {
 	Builder    *string
 	Buildpacks *[]string
 	ClearCache *bool
+	Env        map[string]string
+	RunImage   *string
+	PullPolicy *string
+	Network    *string
+	CacheImage *string
 	RawOptions *[]string // pack build -h
 }
 
-func NewPack(docker ctlbdk.Docker, logger ctllog.Logger) Pack {
-	return Pack{docker, logger}
+func NewPack(docker ctlbdk.Docker, registry ctlreg.Registry, logger ctllog.Logger) Pack {
+	return Pack{docker, registry, logger}
 }
 
-func (d Pack) Build(image, directory string, opts PackBuildOpts) (ctlbdk.TmpRef, error) {
+func (d Pack) Build(ctx context.Context, image, directory string, opts PackBuildOpts) (ctlbdk.TmpRef, []ctlconf.Origin, error) {
+	prefixedLogger := d.logger.NewPrefixedWriter(image + " | ")
+
+	stdout, err := d.build(ctx, image, image, directory, opts, nil)
+	if err != nil {
+		return ctlbdk.TmpRef{}, nil, err
+	}
+
+	matches := packImageID.FindStringSubmatch(stdout)
+	if len(matches) != 3 {
+		return ctlbdk.TmpRef{}, nil, fmt.Errorf("Expected to find image ID in pack output but did not")
+	}
+
+	imageID := "sha256:" + matches[2]
+
+	inspectData, err := d.docker.Inspect(ctx, imageID)
+	if err != nil {
+		prefixedLogger.Write([]byte(fmt.Sprintf("inspect error: %s\n", err)))
+		return ctlbdk.TmpRef{}, nil, err
+	}
+
+	origins, err := BuildpacksOrigins(inspectData.Config.Labels)
+	if err != nil {
+		return ctlbdk.TmpRef{}, nil, err
+	}
+
+	tmpRef, err := d.docker.RetagStable(ctx, ctlbdk.NewTmpRef(imageID), image, imageID, prefixedLogger)
+	if err != nil {
+		return ctlbdk.TmpRef{}, nil, err
+	}
+
+	return tmpRef, origins, nil
+}
+
+// Publish lets pack write image directly to destination repository;
+// pushed digest and buildpacks metadata are read back from the registry
+func (d Pack) Publish(ctx context.Context, image, directory string,
+	opts PackBuildOpts, imageDst string) (string, []ctlconf.Origin, error) {
+
+	imageDstTagged, err := ctlb.DestinationTagRef(imageDst)
+	if err != nil {
+		return "", nil, err
+	}
+
+	prefixedLogger := d.logger.NewPrefixedWriter(imageDst + " | ")
+
+	prefixedLogger.Write([]byte(fmt.Sprintf("starting push (using pack): %s\n", imageDstTagged.Name())))
+	defer prefixedLogger.Write([]byte("finished push (using pack)\n"))
+
+	pushEvent := d.logger.StartEvent(ctllog.Event{Type: ctllog.EventPushStart, Image: imageDst, Builder: "pack", Message: directory})
+
+	url, origins, err := d.publish(ctx, image, directory, opts, imageDstTagged.Name(), imageDst)
+	pushEvent.FinishWith(ctllog.EventPushFinished, url, err)
+	if err != nil {
+		prefixedLogger.Write([]byte(fmt.Sprintf("push error: %s\n", err)))
+		return "", nil, err
+	}
+
+	return url, origins, nil
+}
+
+func (d Pack) publish(ctx context.Context, image, directory string, opts PackBuildOpts,
+	imageDstTagged, imageDst string) (string, []ctlconf.Origin, error) {
+
+	_, err := d.build(ctx, image, imageDstTagged, directory, opts, []string{"--publish"})
+	if err != nil {
+		return "", nil, err
+	}
+
+	tagRef, err := regname.NewTag(imageDstTagged, regname.WeakValidation)
+	if err != nil {
+		return "", nil, err
+	}
+
+	img, err := d.registry.Image(ctx, tagRef)
+	if err != nil {
+		return "", nil, fmt.Errorf("Fetching published image: %s", err)
+	}
+
+	digest, err := img.Digest()
+	if err != nil {
+		return "", nil, fmt.Errorf("Getting published image digest: %s", err)
+	}
+
+	configFile, err := img.ConfigFile()
+	if err != nil {
+		return "", nil, fmt.Errorf("Getting published image config: %s", err)
+	}
+
+	origins, err := BuildpacksOrigins(configFile.Config.Labels)
+	if err != nil {
+		return "", nil, err
+	}
+
+	url, err := ctlb.DigestRef(imageDst, digest)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return url, origins, nil
+}
+
+func (d Pack) build(ctx context.Context, image, imageArg, directory string,
+	opts PackBuildOpts, outputArgs []string) (string, error) {
+
 	prefixedLogger := d.logger.NewPrefixedWriter(image + " | ")
 
 	prefixedLogger.Write([]byte(fmt.Sprintf("starting build (using pack): %s\n", directory)))
 	defer prefixedLogger.Write([]byte("finished build (using pack)\n"))
 
-	var imageID string
+	buildEvent := d.logger.StartEvent(ctllog.Event{Type: ctllog.EventBuildStart, Image: image, Builder: "pack", Message: directory})
+	defer buildEvent.Finish(ctllog.EventBuildFinished)
 
-	{
-		var stdoutBuf, stderrBuf bytes.Buffer
+	buildOutput := d.logger.NewEventWriter(ctllog.EventBuildOutput, image)
+	defer buildOutput.Flush()
 
-		// --verbose is necessary for Image ID to be displayed
-		cmdArgs := []string{"build", "--verbose", image, "--path", "."}
+	var stdoutBuf, stderrBuf bytes.Buffer
 
-		if opts.Builder == nil {
-			return ctlbdk.TmpRef{}, fmt.Errorf("Expected builder to be specified, but was not")
-		}
-		cmdArgs = append(cmdArgs, "--builder", *opts.Builder)
+	// --verbose is necessary for Image ID to be displayed
+	cmdArgs := append([]string{"build", "--verbose", imageArg, "--path", "."}, outputArgs...)
 
-		if opts.Buildpacks != nil {
-			for _, b := range *opts.Buildpacks {
-				cmdArgs = append(cmdArgs, []string{"--buildpack", b}...)
-			}
-		}
-		if opts.ClearCache != nil && *opts.ClearCache {
-			cmdArgs = append(cmdArgs, "--clear-cache")
-		}
-		if opts.RawOptions != nil {
-			cmdArgs = append(cmdArgs, *opts.RawOptions...)
+	if opts.Builder == nil {
+		return "", fmt.Errorf("Expected builder to be specified, but was not")
+	}
+	cmdArgs = append(cmdArgs, "--builder", *opts.Builder)
+
+	if opts.Buildpacks != nil {
+		for _, b := range *opts.Buildpacks {
+			cmdArgs = append(cmdArgs, []string{"--buildpack", b}...)
 		}
+	}
+	if opts.ClearCache != nil && *opts.ClearCache {
+		cmdArgs = append(cmdArgs, "--clear-cache")
+	}
 
-		cmd := exec.Command("pack", cmdArgs...)
-		cmd.Dir = directory
-		cmd.Stdout = io.MultiWriter(&stdoutBuf, prefixedLogger)
-		cmd.Stderr = io.MultiWriter(&stderrBuf, prefixedLogger)
+	var envNames []string
+	for name := range opts.Env {
+		envNames = append(envNames, name)
+	}
+	sort.Strings(envNames)
 
-		err := cmd.Run()
-		if err != nil {
-			prefixedLogger.Write([]byte(fmt.Sprintf("error: %s\n", err)))
-			return ctlbdk.TmpRef{}, err
-		}
+	for _, name := range envNames {
+		cmdArgs = append(cmdArgs, "--env", name+"="+opts.Env[name])
+	}
 
-		matches := packImageID.FindStringSubmatch(stdoutBuf.String())
-		if len(matches) != 3 {
-			return ctlbdk.TmpRef{}, fmt.Errorf("Expected to find image ID in pack output but did not")
-		}
+	if opts.RunImage != nil {
+		cmdArgs = append(cmdArgs, "--run-image", *opts.RunImage)
+	}
+	if opts.PullPolicy != nil {
+		cmdArgs = append(cmdArgs, "--pull-policy", *opts.PullPolicy)
+	}
+	if opts.Network != nil {
+		cmdArgs = append(cmdArgs, "--network", *opts.Network)
+	}
+	if opts.CacheImage != nil {
+		cmdArgs = append(cmdArgs, "--cache-image", *opts.CacheImage)
+	}
+	if opts.RawOptions != nil {
+		cmdArgs = append(cmdArgs, *opts.RawOptions...)
+	}
+
+	cmd := ctlb.NewCmd(ctx, "pack", cmdArgs...)
+	cmd.Dir = directory
+	cmd.Stdout = io.MultiWriter(&stdoutBuf, buildOutput)
+	cmd.Stderr = io.MultiWriter(&stderrBuf, buildOutput)
 
-		imageID = "sha256:" + matches[2]
+	err := cmd.Run()
+	if err != nil {
+		prefixedLogger.Write([]byte(fmt.Sprintf("error: %s\n", err)))
+		return "", err
 	}
 
-	return d.docker.RetagStable(ctlbdk.NewTmpRef(imageID), image, imageID, prefixedLogger)
+	return stdoutBuf.String(), nil
 }
 
-func (d Pack) Push(tmpRef ctlbdk.TmpRef, imageDst string) (ctlbdk.ImageDigest, error) {
-	return d.docker.Push(tmpRef, imageDst)
+func (d Pack) Push(ctx context.Context, tmpRef ctlbdk.TmpRef, imageDst string) (ctlbdk.ImageDigest, error) {
+	return d.docker.Push(ctx, tmpRef, imageDst)
 }
@@ -0,0 +1,197 @@
+// Copyright 2024 The Carvel Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+
+	ctlb "carvel.dev/kbld/pkg/kbld/builder"
+	ctlconf "carvel.dev/kbld/pkg/kbld/config"
+	ctllog "carvel.dev/kbld/pkg/kbld/logger"
+	ctlreg "carvel.dev/kbld/pkg/kbld/registry"
+	regname "github.com/google/go-containerregistry/pkg/name"
+	regv1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+const (
+	APIVersion       = "kbld.carvel.dev/builder/v1alpha1"
+	executablePrefix = "kbld-builder-"
+)
+
+// Request is written as JSON to plugin's stdin
+type Request struct {
+	APIVersion  string                 `json:"apiVersion"`
+	Image       string                 `json:"image"`
+	Path        string                 `json:"path"`
+	Destination *RequestDestination    `json:"destination,omitempty"`
+	BuildArgs   map[string]string      `json:"buildArgs,omitempty"`
+	Options     map[string]interface{} `json:"options,omitempty"`
+}
+
+type RequestDestination struct {
+	NewImage string `json:"newImage"`
+}
+
+// Response is read as JSON from plugin's stdout.
+// Exactly one of Image, Digest or OCILayoutPath is expected.
+type Response struct {
+	// Image is a reference to built image when destination is not configured
+	Image string `json:"image,omitempty"`
+	// Digest of the image that plugin pushed to destination
+	Digest string `json:"digest,omitempty"`
+	// OCILayoutPath points to OCI layout with built image that kbld pushes to destination
+	// (relative paths are relative to source path)
+	OCILayoutPath string           `json:"ociLayoutPath,omitempty"`
+	Origins       []ctlconf.Origin `json:"origins,omitempty"`
+}
+
+type Plugin struct {
+	registry ctlreg.Registry
+	logger   ctllog.Logger
+}
+
+func NewPlugin(registry ctlreg.Registry, logger ctllog.Logger) Plugin {
+	return Plugin{registry, logger}
+}
+
+// BuilderName returns name used to identify plugin in logs and plans
+func BuilderName(opts ctlconf.SourcePluginOpts) string {
+	return "plugin:" + opts.Name
+}
+
+func (p Plugin) BuildAndOptionallyPush(ctx context.Context, image, directory string,
+	imgDst *ctlconf.ImageDestination, buildArgs map[string]string,
+	opts ctlconf.SourcePluginOpts) (string, []ctlconf.Origin, error) {
+
+	absDirectory, err := filepath.Abs(directory)
+	if err != nil {
+		return "", nil, err
+	}
+
+	req := Request{
+		APIVersion: APIVersion,
+		Image:      image,
+		Path:       absDirectory,
+		BuildArgs:  buildArgs,
+		Options:    opts.Options,
+	}
+	if imgDst != nil {
+		req.Destination = &RequestDestination{NewImage: imgDst.NewImage}
+	}
+
+	builderName := BuilderName(opts)
+
+	prefixedLogger := p.logger.NewPrefixedWriter(image + " | ")
+
+	prefixedLogger.Write([]byte(fmt.Sprintf("starting build (using %s): %s\n", builderName, directory)))
+	defer prefixedLogger.Write([]byte(fmt.Sprintf("finished build (using %s)\n", builderName)))
+
+	buildEvent := p.logger.StartEvent(ctllog.Event{Type: ctllog.EventBuildStart, Image: image, Builder: builderName, Message: directory})
+	defer buildEvent.Finish(ctllog.EventBuildFinished)
+
+	resp, err := p.run(ctx, image, absDirectory, req, opts)
+	if err != nil {
+		prefixedLogger.Write([]byte(fmt.Sprintf("error: %s\n", err)))
+		return "", nil, err
+	}
+
+	url, err := p.url(ctx, absDirectory, imgDst, resp, builderName)
+	if err != nil {
+		prefixedLogger.Write([]byte(fmt.Sprintf("error: %s\n", err)))
+		return "", nil, err
+	}
+
+	return url, resp.Origins, nil
+}
+
+func (p Plugin) run(ctx context.Context, image, directory string,
+	req Request, opts ctlconf.SourcePluginOpts) (Response, error) {
+
+	reqBytes, err := json.Marshal(req)
+	if err != nil {
+		return Response{}, fmt.Errorf("Serializing plugin request: %s", err)
+	}
+
+	var stdoutBuf bytes.Buffer
+
+	buildOutput := p.logger.NewEventWriter(ctllog.EventBuildOutput, image)
+	defer buildOutput.Flush()
+
+	cmd := ctlb.NewCmd(ctx, executablePrefix+opts.Name)
+	cmd.Dir = directory
+	cmd.Stdin = bytes.NewReader(reqBytes)
+	cmd.Stdout = &stdoutBuf
+	cmd.Stderr = buildOutput
+
+	err = cmd.Run()
+	if err != nil {
+		return Response{}, fmt.Errorf("Running builder plugin '%s': %s", opts.Name, err)
+	}
+
+	var resp Response
+
+	err = json.Unmarshal(stdoutBuf.Bytes(), &resp)
+	if err != nil {
+		return Response{}, fmt.Errorf("Deserializing builder plugin '%s' response: %s", opts.Name, err)
+	}
+
+	return resp, nil
+}
+
+func (p Plugin) url(ctx context.Context, directory string, imgDst *ctlconf.ImageDestination,
+	resp Response, builderName string) (string, error) {
+
+	var set int
+	for _, val := range []string{resp.Image, resp.Digest, resp.OCILayoutPath} {
+		if len(val) > 0 {
+			set++
+		}
+	}
+	if set != 1 {
+		return "", fmt.Errorf("Expected builder plugin response to include exactly one of image, digest or ociLayoutPath")
+	}
+
+	if imgDst == nil {
+		if len(resp.Image) == 0 {
+			return "", fmt.Errorf("Expected builder plugin response to include image since destination is not configured")
+		}
+
+		_, err := regname.ParseReference(resp.Image, regname.WeakValidation)
+		if err != nil {
+			return "", fmt.Errorf("Parsing builder plugin image '%s': %s", resp.Image, err)
+		}
+
+		return resp.Image, nil
+	}
+
+	switch {
+	case len(resp.Digest) > 0:
+		digest, err := regv1.NewHash(resp.Digest)
+		if err != nil {
+			return "", fmt.Errorf("Parsing builder plugin digest: %s", err)
+		}
+
+		return ctlb.DigestRef(imgDst.NewImage, digest)
+
+	case len(resp.OCILayoutPath) > 0:
+		layoutPath := resp.OCILayoutPath
+		if !filepath.IsAbs(layoutPath) {
+			layoutPath = filepath.Join(directory, layoutPath)
+		}
+
+		pushEvent := p.logger.StartEvent(ctllog.Event{Type: ctllog.EventPushStart, Image: imgDst.NewImage, Builder: builderName, Message: layoutPath})
+
+		url, err := ctlb.PushOCILayout(ctx, p.registry, layoutPath, imgDst.NewImage)
+		pushEvent.FinishWith(ctllog.EventPushFinished, url, err)
+
+		return url, err
+
+	default:
+		return "", fmt.Errorf("Expected builder plugin response to include digest or ociLayoutPath since destination is configured")
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2024 The Carvel Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package plugin_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	ctlbpl "carvel.dev/kbld/pkg/kbld/builder/plugin"
+	ctlconf "carvel.dev/kbld/pkg/kbld/config"
+	ctllog "carvel.dev/kbld/pkg/kbld/logger"
+	ctlreg "carvel.dev/kbld/pkg/kbld/registry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPluginBuild(t *testing.T) {
+	binDir := t.TempDir()
+	srcDir := t.TempDir()
+	reqPath := filepath.Join(t.TempDir(), "request.json")
+
+	// Fake plugin records its request and responds with predefined response
+	script := `#!/bin/sh
+cat > ` + reqPath + `
+echo "building..." >&2
+cat "$KBLD_TEST_PLUGIN_RESPONSE"
+`
+	require.NoError(t, os.WriteFile(filepath.Join(binDir, "kbld-builder-test"), []byte(script), 0700))
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	plugin := ctlbpl.NewPlugin(ctlreg.Registry{}, ctllog.NewLogger(io.Discard))
+	opts := ctlconf.SourcePluginOpts{Name: "test", Options: map[string]interface{}{"flake": ".#app"}}
+
+	writeResponse := func(t *testing.T, resp string) {
+		respPath := filepath.Join(t.TempDir(), "response.json")
+		require.NoError(t, os.WriteFile(respPath, []byte(resp), 0600))
+		t.Setenv("KBLD_TEST_PLUGIN_RESPONSE", respPath)
+	}
+
+	t.Run("returns local image and origins when destination is not configured", func(t *testing.T) {
+		writeResponse(t, `{"image":"kbld:app-123","origins":[{"resolved":{"url":"nix://app"}}]}`)
+
+		url, origins, err := plugin.BuildAndOptionallyPush(context.Background(), "app", srcDir,
+			nil, map[string]string{"BASE": "base@sha256:abc"}, opts)
+		require.NoError(t, err)
+		assert.Equal(t, "kbld:app-123", url)
+		assert.Equal(t, []ctlconf.Origin{{Resolved: &ctlconf.OriginResolved{URL: "nix://app"}}}, origins)
+
+		reqBytes, err := os.ReadFile(reqPath)
+		require.NoError(t, err)
+
+		var req ctlbpl.Request
+		require.NoError(t, json.Unmarshal(reqBytes, &req))
+		assert.Equal(t, ctlbpl.Request{
+			APIVersion: ctlbpl.APIVersion,
+			Image:      "app",
+			Path:       srcDir,
+			BuildArgs:  map[string]string{"BASE": "base@sha256:abc"},
+			Options:    map[string]interface{}{"flake": ".#app"},
+		}, req)
+	})
+
+	t.Run("returns digest reference when plugin pushed to destination", func(t *testing.T) {
+		writeResponse(t, `{"digest":"sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"}`)
+
+		imgDst := &ctlconf.ImageDestination{NewImage: "registry.example.com/app"}
+
+		url, _, err := plugin.BuildAndOptionallyPush(context.Background(), "app", srcDir, imgDst, nil, opts)
+		require.NoError(t, err)
+		assert.Equal(t, "registry.example.com/app@sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", url)
+
+		reqBytes, err := os.ReadFile(reqPath)
+		require.NoError(t, err)
+		assert.Contains(t, string(reqBytes), `"destination":{"newImage":"registry.example.com/app"}`)
+	})
+
+	t.Run("fails when response does not match destination configuration", func(t *testing.T) {
+		writeResponse(t, `{"image":"kbld:app-123"}`)
+
+		imgDst := &ctlconf.ImageDestination{NewImage: "registry.example.com/app"}
+
+		_, _, err := plugin.BuildAndOptionallyPush(context.Background(), "app", srcDir, imgDst, nil, opts)
+		require.EqualError(t, err, "Expected builder plugin response to include digest or ociLayoutPath since destination is configured")
+	})
+
+	t.Run("fails when response includes multiple results", func(t *testing.T) {
+		writeResponse(t, `{"image":"kbld:app-123","digest":"sha256:aaaa"}`)
+
+		_, _, err := plugin.BuildAndOptionallyPush(context.Background(), "app", srcDir, nil, nil, opts)
+		require.EqualError(t, err, "Expected builder plugin response to include exactly one of image, digest or ociLayoutPath")
+	})
+
+	t.Run("fails when plugin is not found", func(t *testing.T) {
+		_, _, err := plugin.BuildAndOptionallyPush(context.Background(), "app", srcDir, nil, nil,
+			ctlconf.SourcePluginOpts{Name: "missing"})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "Running builder plugin 'missing'")
+	})
+}
@@ -0,0 +1,94 @@
+// Copyright 2024 The Carvel Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package builder
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	ctlreg "carvel.dev/kbld/pkg/kbld/registry"
+	regtarball "github.com/google/go-containerregistry/pkg/v1/tarball"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+)
+
+// PushTarball pushes single image found in a tarball (e.g. produced by `docker save`,
+// optionally gzip compressed) to destination repository and returns its digest reference
+func PushTarball(ctx context.Context, registry ctlreg.Registry, tarballPath, imageDst string) (string, error) {
+	tagRef, err := DestinationTagRef(imageDst)
+	if err != nil {
+		return "", err
+	}
+
+	img, err := regtarball.Image(func() (io.ReadCloser, error) { return OpenTarball(tarballPath) }, nil)
+	if err != nil {
+		return "", fmt.Errorf("Reading image tarball: %s", err)
+	}
+
+	digest, err := img.Digest()
+	if err != nil {
+		return "", fmt.Errorf("Calculating image digest: %s", err)
+	}
+
+	err = registry.WriteImage(ctx, tagRef, img)
+	if err != nil {
+		return "", err
+	}
+
+	return DigestRef(imageDst, digest)
+}
+
+// OpenTarball opens tarball transparently decompressing it if it's gzip compressed
+// (e.g. `docker save | gzip` or nix dockerTools.buildImage output)
+func OpenTarball(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	bufReader := bufio.NewReader(file)
+
+	magic, err := bufReader.Peek(len(gzipMagic))
+	if err != nil && err != io.EOF {
+		file.Close()
+		return nil, err
+	}
+
+	if !bytes.Equal(magic, gzipMagic) {
+		return readCloser{bufReader, file}, nil
+	}
+
+	gzipReader, err := gzip.NewReader(bufReader)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("Reading gzip header: %s", err)
+	}
+
+	return readCloser{gzipReader, closers{gzipReader, file}}, nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+type closers []io.Closer
+
+func (cs closers) Close() error {
+	var firstErr error
+	for _, c := range cs {
+		err := c.Close()
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
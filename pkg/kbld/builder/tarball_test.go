@@ -0,0 +1,76 @@
+// Copyright 2024 The Carvel Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package builder_test
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	ctlb "carvel.dev/kbld/pkg/kbld/builder"
+	ctlreg "carvel.dev/kbld/pkg/kbld/registry"
+	regname "github.com/google/go-containerregistry/pkg/name"
+	regregistry "github.com/google/go-containerregistry/pkg/registry"
+	regrandom "github.com/google/go-containerregistry/pkg/v1/random"
+	regtarball "github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPushTarball(t *testing.T) {
+	server := httptest.NewServer(regregistry.New(regregistry.Logger(log.New(io.Discard, "", 0))))
+	defer server.Close()
+
+	registry, err := ctlreg.NewRegistry(ctlreg.Opts{EnvAuthPrefix: "KBLD_TEST_REGISTRY"})
+	require.NoError(t, err)
+
+	imageDst := strings.TrimPrefix(server.URL, "http://") + "/app"
+
+	img, err := regrandom.Image(1024, 2)
+	require.NoError(t, err)
+
+	// Tarball in the same format as produced by `docker save`
+	tarballPath := filepath.Join(t.TempDir(), "image.tar")
+	tag, err := regname.NewTag("kbld:built")
+	require.NoError(t, err)
+	require.NoError(t, regtarball.WriteToFile(tarballPath, tag, img))
+
+	tarballImg, err := regtarball.ImageFromPath(tarballPath, nil)
+	require.NoError(t, err)
+
+	tarballDigest, err := tarballImg.Digest()
+	require.NoError(t, err)
+
+	t.Run("pushes image and returns digest reference", func(t *testing.T) {
+		url, err := ctlb.PushTarball(context.Background(), registry, tarballPath, imageDst)
+		require.NoError(t, err)
+		assert.Equal(t, imageDst+"@"+tarballDigest.String(), url)
+
+		digestRef, err := regname.NewDigest(url)
+		require.NoError(t, err)
+
+		pushedImg, err := registry.Image(context.Background(), digestRef)
+		require.NoError(t, err)
+
+		pushedLayers, err := pushedImg.Layers()
+		require.NoError(t, err)
+		assert.Len(t, pushedLayers, 2)
+	})
+
+	t.Run("missing tarball", func(t *testing.T) {
+		_, err := ctlb.PushTarball(context.Background(), registry, filepath.Join(t.TempDir(), "missing.tar"), imageDst)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "Reading image tarball: ")
+	})
+
+	t.Run("invalid destination", func(t *testing.T) {
+		_, err := ctlb.PushTarball(context.Background(), registry, tarballPath, "INVALID/app")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "Validating destination tag ref ")
+	})
+}
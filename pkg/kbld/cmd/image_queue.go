@@ -4,14 +4,20 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"sort"
+	"strings"
 	"sync"
 
+	ctlconf "carvel.dev/kbld/pkg/kbld/config"
 	ctlimg "carvel.dev/kbld/pkg/kbld/image"
+	ctllog "carvel.dev/kbld/pkg/kbld/logger"
 )
 
 type ImageQueue struct {
 	imgFactory ctlimg.Factory
+	logger     ctllog.Logger
 
 	outputImages     *ProcessedImages
 	outputImagesLock sync.Mutex
@@ -20,24 +26,57 @@ type ImageQueue struct {
 	outputErrsLock sync.Mutex
 }
 
-func NewImageQueue(imgFactory ctlimg.Factory) *ImageQueue {
-	return &ImageQueue{imgFactory: imgFactory}
+// imageQueueItem groups unprocessed image URLs that share the same work
+// (e.g. multiple URLs that are built from the same source)
+type imageQueueItem struct {
+	UnprocessedImageURLs []UnprocessedImageURL
+
+	// Only resolved for dependent items, hence not included in output
+	DependencyOnly bool
+	// Keyed by dependency image as specified in source's dependsOn
+	Dependencies map[string]*imageQueueItem
+
+	doneCh chan struct{}
+	url    string
+	err    error
+}
+
+func (i *imageQueueItem) Desc() string { return i.UnprocessedImageURLs[0].URL }
+
+func (i *imageQueueItem) DependencyImages() []string {
+	var result []string
+	for depImage := range i.Dependencies {
+		result = append(result, depImage)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func NewImageQueue(imgFactory ctlimg.Factory, logger ctllog.Logger) *ImageQueue {
+	return &ImageQueue{imgFactory: imgFactory, logger: logger}
 }
 
-func (b *ImageQueue) Run(unprocessedImageURLs *UnprocessedImageURLs, numWorkers int) (*ProcessedImages, error) {
+func (b *ImageQueue) Run(ctx context.Context, unprocessedImageURLs *UnprocessedImageURLs, numWorkers int) (*ProcessedImages, error) {
 	b.outputImages = NewProcessedImages()
 	b.outputErrs = nil
 
-	queueCh := make(chan UnprocessedImageURL, numWorkers)
+	items, err := b.orderedItems(unprocessedImageURLs)
+	if err != nil {
+		return nil, err
+	}
+
+	queueCh := make(chan *imageQueueItem, numWorkers)
 	workWg := sync.WaitGroup{}
 
 	for i := 0; i < numWorkers; i++ {
-		go b.worker(&workWg, queueCh)
+		go b.worker(ctx, &workWg, queueCh)
 	}
 
-	for _, unprocessedImageURL := range unprocessedImageURLs.All() {
+	// Items are queued in dependency order so that workers
+	// never wait for an item that has not been picked up yet
+	for _, item := range items {
 		workWg.Add(1)
-		queueCh <- unprocessedImageURL
+		queueCh <- item
 	}
 
 	workWg.Wait()
@@ -46,24 +85,174 @@ func (b *ImageQueue) Run(unprocessedImageURLs *UnprocessedImageURLs, numWorkers
 	return b.outputImages, errFromErrs(b.outputErrs)
 }
 
-func (b *ImageQueue) worker(workWg *sync.WaitGroup, queueCh <-chan UnprocessedImageURL) {
-	for unprocessedImageURL := range queueCh {
-		b.work(workWg, unprocessedImageURL)
+func (b *ImageQueue) orderedItems(unprocessedImageURLs *UnprocessedImageURLs) ([]*imageQueueItem, error) {
+	var items []*imageQueueItem
+	itemsByURL := map[string]*imageQueueItem{}
+	itemsByBuildKey := map[string]*imageQueueItem{}
+
+	findOrAddItem := func(url string, dependencyOnly bool) *imageQueueItem {
+		if item, found := itemsByURL[url]; found {
+			return item
+		}
+
+		buildKey, shared := b.imgFactory.Plan(url).BuildKey()
+		if shared {
+			if item, found := itemsByBuildKey[buildKey]; found {
+				// Dependencies are added after all unprocessed URLs
+				if !dependencyOnly {
+					item.UnprocessedImageURLs = append(item.UnprocessedImageURLs, UnprocessedImageURL{url})
+				}
+				itemsByURL[url] = item
+				return item
+			}
+		}
+
+		item := &imageQueueItem{
+			UnprocessedImageURLs: []UnprocessedImageURL{{url}},
+			DependencyOnly:       dependencyOnly,
+			Dependencies:         map[string]*imageQueueItem{},
+			doneCh:               make(chan struct{}),
+		}
+		items = append(items, item)
+		itemsByURL[url] = item
+
+		if shared {
+			itemsByBuildKey[buildKey] = item
+		}
+		return item
+	}
+
+	for _, unprocessedImageURL := range unprocessedImageURLs.All() {
+		findOrAddItem(unprocessedImageURL.URL, false)
+	}
+
+	// Dependencies may add more items that have to be inspected as well
+	for i := 0; i < len(items); i++ {
+		item := items[i]
+		plan := b.imgFactory.Plan(item.Desc())
+
+		if plan.Action == ctlimg.ImagePlanActionBuild {
+			for _, dep := range plan.Source.DependsOn {
+				item.Dependencies[dep.Image] = findOrAddItem(dep.Image, true)
+			}
+		}
 	}
+
+	return b.sortTopologically(items)
 }
 
-func (b *ImageQueue) work(workWg *sync.WaitGroup, unprocessedImageURL UnprocessedImageURL) {
+func (b *ImageQueue) sortTopologically(items []*imageQueueItem) ([]*imageQueueItem, error) {
+	const (
+		visiting = 1
+		visited  = 2
+	)
+
+	var result []*imageQueueItem
+	states := map[*imageQueueItem]int{}
+
+	var visit func(*imageQueueItem, []*imageQueueItem) error
+
+	visit = func(item *imageQueueItem, path []*imageQueueItem) error {
+		path = append(path, item)
+
+		switch states[item] {
+		case visited:
+			return nil
+		case visiting:
+			var descs []string
+			for _, pathItem := range path {
+				descs = append(descs, pathItem.Desc())
+			}
+			return fmt.Errorf("Expected sources to not have cyclic dependencies, but found: %s", strings.Join(descs, " -> "))
+		}
+
+		states[item] = visiting
+
+		for _, depImage := range item.DependencyImages() {
+			err := visit(item.Dependencies[depImage], path)
+			if err != nil {
+				return err
+			}
+		}
+
+		states[item] = visited
+		result = append(result, item)
+		return nil
+	}
+
+	for _, item := range items {
+		err := visit(item, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+func (b *ImageQueue) worker(ctx context.Context, workWg *sync.WaitGroup, queueCh <-chan *imageQueueItem) {
+	for item := range queueCh {
+		b.work(ctx, workWg, item)
+	}
+}
+
+func (b *ImageQueue) work(ctx context.Context, workWg *sync.WaitGroup, item *imageQueueItem) {
 	defer workWg.Done()
+	defer close(item.doneCh)
 
-	imgURL, origins, err := b.imgFactory.New(unprocessedImageURL.URL).URL()
-	if err != nil {
+	resolveEvent := b.logger.StartEvent(ctllog.Event{Type: ctllog.EventResolveStart, Image: item.Desc()})
+
+	item.url, item.err = b.resolve(ctx, item)
+
+	resolveEvent.FinishWith(ctllog.EventResolveFinished, item.url, item.err)
+
+	if item.err != nil {
 		b.outputErrsLock.Lock()
-		b.outputErrs = append(b.outputErrs, fmt.Errorf("Resolving image '%s': %s", unprocessedImageURL.URL, err))
+		if item.DependencyOnly {
+			b.outputErrs = append(b.outputErrs, fmt.Errorf("Resolving dependency image '%s': %s", item.Desc(), item.err))
+		} else {
+			for _, unprocessedImageURL := range item.UnprocessedImageURLs {
+				b.outputErrs = append(b.outputErrs, fmt.Errorf("Resolving image '%s': %s", unprocessedImageURL.URL, item.err))
+			}
+		}
 		b.outputErrsLock.Unlock()
-		return
 	}
+}
 
-	b.outputImagesLock.Lock()
-	b.outputImages.Add(unprocessedImageURL, Image{URL: imgURL, Origins: origins})
-	b.outputImagesLock.Unlock()
+func (b *ImageQueue) resolve(ctx context.Context, item *imageQueueItem) (string, error) {
+	resolvedDeps := map[string]string{}
+
+	for _, depImage := range item.DependencyImages() {
+		depItem := item.Dependencies[depImage]
+		<-depItem.doneCh
+		if depItem.err != nil {
+			return "", fmt.Errorf("Expected dependency '%s' to be resolved successfully", depImage)
+		}
+		resolvedDeps[depImage] = depItem.url
+	}
+
+	// All URLs in the item share the same work hence use first one to do it
+	imgURL, origins, err := b.imgFactory.NewWithDependencies(item.Desc(), resolvedDeps).URL(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	if !item.DependencyOnly {
+		b.outputImagesLock.Lock()
+		for _, unprocessedImageURL := range item.UnprocessedImageURLs {
+			b.outputImages.Add(unprocessedImageURL, Image{URL: imgURL, Origins: b.copyOrigins(origins)})
+		}
+		b.outputImagesLock.Unlock()
+	}
+
+	return imgURL, nil
+}
+
+func (b *ImageQueue) copyOrigins(origins []ctlconf.Origin) []ctlconf.Origin {
+	if origins == nil {
+		return nil
+	}
+	result := make([]ctlconf.Origin, len(origins))
+	copy(result, origins)
+	return result
 }
@@ -0,0 +1,84 @@
+// Copyright 2024 The Carvel Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd_test
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	ctlcmd "carvel.dev/kbld/pkg/kbld/cmd"
+	ctlconf "carvel.dev/kbld/pkg/kbld/config"
+	ctlimg "carvel.dev/kbld/pkg/kbld/image"
+	ctllog "carvel.dev/kbld/pkg/kbld/logger"
+	ctlreg "carvel.dev/kbld/pkg/kbld/registry"
+	ctlres "carvel.dev/kbld/pkg/kbld/resources"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImageQueueRejectsCyclicSourceDependencies(t *testing.T) {
+	_, conf, err := ctlconf.NewConfFromResources([]ctlres.Resource{
+		ctlres.MustNewResourceFromBytes([]byte(`
+apiVersion: kbld.k14s.io/v1alpha1
+kind: Config
+sources:
+- image: app
+  path: .
+  dependsOn:
+  - image: base
+    buildArg: BASE_IMAGE
+- image: base
+  path: .
+  dependsOn:
+  - image: root
+    buildArg: ROOT_IMAGE
+- image: root
+  path: .
+  dependsOn:
+  - image: app
+    buildArg: APP_IMAGE
+`)),
+	})
+	require.NoError(t, err)
+
+	imgFactory := ctlimg.NewFactory(ctlimg.FactoryOpts{Conf: conf, AllowedToBuild: true},
+		ctlreg.Registry{}, ctllog.NewLogger(io.Discard))
+
+	imageURLs := ctlcmd.NewUnprocessedImageURLs()
+	imageURLs.Add(ctlcmd.UnprocessedImageURL{URL: "app"})
+
+	_, err = ctlcmd.NewImageQueue(imgFactory, ctllog.NewLogger(io.Discard)).Run(context.Background(), imageURLs, 1)
+	assert.EqualError(t, err, "Expected sources to not have cyclic dependencies, but found: app -> base -> root -> app")
+}
+
+func TestImageQueueSkipsBuildsWithFailedDependencies(t *testing.T) {
+	_, conf, err := ctlconf.NewConfFromResources([]ctlres.Resource{
+		ctlres.MustNewResourceFromBytes([]byte(`
+apiVersion: kbld.k14s.io/v1alpha1
+kind: Config
+sources:
+- image: app
+  path: .
+  dependsOn:
+  - image: base
+    buildArg: BASE_IMAGE
+- image: base
+  path: does-not-exist
+`)),
+	})
+	require.NoError(t, err)
+
+	imgFactory := ctlimg.NewFactory(ctlimg.FactoryOpts{Conf: conf, AllowedToBuild: true},
+		ctlreg.Registry{}, ctllog.NewLogger(io.Discard))
+
+	imageURLs := ctlcmd.NewUnprocessedImageURLs()
+	imageURLs.Add(ctlcmd.UnprocessedImageURL{URL: "app"})
+
+	images, err := ctlcmd.NewImageQueue(imgFactory, ctllog.NewLogger(io.Discard)).Run(context.Background(), imageURLs, 2)
+	assert.EqualError(t, err, `
+- Resolving dependency image 'base': Checking if path 'does-not-exist' is a directory: stat does-not-exist: no such file or directory
+- Resolving image 'app': Expected dependency 'base' to be resolved successfully`)
+	assert.Len(t, images.All(), 0)
+}
@@ -90,12 +90,15 @@ func (o *InspectOptions) findImages(rs []ctlres.Resource,
 	foundImages := []foundResourceWithImage{}
 
 	for _, res := range rs {
-		imageRefs := ctlser.NewImageRefs(res.DeepCopyRaw(), conf.SearchRules())
+		imageRefs := ctlser.NewImageRefs(res.DeepCopyRaw(), conf.SearchRulesForResource(res))
 
-		imageRefs.Visit(func(imgURL string) (string, bool) {
+		err := imageRefs.Visit(func(imgURL string) (string, bool) {
 			foundImages = append(foundImages, foundResourceWithImage{URL: imgURL, Resource: res})
 			return "", false
 		})
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	return foundImages, nil
@@ -0,0 +1,23 @@
+// Copyright 2024 The Carvel Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// newInterruptibleContext returns context that is cancelled on SIGINT or SIGTERM
+// so that in-flight registry requests and builder processes are stopped
+func newInterruptibleContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		// Stop catching signals so that second one exits immediately
+		cancel()
+	}()
+	return ctx, cancel
+}
@@ -12,6 +12,9 @@ import (
 	"github.com/spf13/cobra"
 )
 
+// Commands with this annotation accept positional arguments
+const positionalArgsAnnotation = "kbld.carvel.dev/positional-args"
+
 type KbldOptions struct {
 	ui      *ui.ConfUI
 	UIFlags UIFlags
@@ -52,9 +55,21 @@ func NewKbldCmd(o *KbldOptions) *cobra.Command {
 	cmd.AddCommand(NewVersionCmd(NewVersionOptions(o.ui)))
 	cmd.AddCommand(NewRelocateCmd(NewRelocateOptions(o.ui)))
 
+	lockCmd := NewLockCmd()
+	lockCmd.AddCommand(NewLockDiffCmd(NewLockDiffOptions(o.ui)))
+	cmd.AddCommand(lockCmd)
+
+	registryCmd := NewRegistryCmd()
+	registryCmd.AddCommand(NewRegistryWhoamiCmd(NewRegistryWhoamiOptions(o.ui)))
+	cmd.AddCommand(registryCmd)
+
 	// Last one runs first
 	cobrautil.VisitCommands(cmd, cobrautil.ReconfigureCmdWithSubcmd)
-	cobrautil.VisitCommands(cmd, cobrautil.DisallowExtraArgs)
+	cobrautil.VisitCommands(cmd, func(cmd *cobra.Command) {
+		if _, found := cmd.Annotations[positionalArgsAnnotation]; !found {
+			cobrautil.DisallowExtraArgs(cmd)
+		}
+	})
 
 	cobrautil.VisitCommands(cmd, cobrautil.WrapRunEForCmd(func(*cobra.Command, []string) error {
 		o.UIFlags.ConfigureUI(o.ui)
@@ -0,0 +1,310 @@
+// Copyright 2024 The Carvel Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"carvel.dev/imgpkg/pkg/imgpkg/lockconfig"
+	ctlconf "carvel.dev/kbld/pkg/kbld/config"
+	ctlres "carvel.dev/kbld/pkg/kbld/resources"
+	"github.com/cppforlife/go-cli-ui/ui"
+	uitable "github.com/cppforlife/go-cli-ui/ui/table"
+	regname "github.com/google/go-containerregistry/pkg/name"
+	"github.com/spf13/cobra"
+)
+
+type LockDiffChange string
+
+const (
+	LockDiffChangeAdded    LockDiffChange = "added"
+	LockDiffChangeRemoved  LockDiffChange = "removed"
+	LockDiffChangeRepinned LockDiffChange = "repinned"
+)
+
+type LockDiffOptions struct {
+	ui ui.UI
+
+	AllowedRepos []string
+}
+
+type lockDiffItem struct {
+	Image  string
+	Change LockDiffChange
+	Old    *ctlconf.ImageOverride
+	New    *ctlconf.ImageOverride
+}
+
+func NewLockDiffOptions(ui ui.UI) *LockDiffOptions {
+	return &LockDiffOptions{ui: ui}
+}
+
+func NewLockDiffCmd(o *LockDiffOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "diff OLD NEW",
+		Short: "Show image changes between two lock files (kbld Config or imgpkg ImagesLock)",
+		Args:  cobra.ExactArgs(2),
+		RunE:  func(_ *cobra.Command, args []string) error { return o.Run(args[0], args[1]) },
+
+		Annotations: map[string]string{positionalArgsAnnotation: ""},
+	}
+	cmd.Flags().StringSliceVar(&o.AllowedRepos, "allowed-repo", nil, "Fail if images outside of this repository changed (format: gcr.io/foo/bar) (can be specified multiple times)")
+	return cmd
+}
+
+func (o *LockDiffOptions) Run(oldPath, newPath string) error {
+	oldOverrides, err := o.readLock(oldPath)
+	if err != nil {
+		return err
+	}
+
+	newOverrides, err := o.readLock(newPath)
+	if err != nil {
+		return err
+	}
+
+	items := o.diff(oldOverrides, newOverrides)
+
+	table := uitable.Table{
+		Title:   "Lock changes",
+		Content: "images",
+
+		Header: []uitable.Header{
+			uitable.NewHeader("Image"),
+			uitable.NewHeader("Change"),
+			uitable.NewHeader("Old"),
+			uitable.NewHeader("New"),
+			uitable.NewHeader("Origins"),
+		},
+
+		SortBy: []uitable.ColumnSort{
+			{Column: 0, Asc: true},
+		},
+
+		// Image URLs and other content is too long
+		FillFirstColumn: true,
+		Transpose:       true,
+	}
+
+	for _, item := range items {
+		var oldURL, newURL string
+		var origins []ctlconf.Origin
+
+		if item.Old != nil {
+			oldURL = item.Old.NewImage
+			origins = item.Old.ImageOrigins
+		}
+		if item.New != nil {
+			newURL = item.New.NewImage
+			origins = item.New.ImageOrigins
+		}
+
+		table.Rows = append(table.Rows, []uitable.Value{
+			uitable.NewValueString(item.Image),
+			uitable.NewValueString(string(item.Change)),
+			uitable.NewValueString(oldURL),
+			uitable.NewValueString(newURL),
+			uitable.NewValueStrings(o.originsDescription(origins)),
+		})
+	}
+
+	o.ui.PrintTable(table)
+
+	if o.AllowedRepos != nil {
+		return o.checkAllowedRepos(items)
+	}
+
+	return nil
+}
+
+func (o *LockDiffOptions) readLock(path string) (map[string]ctlconf.ImageOverride, error) {
+	fileFlags := FileFlags{Files: []string{path}}
+
+	allRs, err := fileFlags.AllResources()
+	if err != nil {
+		return nil, fmt.Errorf("Reading lock file '%s': %s", path, err)
+	}
+
+	result := map[string]ctlconf.ImageOverride{}
+
+	var configRs []ctlres.Resource
+
+	for _, res := range allRs {
+		// Plain ImagesLock entries (e.g. produced by imgpkg) do not carry
+		// kbld id hence cannot be converted to kbld Config image overrides
+		if res.APIVersion() == lockconfig.ImagesLockAPIVersion && res.Kind() == lockconfig.ImagesLockKind {
+			err := o.readImagesLock(res, result)
+			if err != nil {
+				return nil, fmt.Errorf("Reading lock file '%s': %s", path, err)
+			}
+			continue
+		}
+		configRs = append(configRs, res)
+	}
+
+	_, conf, err := ctlconf.NewConfFromResources(configRs)
+	if err != nil {
+		return nil, fmt.Errorf("Reading lock file '%s': %s", path, err)
+	}
+
+	for _, override := range conf.ImageOverrides() {
+		result[override.Image] = override
+	}
+
+	return result, nil
+}
+
+func (o *LockDiffOptions) readImagesLock(res ctlres.Resource, result map[string]ctlconf.ImageOverride) error {
+	bs, err := res.AsYAMLBytes()
+	if err != nil {
+		return err
+	}
+
+	imagesLock, err := lockconfig.NewImagesLockFromBytes(bs)
+	if err != nil {
+		return fmt.Errorf("Unmarshaling %s as ImagesLock: %s", res.Description(), err)
+	}
+
+	for _, image := range imagesLock.Images {
+		origins, err := ctlconf.NewOriginsFromString(image.Annotations[ctlconf.ImagesLockKbldOrigins])
+		if err != nil {
+			return fmt.Errorf("Unmarshaling %s as %s annotation: %s", res.Description(), ctlconf.ImagesLockKbldOrigins, err)
+		}
+
+		// Entries without kbld id are keyed by their own reference
+		key := image.Annotations[ctlconf.ImagesLockKbldID]
+		if len(key) == 0 {
+			key = image.Image
+		}
+
+		result[key] = ctlconf.ImageOverride{
+			ImageRef:     ctlconf.ImageRef{Image: key},
+			NewImage:     image.Image,
+			Preresolved:  true,
+			ImageOrigins: origins,
+		}
+	}
+
+	return nil
+}
+
+func (o *LockDiffOptions) diff(oldOverrides, newOverrides map[string]ctlconf.ImageOverride) []lockDiffItem {
+	var items []lockDiffItem
+
+	for image, oldOverride := range oldOverrides {
+		oldOverride := oldOverride // copy
+
+		newOverride, found := newOverrides[image]
+		switch {
+		case !found:
+			items = append(items, lockDiffItem{Image: image, Change: LockDiffChangeRemoved, Old: &oldOverride})
+		case newOverride.NewImage != oldOverride.NewImage:
+			items = append(items, lockDiffItem{Image: image, Change: LockDiffChangeRepinned, Old: &oldOverride, New: &newOverride})
+		}
+	}
+
+	for image, newOverride := range newOverrides {
+		newOverride := newOverride // copy
+
+		if _, found := oldOverrides[image]; !found {
+			items = append(items, lockDiffItem{Image: image, Change: LockDiffChangeAdded, New: &newOverride})
+		}
+	}
+
+	sort.Slice(items, func(i, j int) bool { return items[i].Image < items[j].Image })
+
+	return items
+}
+
+func (o *LockDiffOptions) originsDescription(origins []ctlconf.Origin) []string {
+	var result []string
+
+	for _, origin := range origins {
+		switch {
+		case origin.Git != nil:
+			desc := fmt.Sprintf("git: %s", origin.Git.SHA)
+			if origin.Git.Dirty {
+				desc += " (dirty)"
+			}
+			result = append(result, desc)
+
+		case origin.Resolved != nil && len(origin.Resolved.Tag) > 0:
+			result = append(result, fmt.Sprintf("tag: %s", origin.Resolved.Tag))
+
+		case origin.Tagged != nil:
+			result = append(result, fmt.Sprintf("tags: %s", strings.Join(origin.Tagged.Tags, ", ")))
+
+		case origin.PlatformSelected != nil:
+			platform := o.platformDescription(origin.PlatformSelected.OS,
+				origin.PlatformSelected.Architecture, origin.PlatformSelected.Variant)
+			result = append(result, fmt.Sprintf("platform: %s", platform))
+
+		case origin.BuiltPlatform != nil:
+			platform := o.platformDescription(origin.BuiltPlatform.OS,
+				origin.BuiltPlatform.Architecture, origin.BuiltPlatform.Variant)
+			result = append(result, fmt.Sprintf("built platform: %s", platform))
+
+		case origin.Cached != nil:
+			result = append(result, fmt.Sprintf("cached: %s", origin.Cached.Fingerprint))
+
+		case origin.Buildpacks != nil:
+			var buildpacks []string
+			for _, bp := range origin.Buildpacks.Buildpacks {
+				buildpacks = append(buildpacks, bp.ID+"@"+bp.Version)
+			}
+			result = append(result, fmt.Sprintf("buildpacks: %s", strings.Join(buildpacks, ", ")))
+		}
+	}
+
+	return result
+}
+
+func (o *LockDiffOptions) platformDescription(os, arch, variant string) string {
+	platform := []string{os, arch}
+	if len(variant) > 0 {
+		platform = append(platform, variant)
+	}
+	return strings.Join(platform, "/")
+}
+
+func (o *LockDiffOptions) checkAllowedRepos(items []lockDiffItem) error {
+	allowedRepos := map[string]struct{}{}
+
+	for _, repo := range o.AllowedRepos {
+		parsedRepo, err := regname.NewRepository(repo, regname.WeakValidation)
+		if err != nil {
+			return fmt.Errorf("Parsing allowed repository '%s': %s", repo, err)
+		}
+		allowedRepos[parsedRepo.Name()] = struct{}{}
+	}
+
+	var disallowedImages []string
+
+	for _, item := range items {
+		for _, override := range []*ctlconf.ImageOverride{item.Old, item.New} {
+			if override == nil {
+				continue
+			}
+
+			ref, err := regname.ParseReference(override.NewImage, regname.WeakValidation)
+			if err != nil {
+				return fmt.Errorf("Parsing image '%s': %s", override.NewImage, err)
+			}
+
+			if _, found := allowedRepos[ref.Context().Name()]; !found {
+				disallowedImages = append(disallowedImages, item.Image)
+				break
+			}
+		}
+	}
+
+	if len(disallowedImages) > 0 {
+		return fmt.Errorf("Expected lock changes only within allowed repositories, but found changes in: %s",
+			strings.Join(disallowedImages, ", "))
+	}
+
+	return nil
+}
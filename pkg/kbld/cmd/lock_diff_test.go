@@ -0,0 +1,55 @@
+// Copyright 2024 The Carvel Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	ctlcmd "carvel.dev/kbld/pkg/kbld/cmd"
+	"github.com/cppforlife/go-cli-ui/ui"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLockDiffImagesLockWithoutKbldID(t *testing.T) {
+	oldLock := `
+apiVersion: imgpkg.carvel.dev/v1alpha1
+kind: ImagesLock
+images:
+- image: gcr.io/foo/app@sha256:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb
+- image: gcr.io/foo/same@sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa
+`
+
+	newLock := `
+apiVersion: imgpkg.carvel.dev/v1alpha1
+kind: ImagesLock
+images:
+- image: gcr.io/foo/app@sha256:cccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccc
+- image: gcr.io/foo/same@sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa
+`
+
+	dir := t.TempDir()
+	oldPath := filepath.Join(dir, "old.yml")
+	newPath := filepath.Join(dir, "new.yml")
+
+	require.NoError(t, os.WriteFile(oldPath, []byte(oldLock), 0600))
+	require.NoError(t, os.WriteFile(newPath, []byte(newLock), 0600))
+
+	var out bytes.Buffer
+
+	opts := ctlcmd.NewLockDiffOptions(ui.NewWriterUI(&out, &out, ui.NewNoopLogger()))
+	opts.AllowedRepos = []string{"gcr.io/foo/other"}
+
+	err := opts.Run(oldPath, newPath)
+	assert.EqualError(t, err, "Expected lock changes only within allowed repositories, but found changes in: "+
+		"gcr.io/foo/app@sha256:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb, "+
+		"gcr.io/foo/app@sha256:cccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccc")
+
+	assert.Contains(t, out.String(), "removed")
+	assert.Contains(t, out.String(), "added")
+	assert.NotContains(t, out.String(), "gcr.io/foo/same")
+}
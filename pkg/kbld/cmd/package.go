@@ -77,14 +77,22 @@ func (o *PackageOptions) Run() error {
 		return err
 	}
 
-	registry, err := ctlreg.NewRegistry(o.RegistryFlags.AsRegistryOpts())
+	registryOpts, err := o.RegistryFlags.AsRegistryOpts(&logger)
 	if err != nil {
 		return err
 	}
 
+	registry, err := ctlreg.NewRegistry(registryOpts)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := newInterruptibleContext()
+	defer cancel()
+
 	imageSet := TarImageSet{ImageSet{o.Concurrency, prefixedLogger}, o.Concurrency, prefixedLogger}
 
-	return imageSet.Export(foundImages, o.OutputPath, registry)
+	return imageSet.Export(ctx, foundImages, o.OutputPath, registry)
 }
 
 func FindImages(allRs []ctlres.Resource, conf ctlconf.Conf) (*UnprocessedImageURLs, error) {
@@ -92,12 +100,15 @@ func FindImages(allRs []ctlres.Resource, conf ctlconf.Conf) (*UnprocessedImageUR
 	foundImages := NewUnprocessedImageURLs()
 
 	for _, res := range allRs {
-		imageRefs := ctlser.NewImageRefs(res.DeepCopyRaw(), conf.SearchRules())
+		imageRefs := ctlser.NewImageRefs(res.DeepCopyRaw(), conf.SearchRulesForResource(res))
 
-		imageRefs.Visit(func(imgURL string) (string, bool) {
+		err := imageRefs.Visit(func(imgURL string) (string, bool) {
 			foundImages.Add(UnprocessedImageURL{imgURL})
 			return "", false
 		})
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	// Include preresolved images since we want to
@@ -4,6 +4,12 @@
 package cmd
 
 import (
+	"fmt"
+	"strings"
+	"time"
+
+	ctlconf "carvel.dev/kbld/pkg/kbld/config"
+	ctllog "carvel.dev/kbld/pkg/kbld/logger"
 	ctlreg "carvel.dev/kbld/pkg/kbld/registry"
 	"github.com/spf13/cobra"
 )
@@ -12,19 +18,69 @@ type RegistryFlags struct {
 	CACertPaths []string
 	VerifyCerts bool
 	Insecure    bool
+	Mirrors     []string
+	Retries     int
+	Backoff     time.Duration
+	AuthFile    string
+	ClientCert  string
+	ClientKey   string
+	Keychains   []string
 }
 
 func (s *RegistryFlags) Set(cmd *cobra.Command) {
 	cmd.Flags().StringSliceVar(&s.CACertPaths, "registry-ca-cert-path", nil, "Add CA certificates for registry API (format: /tmp/foo) (can be specified multiple times)")
 	cmd.Flags().BoolVar(&s.VerifyCerts, "registry-verify-certs", true, "Set whether to verify server's certificate chain and host name")
 	cmd.Flags().BoolVar(&s.Insecure, "registry-insecure", false, "Allow the use of http when interacting with registries")
+	cmd.Flags().StringSliceVar(&s.Mirrors, "registry-mirror", nil, "Pull from registry mirror before falling back to canonical registry (format: docker.io=mirror.example.com/dockerhub) (can be specified multiple times)")
+	cmd.Flags().IntVar(&s.Retries, "registry-retries", 5, "Set number of times failed registry operations are retried")
+	cmd.Flags().DurationVar(&s.Backoff, "registry-backoff", 1*time.Second, "Set initial delay before retrying failed registry operations (doubled for each retry unless registry specifies Retry-After, which is capped at "+ctlreg.MaxRetryAfter.String()+")")
+	cmd.Flags().StringVar(&s.AuthFile, "registry-auth-file", "", "Read registry credentials from Docker config.json or Podman auth.json instead of default Docker config (format: /tmp/auth.json)")
+	cmd.Flags().StringVar(&s.ClientCert, "registry-client-cert", "", "Set client certificate for registries requiring mutual TLS (format: /tmp/cert.pem)")
+	cmd.Flags().StringVar(&s.ClientKey, "registry-client-key", "", "Set client certificate key for registries requiring mutual TLS (format: /tmp/key.pem)")
+	cmd.Flags().StringSliceVar(&s.Keychains, "registry-keychain", nil, "Derive credentials for matching registries from cloud provider credentials found in environment (format: "+strings.Join(ctlreg.CloudKeychainNames, ",")+") (can be specified multiple times)")
 }
 
-func (s *RegistryFlags) AsRegistryOpts() ctlreg.Opts {
-	return ctlreg.Opts{
+// AsRegistryOpts uses given logger to report registry operation retries
+func (s *RegistryFlags) AsRegistryOpts(logger *ctllog.Logger) (ctlreg.Opts, error) {
+	opts := ctlreg.Opts{
 		CACertPaths:   s.CACertPaths,
 		VerifyCerts:   s.VerifyCerts,
 		Insecure:      s.Insecure,
 		EnvAuthPrefix: "KBLD_REGISTRY",
+		RetryPolicy:   ctlreg.RetryPolicy{Retries: s.Retries, Backoff: s.Backoff, Logger: logger},
+		AuthFile:      s.AuthFile,
+		ClientCert:    ctlreg.ClientCertPaths{CertPath: s.ClientCert, KeyPath: s.ClientKey},
+		Keychains:     s.Keychains,
+	}
+
+	for _, val := range s.Mirrors {
+		pieces := strings.SplitN(val, "=", 2)
+		if len(pieces) != 2 || len(pieces[0]) == 0 || len(pieces[1]) == 0 {
+			return ctlreg.Opts{}, fmt.Errorf("Expected registry mirror '%s' to be in format 'registry=mirror'", val)
+		}
+		opts.Mirrors = append(opts.Mirrors, ctlreg.Mirror{Registry: pieces[0], Endpoints: []string{pieces[1]}})
 	}
+
+	return opts, nil
+}
+
+// AsRegistryOptsWithConf additionally includes registry settings
+// (mirrors and credential helpers) specified in kbld configuration
+func (s *RegistryFlags) AsRegistryOptsWithConf(conf ctlconf.Conf, logger *ctllog.Logger) (ctlreg.Opts, error) {
+	opts, err := s.AsRegistryOpts(logger)
+	if err != nil {
+		return ctlreg.Opts{}, err
+	}
+
+	for _, mirror := range conf.RegistryMirrors() {
+		opts.Mirrors = append(opts.Mirrors, ctlreg.Mirror{
+			Registry:        mirror.Registry,
+			Endpoints:       mirror.Mirrors,
+			RewriteToMirror: mirror.RewriteToMirror,
+		})
+	}
+
+	opts.CredHelpers = conf.CredHelpers()
+
+	return opts, nil
 }
@@ -0,0 +1,34 @@
+// Copyright 2024 The Carvel Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd_test
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	ctlcmd "carvel.dev/kbld/pkg/kbld/cmd"
+	ctlconf "carvel.dev/kbld/pkg/kbld/config"
+	ctllog "carvel.dev/kbld/pkg/kbld/logger"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistryFlagsRetryPolicyLogger(t *testing.T) {
+	flags := ctlcmd.RegistryFlags{}
+	flags.Set(&cobra.Command{})
+
+	logger := ctllog.NewLogger(io.Discard)
+
+	opts, err := flags.AsRegistryOpts(&logger)
+	require.NoError(t, err)
+	assert.Equal(t, 5, opts.RetryPolicy.Retries)
+	assert.Equal(t, 1*time.Second, opts.RetryPolicy.Backoff)
+	assert.Same(t, &logger, opts.RetryPolicy.Logger)
+
+	opts, err = flags.AsRegistryOptsWithConf(ctlconf.Conf{}, &logger)
+	require.NoError(t, err)
+	assert.Same(t, &logger, opts.RetryPolicy.Logger)
+}
@@ -0,0 +1,171 @@
+// Copyright 2024 The Carvel Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	ctlconf "carvel.dev/kbld/pkg/kbld/config"
+	ctlimg "carvel.dev/kbld/pkg/kbld/image"
+	ctllog "carvel.dev/kbld/pkg/kbld/logger"
+	ctlreg "carvel.dev/kbld/pkg/kbld/registry"
+	ctlres "carvel.dev/kbld/pkg/kbld/resources"
+	ctlser "carvel.dev/kbld/pkg/kbld/search"
+	"github.com/cppforlife/go-cli-ui/ui"
+	uitable "github.com/cppforlife/go-cli-ui/ui/table"
+	regname "github.com/google/go-containerregistry/pkg/name"
+	"github.com/spf13/cobra"
+)
+
+type RegistryWhoamiOptions struct {
+	ui ui.UI
+
+	FileFlags     FileFlags
+	RegistryFlags RegistryFlags
+}
+
+func NewRegistryWhoamiOptions(ui ui.UI) *RegistryWhoamiOptions {
+	return &RegistryWhoamiOptions{ui: ui}
+}
+
+func NewRegistryWhoamiCmd(o *RegistryWhoamiOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "whoami",
+		Short: "Show which credentials would be used for registries referenced in inputs",
+		RunE:  func(_ *cobra.Command, _ []string) error { return o.Run() },
+	}
+	o.FileFlags.Set(cmd)
+	o.RegistryFlags.Set(cmd)
+	return cmd
+}
+
+func (o *RegistryWhoamiOptions) Run() error {
+	nonConfigRs, conf, err := o.FileFlags.ResourcesAndConfig()
+	if err != nil {
+		return err
+	}
+
+	logger := ctllog.NewLogger(os.Stderr)
+
+	registryOpts, err := o.RegistryFlags.AsRegistryOptsWithConf(conf, &logger)
+	if err != nil {
+		return err
+	}
+
+	registry, err := ctlreg.NewRegistry(registryOpts)
+	if err != nil {
+		return err
+	}
+
+	imgFactory := ctlimg.NewFactory(ctlimg.FactoryOpts{Conf: conf, AllowedToBuild: true}, registry, logger)
+
+	imgsByRegistry, err := o.imagesByRegistry(nonConfigRs, conf, imgFactory)
+	if err != nil {
+		return err
+	}
+
+	table := uitable.Table{
+		Title:   "Registry credentials",
+		Content: "registries",
+
+		Header: []uitable.Header{
+			uitable.NewHeader("Registry"),
+			uitable.NewHeader("Source"),
+			uitable.NewHeader("Username"),
+			uitable.NewHeader("Images"),
+		},
+
+		SortBy: []uitable.ColumnSort{
+			{Column: 0, Asc: true},
+		},
+	}
+
+	var failedRegistries []string
+
+	ctx, cancel := newInterruptibleContext()
+	defer cancel()
+
+	for registryName, imgURLs := range imgsByRegistry {
+		sort.Strings(imgURLs)
+
+		// Show all registries even if some credentials cannot be determined
+		// (e.g. credential helper is not installed)
+		var sourceVal uitable.Value
+		authInfo, err := registry.AuthInfo(ctx, registryName)
+		if err != nil {
+			sourceVal = uitable.NewValueFmt(uitable.NewValueString(fmt.Sprintf("error: %s", err)), true)
+			failedRegistries = append(failedRegistries, registryName)
+		} else {
+			sourceVal = uitable.NewValueString(authInfo.Source)
+		}
+
+		table.Rows = append(table.Rows, []uitable.Value{
+			uitable.NewValueString(registryName),
+			sourceVal,
+			uitable.NewValueString(authInfo.Username),
+			uitable.NewValueStrings(imgURLs),
+		})
+	}
+
+	o.ui.PrintTable(table)
+
+	if len(failedRegistries) > 0 {
+		sort.Strings(failedRegistries)
+		return fmt.Errorf("Expected to determine credentials for all registries, but failed for: %s",
+			strings.Join(failedRegistries, ", "))
+	}
+
+	return nil
+}
+
+// imagesByRegistry finds registries that kbld would contact
+// for images found in inputs (resolving, tag selection or pushing built images)
+func (o *RegistryWhoamiOptions) imagesByRegistry(nonConfigRs []ctlres.Resource,
+	conf ctlconf.Conf, imgFactory ctlimg.Factory) (map[string][]string, error) {
+
+	result := map[string][]string{}
+
+	for _, res := range nonConfigRs {
+		var imgURLs []string
+
+		err := ctlser.NewImageRefs(res.DeepCopyRaw(), conf.SearchRulesForResource(res)).Visit(func(imgURL string) (string, bool) {
+			imgURLs = append(imgURLs, imgURL)
+			return "", false
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, imgURL := range imgURLs {
+			plan := imgFactory.Plan(imgURL)
+
+			var registryURL string
+
+			switch plan.Action {
+			case ctlimg.ImagePlanActionPreresolved, ctlimg.ImagePlanActionBuildDisallowed:
+				continue
+			case ctlimg.ImagePlanActionBuild:
+				if plan.Destination == nil {
+					continue
+				}
+				registryURL = plan.Destination.NewImage
+			default:
+				registryURL = plan.URL
+			}
+
+			ref, err := regname.ParseReference(registryURL, regname.WeakValidation)
+			if err != nil {
+				return nil, fmt.Errorf("Parsing image '%s': %s", registryURL, err)
+			}
+
+			registryName := ref.Context().RegistryStr()
+			result[registryName] = appendUniqueStr(result[registryName], imgURL)
+		}
+	}
+
+	return result, nil
+}
@@ -88,14 +88,22 @@ func (o *RelocateOptions) Run() error {
 		return fmt.Errorf("Building import repository ref: %s", err)
 	}
 
-	dstRegistry, err := ctlreg.NewRegistry(o.RegistryFlags.AsRegistryOpts())
+	registryOpts, err := o.RegistryFlags.AsRegistryOpts(&logger)
 	if err != nil {
 		return err
 	}
 
+	dstRegistry, err := ctlreg.NewRegistry(registryOpts)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := newInterruptibleContext()
+	defer cancel()
+
 	imageSet := ImageSet{o.Concurrency, prefixedLogger}
 
-	importedImages, err := imageSet.Relocate(foundImages, importRepo, dstRegistry)
+	importedImages, err := imageSet.Relocate(ctx, foundImages, importRepo, dstRegistry)
 	if err != nil {
 		return err
 	}
@@ -129,9 +137,9 @@ func (o *RelocateOptions) updateRefsInResources(
 
 	for _, res := range nonConfigRs {
 		resContents := res.DeepCopyRaw()
-		imageRefs := ctlser.NewImageRefs(resContents, conf.SearchRules())
+		imageRefs := ctlser.NewImageRefs(resContents, conf.SearchRulesForResource(res))
 
-		imageRefs.Visit(func(imgURL string) (string, bool) {
+		err := imageRefs.Visit(func(imgURL string) (string, bool) {
 			outputImg, found := resolvedImages.FindByURL(UnprocessedImageURL{imgURL})
 			if found {
 				return outputImg.URL, true
@@ -139,6 +147,9 @@ func (o *RelocateOptions) updateRefsInResources(
 			missingImageErrs = append(missingImageErrs, fmt.Errorf("Expected to find image for '%s'", imgURL))
 			return "", false
 		})
+		if err != nil {
+			return nil, err
+		}
 
 		resBs, err := yaml.Marshal(resContents)
 		if err != nil {
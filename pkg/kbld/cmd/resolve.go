@@ -4,10 +4,12 @@
 package cmd
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"carvel.dev/imgpkg/pkg/imgpkg/lockconfig"
 	ctlconf "carvel.dev/kbld/pkg/kbld/config"
@@ -35,7 +37,19 @@ type ResolveOptions struct {
 	LockOutput        string
 	ImgpkgLockOutput  string
 	UnresolvedInspect bool
+	Plan              bool
 	Platform          string
+	LogFormat         string
+
+	ResolveCacheDir        string
+	ResolveCacheTTL        time.Duration
+	ResolveCacheInvalidate []string
+
+	ResolveTimeout time.Duration
+	BuildTimeout   time.Duration
+
+	SkipUnchangedBuilds bool
+	PushDaemonless      bool
 }
 
 func NewResolveOptions(ui ui.UI) *ResolveOptions {
@@ -58,7 +72,16 @@ func NewResolveCmd(o *ResolveOptions) *cobra.Command {
 	cmd.Flags().StringVar(&o.LockOutput, "lock-output", "", "File path to emit configuration with resolved image references")
 	cmd.Flags().StringVar(&o.ImgpkgLockOutput, "imgpkg-lock-output", "", "File path to emit images lockfile with resolved image references")
 	cmd.Flags().BoolVar(&o.UnresolvedInspect, "unresolved-inspect", false, "List image references found in inputs")
+	cmd.Flags().BoolVar(&o.Plan, "plan", false, "Show how found image references would be resolved, built and pushed without doing so")
 	cmd.Flags().StringVar(&o.Platform, "platform", "", "Apply platform selection to image indexes")
+	cmd.Flags().StringVar(&o.LogFormat, "log-format", string(ctllog.FormatText), "Set log format for progress on stderr (text, json)")
+	cmd.Flags().StringVar(&o.ResolveCacheDir, "resolve-cache-dir", "", "Directory to cache resolved tag digests in (disabled if empty)")
+	cmd.Flags().DurationVar(&o.ResolveCacheTTL, "resolve-cache-ttl", 24*time.Hour, "Set how long resolved tag digests are reused (0 means forever)")
+	cmd.Flags().StringSliceVar(&o.ResolveCacheInvalidate, "resolve-cache-invalidate", nil, "Drop cached digests for registry (format: gcr.io) (can be specified multiple times)")
+	cmd.Flags().DurationVar(&o.ResolveTimeout, "resolve-timeout", 0, "Set maximum time to resolve each image (0 means no limit)")
+	cmd.Flags().DurationVar(&o.BuildTimeout, "build-timeout", 0, "Set maximum time to build and push each image (0 means no limit)")
+	cmd.Flags().BoolVar(&o.SkipUnchangedBuilds, "skip-unchanged-builds", false, "Reuse previously pushed images when source contents and build options are unchanged (requires image destination)")
+	cmd.Flags().BoolVar(&o.PushDaemonless, "push-daemonless", false, "Push images built by pack, ko or bazel by exporting them from Docker daemon and pushing with registry client instead of 'docker push' (exported layers are recompressed so image digests differ from 'docker push')")
 	return cmd
 }
 
@@ -66,10 +89,17 @@ func (o *ResolveOptions) Run() error {
 	if o.ImgpkgLockOutput != "" && o.LockOutput != "" {
 		return fmt.Errorf("Can only output one lockfile type, please provide only one of '--lock-output' or '--imgpkg-lock-output'")
 	}
-	logger := ctllog.NewLogger(os.Stderr)
+	logFormat, err := ctllog.NewFormat(o.LogFormat)
+	if err != nil {
+		return err
+	}
+	logger := ctllog.NewLoggerWithFormat(os.Stderr, logFormat)
 	prefixedLogger := logger.NewPrefixedWriter("resolve | ")
 
-	resBss, err := o.ResolveResources(&logger, prefixedLogger)
+	ctx, cancel := newInterruptibleContext()
+	defer cancel()
+
+	resBss, err := o.ResolveResources(ctx, &logger, prefixedLogger)
 	if err != nil {
 		return err
 	}
@@ -83,7 +113,7 @@ func (o *ResolveOptions) Run() error {
 	return nil
 }
 
-func (o *ResolveOptions) ResolveResources(logger *ctllog.Logger, pLogger *ctllog.PrefixWriter) ([][]byte, error) {
+func (o *ResolveOptions) ResolveResources(ctx context.Context, logger *ctllog.Logger, pLogger *ctllog.PrefixWriter) ([][]byte, error) {
 	nonConfigRs, conf, err := o.FileFlags.ResourcesAndConfig()
 	if err != nil {
 		return nil, err
@@ -94,14 +124,23 @@ func (o *ResolveOptions) ResolveResources(logger *ctllog.Logger, pLogger *ctllog
 		return nil, err
 	}
 
-	registry, err := ctlreg.NewRegistry(o.RegistryFlags.AsRegistryOpts())
+	registryOpts, err := o.RegistryFlags.AsRegistryOptsWithConf(conf, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	registry, err := ctlreg.NewRegistry(registryOpts)
 	if err != nil {
 		return nil, err
 	}
 
 	opts := ctlimg.FactoryOpts{
-		Conf:           conf,
-		AllowedToBuild: o.AllowedToBuild,
+		Conf:                conf,
+		AllowedToBuild:      o.AllowedToBuild,
+		ResolveTimeout:      o.ResolveTimeout,
+		BuildTimeout:        o.BuildTimeout,
+		SkipUnchangedBuilds: o.SkipUnchangedBuilds,
+		PushDaemonless:      o.PushDaemonless,
 	}
 	if len(o.Platform) > 0 {
 		opts.GlobalPlatformSelection, err = NewPlatformSelection(o.Platform)
@@ -109,6 +148,10 @@ func (o *ResolveOptions) ResolveResources(logger *ctllog.Logger, pLogger *ctllog
 			return nil, err
 		}
 	}
+	opts.ResolveCache, err = o.resolveCache()
+	if err != nil {
+		return nil, err
+	}
 	imgFactory := ctlimg.NewFactory(opts, registry, *logger)
 
 	imageURLs, err := o.collectImageReferences(nonConfigRs, conf)
@@ -125,7 +168,11 @@ func (o *ResolveOptions) ResolveResources(logger *ctllog.Logger, pLogger *ctllog
 		return nil, nil
 	}
 
-	resolvedImages, err := o.resolveImages(imageURLs, imgFactory)
+	if o.Plan {
+		return nil, o.printPlan(nonConfigRs, conf, imageURLs, imgFactory)
+	}
+
+	resolvedImages, err := o.resolveImages(ctx, imageURLs, imgFactory, *logger)
 	if err != nil {
 		return nil, err
 	}
@@ -133,6 +180,7 @@ func (o *ResolveOptions) ResolveResources(logger *ctllog.Logger, pLogger *ctllog
 	// Record final image transformation
 	for _, pair := range resolvedImages.All() {
 		pLogger.WriteStr("final: %s -> %s\n", pair.UnprocessedImageURL.URL, pair.Image.URL)
+		logger.Event(ctllog.Event{Type: ctllog.EventFinalMapping, Image: pair.UnprocessedImageURL.URL, URL: pair.Image.URL})
 	}
 
 	err = o.emitLockOutput(conf, resolvedImages)
@@ -153,21 +201,26 @@ func (o *ResolveOptions) collectImageReferences(nonConfigRs []ctlres.Resource,
 	imageURLs := NewUnprocessedImageURLs()
 
 	for _, res := range nonConfigRs {
-		imageRefs := ctlser.NewImageRefs(res.DeepCopyRaw(), conf.SearchRules())
+		imageRefs := ctlser.NewImageRefs(res.DeepCopyRaw(), conf.SearchRulesForResource(res))
 
-		imageRefs.Visit(func(imgURL string) (string, bool) {
+		err := imageRefs.Visit(func(imgURL string) (string, bool) {
 			imageURLs.Add(UnprocessedImageURL{imgURL})
 			return "", false
 		})
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	return imageURLs, nil
 }
 
-func (o *ResolveOptions) resolveImages(imageURLs *UnprocessedImageURLs, imgFactory ctlimg.Factory) (*ProcessedImages, error) {
-	queue := NewImageQueue(imgFactory)
+func (o *ResolveOptions) resolveImages(ctx context.Context, imageURLs *UnprocessedImageURLs,
+	imgFactory ctlimg.Factory, logger ctllog.Logger) (*ProcessedImages, error) {
+
+	queue := NewImageQueue(imgFactory, logger)
 
-	resolvedImages, err := queue.Run(imageURLs, o.BuildConcurrency)
+	resolvedImages, err := queue.Run(ctx, imageURLs, o.BuildConcurrency)
 	if err != nil {
 		return nil, err
 	}
@@ -185,9 +238,9 @@ func (o *ResolveOptions) updateRefsInResources(nonConfigRs []ctlres.Resource,
 	for _, res := range nonConfigRs {
 		resContents := res.DeepCopyRaw()
 		images := []Image{}
-		imageRefs := ctlser.NewImageRefs(resContents, conf.SearchRules())
+		imageRefs := ctlser.NewImageRefs(resContents, conf.SearchRulesForResource(res))
 
-		imageRefs.Visit(func(imgURL string) (string, bool) {
+		err := imageRefs.Visit(func(imgURL string) (string, bool) {
 			img, found := resolvedImages.FindByURL(UnprocessedImageURL{imgURL})
 			if !found {
 				errs = append(errs, fmt.Errorf("Expected to find image for '%s'", imgURL))
@@ -200,6 +253,9 @@ func (o *ResolveOptions) updateRefsInResources(nonConfigRs []ctlres.Resource,
 
 			return img.URL, true
 		})
+		if err != nil {
+			return nil, err
+		}
 
 		resBs, err := NewResourceWithImages(resContents, images).Bytes()
 		if err != nil {
@@ -217,6 +273,26 @@ func (o *ResolveOptions) updateRefsInResources(nonConfigRs []ctlres.Resource,
 	return resBss, nil
 }
 
+func (o *ResolveOptions) resolveCache() (*ctlimg.ResolveCache, error) {
+	if len(o.ResolveCacheDir) == 0 {
+		if len(o.ResolveCacheInvalidate) > 0 {
+			return nil, fmt.Errorf("Expected '--resolve-cache-dir' to be specified when using '--resolve-cache-invalidate'")
+		}
+		return nil, nil
+	}
+
+	cache := ctlimg.NewResolveCache(o.ResolveCacheDir, o.ResolveCacheTTL)
+
+	for _, registry := range o.ResolveCacheInvalidate {
+		err := cache.InvalidateRegistry(registry)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return cache, nil
+}
+
 func errFromErrs(errs []error) error {
 	if len(errs) == 0 {
 		return nil
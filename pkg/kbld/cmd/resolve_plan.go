@@ -0,0 +1,162 @@
+// Copyright 2024 The Carvel Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	ctlconf "carvel.dev/kbld/pkg/kbld/config"
+	ctlimg "carvel.dev/kbld/pkg/kbld/image"
+	ctlres "carvel.dev/kbld/pkg/kbld/resources"
+	ctlser "carvel.dev/kbld/pkg/kbld/search"
+	uitable "github.com/cppforlife/go-cli-ui/ui/table"
+)
+
+type plannedImage struct {
+	URL         string
+	Plan        ctlimg.ImagePlan
+	SearchRules []string
+	Resources   []string
+}
+
+// printPlan shows what would happen to each found image reference
+// without building, pushing or resolving anything
+func (o *ResolveOptions) printPlan(nonConfigRs []ctlres.Resource,
+	conf ctlconf.Conf, imageURLs *UnprocessedImageURLs, imgFactory ctlimg.Factory) error {
+
+	plannedImgs := map[string]*plannedImage{}
+
+	for _, imageURL := range imageURLs.All() {
+		plannedImgs[imageURL.URL] = &plannedImage{
+			URL:  imageURL.URL,
+			Plan: imgFactory.Plan(imageURL.URL),
+		}
+	}
+
+	for _, res := range nonConfigRs {
+		rules := conf.SearchRulesForResource(res)
+
+		// Attribute each image to the first rule that finds it,
+		// same as search rules matcher does
+		foundBy := map[string]ctlconf.SearchRule{}
+
+		for _, rule := range rules {
+			err := ctlser.NewImageRefs(res.DeepCopyRaw(), []ctlconf.SearchRule{rule}).Visit(func(imgURL string) (string, bool) {
+				if _, found := foundBy[imgURL]; !found {
+					foundBy[imgURL] = rule
+				}
+				return "", false
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		for imgURL, rule := range foundBy {
+			plannedImg, found := plannedImgs[imgURL]
+			if !found {
+				continue
+			}
+
+			ruleDesc, err := o.searchRuleDescription(rule)
+			if err != nil {
+				return err
+			}
+
+			plannedImg.SearchRules = appendUniqueStr(plannedImg.SearchRules, ruleDesc)
+			plannedImg.Resources = appendUniqueStr(plannedImg.Resources, res.Description())
+		}
+	}
+
+	table := uitable.Table{
+		Title:   "Plan",
+		Content: "images",
+
+		Header: []uitable.Header{
+			uitable.NewHeader("Image"),
+			uitable.NewHeader("Action"),
+			uitable.NewHeader("Override"),
+			uitable.NewHeader("Source"),
+			uitable.NewHeader("Destination"),
+			uitable.NewHeader("Search rules"),
+			uitable.NewHeader("Resources"),
+		},
+
+		SortBy: []uitable.ColumnSort{
+			{Column: 0, Asc: true},
+		},
+
+		// Image URLs and other content is too long
+		FillFirstColumn: true,
+		Transpose:       true,
+	}
+
+	for _, imageURL := range imageURLs.All() {
+		plannedImg := plannedImgs[imageURL.URL]
+
+		table.Rows = append(table.Rows, []uitable.Value{
+			uitable.NewValueString(plannedImg.URL),
+			uitable.NewValueString(string(plannedImg.Plan.Action)),
+			uitable.NewValueString(o.planOverrideDescription(plannedImg.Plan)),
+			uitable.NewValueString(o.planSourceDescription(plannedImg.Plan)),
+			uitable.NewValueString(o.planDestinationDescription(plannedImg.Plan)),
+			uitable.NewValueStrings(plannedImg.SearchRules),
+			uitable.NewValueStrings(plannedImg.Resources),
+		})
+	}
+
+	o.ui.PrintTable(table)
+
+	return nil
+}
+
+func (o *ResolveOptions) planOverrideDescription(plan ctlimg.ImagePlan) string {
+	if plan.Override == nil {
+		return ""
+	}
+	desc := plan.URL
+	if plan.Override.Preresolved {
+		desc += " (preresolved)"
+	}
+	if plan.Override.TagSelection != nil {
+		desc += " (tag selection)"
+	}
+	return desc
+}
+
+func (o *ResolveOptions) planSourceDescription(plan ctlimg.ImagePlan) string {
+	if plan.Source == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s (%s)", plan.Source.Path, plan.BuilderName())
+}
+
+func (o *ResolveOptions) planDestinationDescription(plan ctlimg.ImagePlan) string {
+	if plan.Destination == nil {
+		return ""
+	}
+	if len(plan.Destination.Tags) > 0 {
+		return fmt.Sprintf("%s (tags: %s)", plan.Destination.NewImage, strings.Join(plan.Destination.Tags, ", "))
+	}
+	return plan.Destination.NewImage
+}
+
+func (o *ResolveOptions) searchRuleDescription(rule ctlconf.SearchRule) (string, error) {
+	bs, err := json.Marshal(rule)
+	if err != nil {
+		return "", fmt.Errorf("Marshaling search rule: %s", err)
+	}
+	return string(bs), nil
+}
+
+func appendUniqueStr(strs []string, str string) []string {
+	for _, s := range strs {
+		if s == str {
+			return strs
+		}
+	}
+	return append(strs, str)
+}
@@ -4,6 +4,7 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
@@ -20,10 +21,10 @@ type TarImageSet struct {
 	logger      *ctllog.PrefixWriter
 }
 
-func (o TarImageSet) Export(foundImages *UnprocessedImageURLs,
+func (o TarImageSet) Export(ctx context.Context, foundImages *UnprocessedImageURLs,
 	outputPath string, registry ctlreg.Registry) error {
 
-	ids, err := o.imageSet.Export(foundImages, registry)
+	ids, err := o.imageSet.Export(ctx, foundImages, registry)
 	if err != nil {
 		return err
 	}
@@ -49,7 +50,7 @@ func (o TarImageSet) Export(foundImages *UnprocessedImageURLs,
 	return imagetar.NewTarWriter(ids, outputFileOpener, opts, o.logger).Write()
 }
 
-func (o *TarImageSet) Import(path string,
+func (o *TarImageSet) Import(ctx context.Context, path string,
 	importRepo regname.Repository, registry ctlreg.Registry) (*ProcessedImages, error) {
 
 	imgOrIndexes, err := imagetar.NewTarReader(path).Read()
@@ -57,5 +58,5 @@ func (o *TarImageSet) Import(path string,
 		return nil, err
 	}
 
-	return o.imageSet.Import(imgOrIndexes, importRepo, registry)
+	return o.imageSet.Import(ctx, imgOrIndexes, importRepo, registry)
 }
@@ -83,15 +83,23 @@ func (o *UnpackageOptions) Run() error {
 		return fmt.Errorf("Building import repository ref: %s", err)
 	}
 
-	registry, err := ctlreg.NewRegistry(o.RegistryFlags.AsRegistryOpts())
+	registryOpts, err := o.RegistryFlags.AsRegistryOpts(&logger)
 	if err != nil {
 		return err
 	}
 
+	registry, err := ctlreg.NewRegistry(registryOpts)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := newInterruptibleContext()
+	defer cancel()
+
 	imageSet := TarImageSet{ImageSet{o.Concurrency, prefixedLogger}, o.Concurrency, prefixedLogger}
 
 	// Import images used in the manifests
-	importedImages, err := imageSet.Import(o.InputPath, importRepo, registry)
+	importedImages, err := imageSet.Import(ctx, o.InputPath, importRepo, registry)
 	if err != nil {
 		return err
 	}
@@ -125,9 +133,9 @@ func (o *UnpackageOptions) updateRefsInResources(
 
 	for _, res := range nonConfigRs {
 		resContents := res.DeepCopyRaw()
-		imageRefs := ctlser.NewImageRefs(resContents, conf.SearchRules())
+		imageRefs := ctlser.NewImageRefs(resContents, conf.SearchRulesForResource(res))
 
-		imageRefs.Visit(func(imgURL string) (string, bool) {
+		err := imageRefs.Visit(func(imgURL string) (string, bool) {
 			outputImg, found := resolvedImages.FindByURL(UnprocessedImageURL{imgURL})
 			if found {
 				return outputImg.URL, true
@@ -135,6 +143,9 @@ func (o *UnpackageOptions) updateRefsInResources(
 			missingImageErrs = append(missingImageErrs, fmt.Errorf("Expected to find image for '%s'", imgURL))
 			return "", false
 		})
+		if err != nil {
+			return nil, err
+		}
 
 		resBs, err := yaml.Marshal(resContents)
 		if err != nil {
@@ -79,6 +79,26 @@ func (c Conf) ImageDestinations() []ImageDestination {
 	return result
 }
 
+func (c Conf) RegistryMirrors() []RegistryMirror {
+	var result []RegistryMirror
+	for _, config := range c.configs {
+		result = append(result, config.Mirrors...)
+	}
+	return result
+}
+
+// CredHelpers returns credential helpers by registry
+// (later configs take precedence for the same registry)
+func (c Conf) CredHelpers() map[string]string {
+	result := map[string]string{}
+	for _, config := range c.configs {
+		for registry, helper := range config.CredHelpers {
+			result[registry] = helper
+		}
+	}
+	return result
+}
+
 func (c Conf) SearchRules() []SearchRule {
 	result := append([]SearchRule{}, c.SearchRulesWithoutDefaults()...)
 
@@ -91,6 +111,37 @@ func (c Conf) SearchRules() []SearchRule {
 	return c.dedupSearchRules(result)
 }
 
+// SearchRulesForResource returns search rules (including ones
+// nested within update strategies) that apply to given resource
+func (c Conf) SearchRulesForResource(res ctlres.Resource) []SearchRule {
+	return c.filterSearchRulesForResource(c.SearchRules(), res)
+}
+
+func (c Conf) filterSearchRulesForResource(rules []SearchRule, res ctlres.Resource) []SearchRule {
+	var result []SearchRule
+	for _, rule := range rules {
+		if !rule.MatchesResource(res) {
+			continue
+		}
+		if rule.UpdateStrategy != nil {
+			strategy := *rule.UpdateStrategy
+			if strategy.JSON != nil {
+				strategy.JSON = &SearchRuleUpdateStrategyJSON{
+					SearchRules: c.filterSearchRulesForResource(strategy.JSON.SearchRules, res),
+				}
+			}
+			if strategy.YAML != nil {
+				strategy.YAML = &SearchRuleUpdateStrategyYAML{
+					SearchRules: c.filterSearchRulesForResource(strategy.YAML.SearchRules, res),
+				}
+			}
+			rule.UpdateStrategy = &strategy
+		}
+		result = append(result, rule)
+	}
+	return result
+}
+
 func (c Conf) SearchRulesWithoutDefaults() []SearchRule {
 	result := []SearchRule{}
 	for _, config := range c.configs {
@@ -6,6 +6,9 @@ package config
 import (
 	"fmt"
 	"os"
+	"path"
+	"regexp"
+	"strconv"
 
 	"carvel.dev/imgpkg/pkg/imgpkg/lockconfig"
 	ctlres "carvel.dev/kbld/pkg/kbld/resources"
@@ -22,6 +25,7 @@ const (
 	imageOverridesKind    = "ImageOverrides"    // specify alternative image urls
 	imageDestinationsKind = "ImageDestinations" // specify image push destinations
 	imageKeysKind         = "ImageKeys"
+	registryMirrorsKind   = "RegistryMirrors" // specify registries to pull from instead of canonical ones
 )
 
 type Kind struct {
@@ -36,6 +40,7 @@ var (
 		{configAPIVersion, imageOverridesKind},
 		{configAPIVersion, imageDestinationsKind},
 		{configAPIVersion, imageKeysKind},
+		{configAPIVersion, registryMirrorsKind},
 	}
 )
 
@@ -50,17 +55,34 @@ type Config struct {
 	Destinations []ImageDestination `json:"destinations,omitempty"`
 	Keys         []string           `json:"keys,omitempty"`
 	SearchRules  []SearchRule       `json:"searchRules,omitempty"`
+	Mirrors      []RegistryMirror   `json:"mirrors,omitempty"`
+	// CredHelpers maps registry (e.g. gcr.io) to Docker credential helper
+	// name (e.g. gcloud for docker-credential-gcloud binary)
+	CredHelpers map[string]string `json:"credHelpers,omitempty"`
 }
 
 type Source struct {
 	ImageRef
 	Path string
 
+	// DependsOn lists images (typically built from other sources)
+	// that have to be resolved before this source is built
+	DependsOn []SourceDependency `json:"dependsOn,omitempty"`
+
 	Docker          *SourceDockerOpts
 	Pack            *SourcePackOpts
 	KubectlBuildkit *SourceKubectlBuildkitOpts
 	Ko              *SourceKoOpts
 	Bazel           *SourceBazelOpts
+	Buildah         *SourceBuildahOpts
+	Plugin          *SourcePluginOpts
+	Artifact        *SourceArtifactOpts
+}
+
+type SourceDependency struct {
+	Image string `json:"image"`
+	// BuildArg receives resolved image reference (e.g. used as FROM ${BASE_IMAGE})
+	BuildArg string `json:"buildArg"`
 }
 
 type ImageOverride struct {
@@ -89,23 +111,38 @@ type ImageDestination struct {
 	Tags     []string `json:"tags"`
 }
 
+type RegistryMirror struct {
+	// Registry (e.g. docker.io) which content is served by mirrors
+	Registry string `json:"registry"`
+	// Mirrors (e.g. mirror.example.com/dockerhub) are tried in order
+	Mirrors []string `json:"mirrors"`
+	// RewriteToMirror records resolved references against first mirror that serves content
+	RewriteToMirror bool `json:"rewriteToMirror,omitempty"`
+}
+
 type SearchRule struct {
 	KeyMatcher     *SearchRuleKeyMatcher     `json:"keyMatcher,omitempty"`
 	ValueMatcher   *SearchRuleValueMatcher   `json:"valueMatcher,omitempty"`
 	UpdateStrategy *SearchRuleUpdateStrategy `json:"updateStrategy,omitempty"`
-	// TODO ResourceMatchers (see kapp's matchers)
+	// Rule applies to all resources when no matchers are specified
+	ResourceMatchers ResourceMatchers `json:"resourceMatchers,omitempty"`
 }
 
 type SearchRuleKeyMatcher struct {
 	Name string      `json:"name,omitempty"`
 	Path ctlres.Path `json:"path,omitempty"`
-	// TODO JSONPath string
+	// JSONPath supports filters and recursive descent
+	// (e.g. spec.containers[?(@.name=="sidecar")].image, ..image)
+	JSONPath string `json:"jsonPath,omitempty"`
 }
 
 type SearchRuleValueMatcher struct {
 	Image     string `json:"image,omitempty"`
 	ImageRepo string `json:"imageRepo,omitempty"`
-	// TODO Regexp    string `json:"regexp,omitempty"`
+	// Regexp has to match entire value (e.g. registry\.example\.com/(.+))
+	Regexp string `json:"regexp,omitempty"`
+	// Glob follows path.Match syntax (e.g. *.example.com/team-*/*)
+	Glob string `json:"glob,omitempty"`
 }
 
 type SearchRuleUpdateStrategy struct {
@@ -113,6 +150,7 @@ type SearchRuleUpdateStrategy struct {
 	EntireString *SearchRuleUpdateStrategyEntireString `json:"entireValue,omitempty"`
 	JSON         *SearchRuleUpdateStrategyJSON         `json:"json,omitempty"`
 	YAML         *SearchRuleUpdateStrategyYAML         `json:"yaml,omitempty"`
+	Regexp       *SearchRuleUpdateStrategyRegexp       `json:"regexp,omitempty"`
 }
 
 type SearchRuleUpdateStrategyNone struct{}
@@ -127,6 +165,15 @@ type SearchRuleUpdateStrategyYAML struct {
 	SearchRules []SearchRule `json:"searchRules,omitempty"`
 }
 
+// SearchRuleUpdateStrategyRegexp only updates part of the value
+// captured by a regexp group (e.g. image within a command line flag)
+type SearchRuleUpdateStrategyRegexp struct {
+	// Defaults to value matcher's regexp
+	Regexp string `json:"regexp,omitempty"`
+	// Group name or index; defaults to first group
+	CaptureGroup string `json:"captureGroup,omitempty"`
+}
+
 type ImageRef struct {
 	Image     string `json:"image,omitempty"`
 	ImageRepo string `json:"imageRepo,omitempty"`
@@ -260,6 +307,22 @@ func (d Config) Validate() error {
 		}
 	}
 
+	for i, mirror := range d.Mirrors {
+		err := mirror.Validate()
+		if err != nil {
+			return fmt.Errorf("Validating Mirrors[%d]: %s", i, err)
+		}
+	}
+
+	for registry, helper := range d.CredHelpers {
+		if len(registry) == 0 {
+			return fmt.Errorf("Validating CredHelpers: Expected registry to be non-empty")
+		}
+		if len(helper) == 0 {
+			return fmt.Errorf("Validating CredHelpers[%s]: Expected helper to be non-empty", registry)
+		}
+	}
+
 	return nil
 }
 
@@ -271,9 +334,70 @@ func (d Source) Validate() error {
 	if len(d.Path) == 0 {
 		return fmt.Errorf("Expected Path to be non-empty")
 	}
+	for i, dep := range d.DependsOn {
+		if len(dep.Image) == 0 {
+			return fmt.Errorf("Expected DependsOn[%d].Image to be non-empty", i)
+		}
+		if len(dep.BuildArg) == 0 {
+			return fmt.Errorf("Expected DependsOn[%d].BuildArg to be non-empty", i)
+		}
+	}
+	if d.Plugin != nil && len(d.Plugin.Name) == 0 {
+		return fmt.Errorf("Expected Plugin.Name to be non-empty")
+	}
+	if d.Artifact != nil && len(d.Artifact.Path) == 0 {
+		return fmt.Errorf("Expected Artifact.Path to be non-empty")
+	}
+	if d.Pack != nil {
+		err := d.Pack.Build.Validate()
+		if err != nil {
+			return err
+		}
+	}
+	if d.Bazel != nil {
+		err := d.Bazel.Validate()
+		if err != nil {
+			return err
+		}
+	}
+	if d.Ko != nil {
+		err := d.Ko.Build.Validate()
+		if err != nil {
+			return err
+		}
+	}
+	if d.Docker != nil && d.Docker.Buildx != nil {
+		err := d.Docker.Buildx.Validate()
+		if err != nil {
+			return err
+		}
+	}
+	if inputs := d.BuildInputs(); inputs != nil {
+		err := inputs.Validate()
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// BuildInputs returns structured build inputs of
+// the builder that will be used (if it supports them)
+func (d Source) BuildInputs() *SourceBuildInputs {
+	switch {
+	case d.Pack != nil, d.Ko != nil, d.Bazel != nil, d.Buildah != nil, d.Plugin != nil, d.Artifact != nil:
+		return nil
+	case d.KubectlBuildkit != nil:
+		return &d.KubectlBuildkit.Build.SourceBuildInputs
+	case d.Docker != nil && d.Docker.Buildx != nil:
+		return &d.Docker.Buildx.SourceBuildInputs
+	case d.Docker != nil:
+		return &d.Docker.Build.SourceBuildInputs
+	default:
+		return nil
+	}
+}
+
 func (d ImageOverride) Validate() error {
 	err := d.ImageRef.Validate()
 	if err != nil {
@@ -285,6 +409,16 @@ func (d ImageOverride) Validate() error {
 	return nil
 }
 
+func (d RegistryMirror) Validate() error {
+	if len(d.Registry) == 0 {
+		return fmt.Errorf("Expected Registry to be non-empty")
+	}
+	if len(d.Mirrors) == 0 {
+		return fmt.Errorf("Expected Mirrors to be non-empty")
+	}
+	return nil
+}
+
 func (d ImageDestination) Validate() error {
 	return d.ImageRef.Validate()
 }
@@ -294,18 +428,120 @@ func (d SearchRule) Validate() error {
 		return fmt.Errorf("Expected KeyMatcher or ValueMatcher to be non-empty")
 	}
 	if d.KeyMatcher != nil {
-		if len(d.KeyMatcher.Name) == 0 && len(d.KeyMatcher.Path) == 0 {
-			return fmt.Errorf("Expected KeyMatcher.Name or KeyMatcher.Path to be non-empty")
+		if len(d.KeyMatcher.Name) == 0 && len(d.KeyMatcher.Path) == 0 && len(d.KeyMatcher.JSONPath) == 0 {
+			return fmt.Errorf("Expected KeyMatcher.Name, KeyMatcher.Path or KeyMatcher.JSONPath to be non-empty")
+		}
+		if len(d.KeyMatcher.JSONPath) > 0 {
+			_, err := ctlres.NewJSONPath(d.KeyMatcher.JSONPath)
+			if err != nil {
+				return fmt.Errorf("Parsing KeyMatcher.JSONPath: %s", err)
+			}
 		}
 	}
 	if d.ValueMatcher != nil {
-		if len(d.ValueMatcher.Image) == 0 && len(d.ValueMatcher.ImageRepo) == 0 {
-			return fmt.Errorf("Expected ValueMatcher.Image or ValueMatcher.ImageRepo to be non-empty")
+		err := d.ValueMatcher.Validate()
+		if err != nil {
+			return err
+		}
+	}
+	if len(d.ResourceMatchers) > 0 {
+		_, err := d.ResourceMatchers.AsResourceMatcher()
+		if err != nil {
+			return err
+		}
+	}
+	if d.UpdateStrategy != nil && d.UpdateStrategy.Regexp != nil {
+		err := d.UpdateStrategyWithDefaults().Regexp.Validate()
+		if err != nil {
+			return err
+		}
+	}
+	// Nested rules are applied to decoded values hence have to be valid as well
+	if d.UpdateStrategy != nil && d.UpdateStrategy.JSON != nil {
+		for i, rule := range d.UpdateStrategy.JSON.SearchRules {
+			err := rule.Validate()
+			if err != nil {
+				return fmt.Errorf("Validating UpdateStrategy.JSON.SearchRules[%d]: %s", i, err)
+			}
+		}
+	}
+	if d.UpdateStrategy != nil && d.UpdateStrategy.YAML != nil {
+		for i, rule := range d.UpdateStrategy.YAML.SearchRules {
+			err := rule.Validate()
+			if err != nil {
+				return fmt.Errorf("Validating UpdateStrategy.YAML.SearchRules[%d]: %s", i, err)
+			}
 		}
 	}
 	return nil
 }
 
+func (d SearchRuleValueMatcher) Validate() error {
+	var specified int
+	for _, val := range []string{d.Image, d.ImageRepo, d.Regexp, d.Glob} {
+		if len(val) > 0 {
+			specified++
+		}
+	}
+	if specified == 0 {
+		return fmt.Errorf("Expected ValueMatcher.Image, ValueMatcher.ImageRepo, ValueMatcher.Regexp or ValueMatcher.Glob to be non-empty")
+	}
+	if specified > 1 {
+		return fmt.Errorf("Expected only one of ValueMatcher.Image, ValueMatcher.ImageRepo, ValueMatcher.Regexp or ValueMatcher.Glob to be specified")
+	}
+	if len(d.Regexp) > 0 {
+		_, err := NewAnchoredRegexp(d.Regexp)
+		if err != nil {
+			return fmt.Errorf("Parsing ValueMatcher.Regexp: %s", err)
+		}
+	}
+	if len(d.Glob) > 0 {
+		_, err := path.Match(d.Glob, "")
+		if err != nil {
+			return fmt.Errorf("Parsing ValueMatcher.Glob: %s", err)
+		}
+	}
+	return nil
+}
+
+func (d SearchRuleUpdateStrategyRegexp) Validate() error {
+	if len(d.Regexp) == 0 {
+		return fmt.Errorf("Expected UpdateStrategy.Regexp.Regexp or ValueMatcher.Regexp to be non-empty")
+	}
+	re, err := NewAnchoredRegexp(d.Regexp)
+	if err != nil {
+		return fmt.Errorf("Parsing UpdateStrategy.Regexp.Regexp: %s", err)
+	}
+	_, err = d.CaptureGroupIndex(re)
+	return err
+}
+
+// CaptureGroupIndex returns index of the configured capture group within given regexp
+func (d SearchRuleUpdateStrategyRegexp) CaptureGroupIndex(re *regexp.Regexp) (int, error) {
+	if len(d.CaptureGroup) == 0 {
+		if re.NumSubexp() < 1 {
+			return 0, fmt.Errorf("Expected regexp '%s' to have at least one capture group", d.Regexp)
+		}
+		return 1, nil
+	}
+	if idx, err := strconv.Atoi(d.CaptureGroup); err == nil {
+		if idx < 1 || idx > re.NumSubexp() {
+			return 0, fmt.Errorf("Expected regexp '%s' to have capture group %d", d.Regexp, idx)
+		}
+		return idx, nil
+	}
+	idx := re.SubexpIndex(d.CaptureGroup)
+	if idx < 0 {
+		return 0, fmt.Errorf("Expected regexp '%s' to have capture group named '%s'", d.Regexp, d.CaptureGroup)
+	}
+	return idx, nil
+}
+
+// NewAnchoredRegexp compiles regexp that has to match entire value
+func NewAnchoredRegexp(str string) (*regexp.Regexp, error) {
+	return regexp.Compile(`\A(?:` + str + `)\z`)
+}
+
 func (r ImageRef) Validate() error {
 	if len(r.Image) == 0 && len(r.ImageRepo) == 0 {
 		return fmt.Errorf("Expected Image or ImageRepo to be non-empty")
@@ -362,9 +598,29 @@ func UniqueImageOverrides(overrides []ImageOverride) []ImageOverride {
 	return result
 }
 
+// MatchesResource checks whether rule applies to given resource
+func (d SearchRule) MatchesResource(res ctlres.Resource) bool {
+	if len(d.ResourceMatchers) == 0 {
+		return true
+	}
+	matcher, err := d.ResourceMatchers.AsResourceMatcher()
+	if err != nil {
+		// Resource matchers are validated when config is loaded
+		panic(fmt.Sprintf("Building search rule resource matcher: %s", err))
+	}
+	return matcher.Matches(res)
+}
+
 func (d SearchRule) UpdateStrategyWithDefaults() SearchRuleUpdateStrategy {
 	if d.UpdateStrategy != nil {
-		return *d.UpdateStrategy
+		strategy := *d.UpdateStrategy
+		if strategy.Regexp != nil && len(strategy.Regexp.Regexp) == 0 && d.ValueMatcher != nil {
+			// Make value matcher's capture groups available to update strategy
+			regexpStrategy := *strategy.Regexp
+			regexpStrategy.Regexp = d.ValueMatcher.Regexp
+			strategy.Regexp = &regexpStrategy
+		}
+		return strategy
 	}
 	return SearchRuleUpdateStrategy{
 		EntireString: &SearchRuleUpdateStrategyEntireString{},
@@ -0,0 +1,14 @@
+// Copyright 2024 The Carvel Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+// SourceArtifactOpts describes pre-built image (e.g. produced by apko
+// or nix dockerTools) that kbld pushes to image destination
+type SourceArtifactOpts struct {
+	// Command optionally produces artifact (executed via `sh -c` within source path)
+	Command *string
+	// Path to OCI image layout directory, OCI archive or
+	// `docker save` tarball (relative to source path)
+	Path string
+}
@@ -3,11 +3,35 @@
 
 package config
 
+import (
+	"fmt"
+)
+
 type SourceBazelOpts struct {
 	Run SourceBazelRunOpts
+	// Build uses `bazel build` to produce an OCI layout (e.g. via rules_oci)
+	// that is pushed to image destination without Docker daemon
+	Build *SourceBazelBuildOpts
 }
 
 type SourceBazelRunOpts struct {
 	Target     *string   `json:"target"`
 	RawOptions *[]string `json:"rawOptions"`
 }
+
+type SourceBazelBuildOpts struct {
+	Target     *string   `json:"target"`
+	RawOptions *[]string `json:"rawOptions"`
+}
+
+func (d SourceBazelOpts) Validate() error {
+	if d.Build != nil {
+		if d.Run.Target != nil {
+			return fmt.Errorf("Expected only one of Bazel.Run or Bazel.Build to be specified")
+		}
+		if d.Build.Target == nil || len(*d.Build.Target) == 0 {
+			return fmt.Errorf("Expected Bazel.Build.Target to be non-empty")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+// Copyright 2024 The Carvel Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"fmt"
+)
+
+// SourceBuildInputs are structured alternatives to passing
+// --build-arg, --secret, --ssh and --label via raw options
+type SourceBuildInputs struct {
+	BuildArgs []SourceBuildArg    `json:"buildArgs,omitempty"`
+	Secrets   []SourceBuildSecret `json:"secrets,omitempty"`
+	SSH       []SourceBuildSSH    `json:"ssh,omitempty"`
+	Labels    map[string]string   `json:"labels,omitempty"`
+}
+
+type SourceBuildArg struct {
+	Name  string
+	Value *string
+	// ValueFromEnv takes value from environment variable
+	ValueFromEnv *string `json:"valueFromEnv"`
+	// ValueFromFile takes value from file contents
+	// (relative paths are relative to source path)
+	ValueFromFile *string `json:"valueFromFile"`
+}
+
+type SourceBuildSecret struct {
+	ID string
+	// Env specifies environment variable holding secret value
+	Env *string
+	// Src specifies file holding secret value
+	// (relative paths are relative to source path)
+	Src *string
+}
+
+type SourceBuildSSH struct {
+	// ID defaults to 'default'
+	ID string
+	// Paths to SSH agent socket or keys (defaults to SSH_AUTH_SOCK)
+	Paths []string
+}
+
+func (d SourceBuildInputs) Validate() error {
+	for i, arg := range d.BuildArgs {
+		if len(arg.Name) == 0 {
+			return fmt.Errorf("Expected BuildArgs[%d].Name to be non-empty", i)
+		}
+		if countSet(arg.Value != nil, arg.ValueFromEnv != nil, arg.ValueFromFile != nil) != 1 {
+			return fmt.Errorf("Expected BuildArgs[%d] to specify exactly one of value, valueFromEnv or valueFromFile", i)
+		}
+	}
+	for i, secret := range d.Secrets {
+		if len(secret.ID) == 0 {
+			return fmt.Errorf("Expected Secrets[%d].ID to be non-empty", i)
+		}
+		if countSet(secret.Env != nil, secret.Src != nil) != 1 {
+			return fmt.Errorf("Expected Secrets[%d] to specify exactly one of env or src", i)
+		}
+	}
+	return nil
+}
+
+func countSet(vals ...bool) int {
+	var count int
+	for _, val := range vals {
+		if val {
+			count++
+		}
+	}
+	return count
+}
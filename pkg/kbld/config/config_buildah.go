@@ -0,0 +1,28 @@
+// Copyright 2024 The Carvel Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+type SourceBuildahOpts struct {
+	// Command allows to use podman instead of buildah
+	// since both accept the same build and push flags (default: buildah)
+	Command *string
+	Build   SourceBuildahBuildOpts
+	Push    SourceBuildahPushOpts
+}
+
+type SourceBuildahBuildOpts struct {
+	Target     *string
+	Platform   *string
+	Pull       *bool
+	NoCache    *bool `json:"noCache"`
+	File       *string
+	RawOptions *[]string `json:"rawOptions"`
+}
+
+type SourceBuildahPushOpts struct {
+	// OCIArchive exports built image into an OCI layout
+	// and pushes it via kbld instead of using buildah push
+	OCIArchive *bool     `json:"ociArchive"`
+	RawOptions *[]string `json:"rawOptions"`
+}
@@ -3,6 +3,10 @@
 
 package config
 
+import (
+	"fmt"
+)
+
 type SourceDockerOpts struct {
 	Build  SourceDockerBuildOpts
 	Buildx *SourceDockerBuildxOpts
@@ -15,6 +19,8 @@ type SourceDockerBuildOpts struct {
 	File       *string
 	Buildkit   *bool
 	RawOptions *[]string `json:"rawOptions"`
+
+	SourceBuildInputs
 }
 
 type SourceDockerBuildxOpts struct {
@@ -23,4 +29,68 @@ type SourceDockerBuildxOpts struct {
 	NoCache    *bool `json:"noCache"`
 	File       *string
 	RawOptions *[]string `json:"rawOptions"`
+
+	// Platforms (e.g. linux/amd64) to build for;
+	// multiple platforms require image destination
+	Platforms []string                  `json:"platforms,omitempty"`
+	CacheFrom []SourceDockerBuildxCache `json:"cacheFrom,omitempty"`
+	CacheTo   []SourceDockerBuildxCache `json:"cacheTo,omitempty"`
+
+	// Provenance and SBOM toggle attestations attached to pushed image
+	Provenance *bool
+	SBOM       *bool `json:"sbom"`
+
+	SourceBuildInputs
+}
+
+const (
+	SourceDockerBuildxCacheRegistry = "registry"
+	SourceDockerBuildxCacheLocal    = "local"
+	SourceDockerBuildxCacheGHA      = "gha"
+)
+
+type SourceDockerBuildxCache struct {
+	// Type is one of registry, local or gha
+	Type string
+	// Ref is a registry cache image reference
+	Ref string
+	// Path is a local cache directory
+	Path string
+	// Scope is an optional GitHub Actions cache scope
+	Scope string
+	// Mode (min or max) is only used when exporting cache
+	Mode string
+}
+
+func (d SourceDockerBuildxOpts) Validate() error {
+	for i, cache := range d.CacheFrom {
+		err := cache.Validate()
+		if err != nil {
+			return fmt.Errorf("Validating CacheFrom[%d]: %s", i, err)
+		}
+	}
+	for i, cache := range d.CacheTo {
+		err := cache.Validate()
+		if err != nil {
+			return fmt.Errorf("Validating CacheTo[%d]: %s", i, err)
+		}
+	}
+	return nil
+}
+
+func (d SourceDockerBuildxCache) Validate() error {
+	switch d.Type {
+	case SourceDockerBuildxCacheRegistry:
+		if len(d.Ref) == 0 {
+			return fmt.Errorf("Expected Ref to be non-empty for registry cache")
+		}
+	case SourceDockerBuildxCacheLocal:
+		if len(d.Path) == 0 {
+			return fmt.Errorf("Expected Path to be non-empty for local cache")
+		}
+	case SourceDockerBuildxCacheGHA:
+	default:
+		return fmt.Errorf("Expected Type to be one of registry, local or gha, but was '%s'", d.Type)
+	}
+	return nil
 }
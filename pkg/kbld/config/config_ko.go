@@ -3,10 +3,76 @@
 
 package config
 
+import (
+	"fmt"
+	"strings"
+)
+
 type SourceKoOpts struct {
 	Build SourceKoBuildOpts
 }
 
 type SourceKoBuildOpts struct {
+	// Platforms (e.g. linux/amd64 or all) to build for;
+	// multiple platforms require Push to be enabled
+	Platforms []string `json:"platforms,omitempty"`
+	// BaseImage overrides ko's default base image
+	BaseImage *string  `json:"baseImage,omitempty"`
+	Ldflags   []string `json:"ldflags,omitempty"`
+	// Tags applied to image when it's pushed by ko
+	Tags []string `json:"tags,omitempty"`
+
+	// Bare and PreserveImportPaths control how ko names images
+	Bare                *bool `json:"bare,omitempty"`
+	PreserveImportPaths *bool `json:"preserveImportPaths,omitempty"`
+
+	// SBOM is one of spdx, cyclonedx, go.version-m or none
+	SBOM *string `json:"sbom,omitempty"`
+
+	// Push makes ko push image directly to image destination
+	// (via KO_DOCKER_REPO) instead of loading it into Docker daemon
+	Push *bool `json:"push,omitempty"`
+
 	RawOptions *[]string `json:"rawOptions"`
 }
+
+func (d SourceKoBuildOpts) Validate() error {
+	if d.Bare != nil && *d.Bare && d.PreserveImportPaths != nil && *d.PreserveImportPaths {
+		return fmt.Errorf("Expected only one of Ko.Build.Bare or Ko.Build.PreserveImportPaths to be enabled")
+	}
+	if d.PushEnabled() && d.PreserveImportPaths != nil && *d.PreserveImportPaths {
+		return fmt.Errorf("Expected Ko.Build.PreserveImportPaths to not be enabled when pushing to image destination")
+	}
+	if d.MultiPlatform() && !d.PushEnabled() {
+		return fmt.Errorf("Expected Ko.Build.Push to be enabled when building for multiple platforms")
+	}
+	// Ldflags are passed via GOFLAGS which only supports
+	// quoting values with either single or double quotes
+	for _, ldflag := range d.Ldflags {
+		if strings.Contains(ldflag, "'") && strings.Contains(ldflag, `"`) {
+			return fmt.Errorf("Expected Ko.Build.Ldflags to not contain both single and double quotes, but was '%s'", ldflag)
+		}
+	}
+	if d.SBOM != nil {
+		switch *d.SBOM {
+		case "spdx", "cyclonedx", "go.version-m", "none":
+		default:
+			return fmt.Errorf("Expected Ko.Build.SBOM to be one of spdx, cyclonedx, go.version-m or none, but was '%s'", *d.SBOM)
+		}
+	}
+	return nil
+}
+
+func (d SourceKoBuildOpts) PushEnabled() bool {
+	return d.Push != nil && *d.Push
+}
+
+// MultiPlatform returns true if resulting image is going to be an image index
+func (d SourceKoBuildOpts) MultiPlatform() bool {
+	for _, platform := range d.Platforms {
+		if platform == "all" {
+			return true
+		}
+	}
+	return len(d.Platforms) > 1
+}
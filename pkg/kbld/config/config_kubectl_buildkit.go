@@ -14,4 +14,6 @@ type SourceKubectlBuildkitBuildOpts struct {
 	NoCache    *bool `json:"noCache"`
 	File       *string
 	RawOptions *[]string `json:"rawOptions"`
+
+	SourceBuildInputs
 }
@@ -3,6 +3,10 @@
 
 package config
 
+import (
+	"fmt"
+)
+
 type SourcePackOpts struct {
 	Build SourcePackBuildOpts
 }
@@ -10,6 +14,37 @@ type SourcePackOpts struct {
 type SourcePackBuildOpts struct {
 	Builder    *string
 	Buildpacks *[]string
-	ClearCache *bool     `json:"clearCache"`
+	ClearCache *bool `json:"clearCache"`
+
+	// Env is provided to buildpacks during build
+	Env        map[string]string `json:"env,omitempty"`
+	RunImage   *string           `json:"runImage"`
+	PullPolicy *string           `json:"pullPolicy"`
+	Network    *string
+	// CacheImage stores build cache in a registry (requires Publish)
+	CacheImage *string `json:"cacheImage"`
+
+	// Publish makes pack write image directly to image destination
+	// instead of exporting it to Docker daemon
+	Publish *bool
+
 	RawOptions *[]string `json:"rawOptions"`
 }
+
+func (d SourcePackBuildOpts) Validate() error {
+	if d.PullPolicy != nil {
+		switch *d.PullPolicy {
+		case "always", "never", "if-not-present":
+		default:
+			return fmt.Errorf("Expected Pack.Build.PullPolicy to be one of always, never or if-not-present, but was '%s'", *d.PullPolicy)
+		}
+	}
+	if d.CacheImage != nil && !d.PublishEnabled() {
+		return fmt.Errorf("Expected Pack.Build.Publish to be enabled when Pack.Build.CacheImage is specified")
+	}
+	return nil
+}
+
+func (d SourcePackBuildOpts) PublishEnabled() bool {
+	return d.Publish != nil && *d.Publish
+}
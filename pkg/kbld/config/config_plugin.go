@@ -0,0 +1,12 @@
+// Copyright 2024 The Carvel Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+type SourcePluginOpts struct {
+	// Name of the builder plugin; kbld executes
+	// kbld-builder-<name> executable found on PATH
+	Name string
+	// Options are passed to the plugin as is
+	Options map[string]interface{} `json:"options,omitempty"`
+}
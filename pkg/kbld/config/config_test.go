@@ -0,0 +1,410 @@
+// Copyright 2024 The Carvel Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package config_test
+
+import (
+	"testing"
+
+	ctlconf "carvel.dev/kbld/pkg/kbld/config"
+	ctlres "carvel.dev/kbld/pkg/kbld/resources"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearchRuleValidate(t *testing.T) {
+	exs := []struct {
+		Description string
+		Rule        ctlconf.SearchRule
+		Error       string
+	}{
+		{
+			Description: "valid regexp",
+			Rule: ctlconf.SearchRule{
+				ValueMatcher: &ctlconf.SearchRuleValueMatcher{Regexp: `gcr\.io/.+`},
+			},
+		},
+		{
+			Description: "invalid regexp",
+			Rule: ctlconf.SearchRule{
+				ValueMatcher: &ctlconf.SearchRuleValueMatcher{Regexp: `gcr\.io/(.+`},
+			},
+			Error: "Parsing ValueMatcher.Regexp: error parsing regexp: missing closing ): `\\A(?:gcr\\.io/(.+)\\z`",
+		},
+		{
+			Description: "invalid glob",
+			Rule: ctlconf.SearchRule{
+				ValueMatcher: &ctlconf.SearchRuleValueMatcher{Glob: "gcr.io/[a-"},
+			},
+			Error: "Parsing ValueMatcher.Glob: syntax error in pattern",
+		},
+		{
+			Description: "multiple value matchers",
+			Rule: ctlconf.SearchRule{
+				ValueMatcher: &ctlconf.SearchRuleValueMatcher{Image: "nginx", Glob: "*"},
+			},
+			Error: "Expected only one of ValueMatcher.Image, ValueMatcher.ImageRepo, ValueMatcher.Regexp or ValueMatcher.Glob to be specified",
+		},
+		{
+			Description: "capture group from value matcher",
+			Rule: ctlconf.SearchRule{
+				ValueMatcher: &ctlconf.SearchRuleValueMatcher{Regexp: `--image=(?P<img>.+)`},
+				UpdateStrategy: &ctlconf.SearchRuleUpdateStrategy{
+					Regexp: &ctlconf.SearchRuleUpdateStrategyRegexp{CaptureGroup: "img"},
+				},
+			},
+		},
+		{
+			Description: "missing capture group",
+			Rule: ctlconf.SearchRule{
+				ValueMatcher: &ctlconf.SearchRuleValueMatcher{Regexp: `--image=(.+)`},
+				UpdateStrategy: &ctlconf.SearchRuleUpdateStrategy{
+					Regexp: &ctlconf.SearchRuleUpdateStrategyRegexp{CaptureGroup: "img"},
+				},
+			},
+			Error: "Expected regexp '--image=(.+)' to have capture group named 'img'",
+		},
+		{
+			Description: "invalid JSONPath key matcher",
+			Rule: ctlconf.SearchRule{
+				KeyMatcher: &ctlconf.SearchRuleKeyMatcher{JSONPath: "spec.containers[0"},
+			},
+			Error: "Parsing KeyMatcher.JSONPath: Parsing JSONPath 'spec.containers[0': Expected closing bracket for '[' at position 15",
+		},
+		{
+			Description: "regexp update strategy without regexp",
+			Rule: ctlconf.SearchRule{
+				KeyMatcher: &ctlconf.SearchRuleKeyMatcher{Name: "args"},
+				UpdateStrategy: &ctlconf.SearchRuleUpdateStrategy{
+					Regexp: &ctlconf.SearchRuleUpdateStrategyRegexp{},
+				},
+			},
+			Error: "Expected UpdateStrategy.Regexp.Regexp or ValueMatcher.Regexp to be non-empty",
+		},
+		{
+			Description: "invalid regexp in nested YAML rule",
+			Rule: ctlconf.SearchRule{
+				KeyMatcher: &ctlconf.SearchRuleKeyMatcher{Name: "config.yml"},
+				UpdateStrategy: &ctlconf.SearchRuleUpdateStrategy{
+					YAML: &ctlconf.SearchRuleUpdateStrategyYAML{
+						SearchRules: []ctlconf.SearchRule{{
+							ValueMatcher: &ctlconf.SearchRuleValueMatcher{Regexp: "(unclosed"},
+						}},
+					},
+				},
+			},
+			Error: "Validating UpdateStrategy.YAML.SearchRules[0]: Parsing ValueMatcher.Regexp: error parsing regexp: missing closing ): `\\A(?:(unclosed)\\z`",
+		},
+		{
+			Description: "invalid glob in nested JSON rule",
+			Rule: ctlconf.SearchRule{
+				KeyMatcher: &ctlconf.SearchRuleKeyMatcher{Name: "config.json"},
+				UpdateStrategy: &ctlconf.SearchRuleUpdateStrategy{
+					JSON: &ctlconf.SearchRuleUpdateStrategyJSON{
+						SearchRules: []ctlconf.SearchRule{{
+							ValueMatcher: &ctlconf.SearchRuleValueMatcher{Glob: "gcr.io/[a-"},
+						}},
+					},
+				},
+			},
+			Error: "Validating UpdateStrategy.JSON.SearchRules[0]: Parsing ValueMatcher.Glob: syntax error in pattern",
+		},
+		{
+			Description: "invalid JSONPath in nested YAML rule",
+			Rule: ctlconf.SearchRule{
+				KeyMatcher: &ctlconf.SearchRuleKeyMatcher{Name: "config.yml"},
+				UpdateStrategy: &ctlconf.SearchRuleUpdateStrategy{
+					YAML: &ctlconf.SearchRuleUpdateStrategyYAML{
+						SearchRules: []ctlconf.SearchRule{{
+							KeyMatcher: &ctlconf.SearchRuleKeyMatcher{JSONPath: "spec.containers[0"},
+						}},
+					},
+				},
+			},
+			Error: "Validating UpdateStrategy.YAML.SearchRules[0]: Parsing KeyMatcher.JSONPath: Parsing JSONPath 'spec.containers[0': Expected closing bracket for '[' at position 15",
+		},
+	}
+
+	for _, ex := range exs {
+		t.Run(ex.Description, func(t *testing.T) {
+			err := ex.Rule.Validate()
+			if len(ex.Error) == 0 {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, ex.Error)
+			}
+		})
+	}
+}
+
+func TestSearchRulesForResource(t *testing.T) {
+	rs, conf, err := ctlconf.NewConfFromResources([]ctlres.Resource{
+		ctlres.MustNewResourceFromBytes([]byte(`
+apiVersion: kbld.k14s.io/v1alpha1
+kind: Config
+searchRules:
+- keyMatcher:
+    name: sidecarImage
+  resourceMatchers:
+  - apiVersionKindMatcher:
+      apiVersion: example.com/v1
+      kind: App
+- keyMatcher:
+    name: image
+  resourceMatchers:
+  - allMatcher:
+      matchers:
+      - kindNamespaceNameMatcher:
+          kind: ConfigMap
+      - notMatcher:
+          matcher:
+            labelSelectorMatcher:
+              selector: kbld.carvel.dev/images=true
+  updateStrategy:
+    none: {}
+`)),
+	})
+	assert.NoError(t, err)
+	assert.Len(t, rs, 0)
+
+	exs := []struct {
+		Resource string
+		KeyNames []string
+	}{
+		{
+			Resource: "apiVersion: example.com/v1\nkind: App\nmetadata:\n  name: app",
+			KeyNames: []string{"sidecarImage", "image"},
+		},
+		{
+			Resource: "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: cm",
+			KeyNames: []string{"image", "image"},
+		},
+		{
+			Resource: "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: cm\n  labels:\n    kbld.carvel.dev/images: \"true\"",
+			KeyNames: []string{"image"},
+		},
+	}
+
+	for _, ex := range exs {
+		var keyNames []string
+		for _, rule := range conf.SearchRulesForResource(ctlres.MustNewResourceFromBytes([]byte(ex.Resource))) {
+			keyNames = append(keyNames, rule.KeyMatcher.Name)
+		}
+		assert.Equal(t, ex.KeyNames, keyNames, ex.Resource)
+	}
+}
+
+func TestSearchRuleValidateResourceMatchers(t *testing.T) {
+	rule := ctlconf.SearchRule{
+		KeyMatcher: &ctlconf.SearchRuleKeyMatcher{Name: "image"},
+		ResourceMatchers: ctlconf.ResourceMatchers{{
+			NotMatcher: &ctlconf.NotMatcher{
+				Matcher: ctlconf.ResourceMatcher{
+					LabelSelectorMatcher: &ctlconf.LabelSelectorMatcher{Selector: "app in (foo"},
+				},
+			},
+		}},
+	}
+	err := rule.Validate()
+	assert.ErrorContains(t, err, "ResourceMatchers[0]: NotMatcher: Parsing label selector: ")
+}
+
+func TestSearchRuleValidateNestedResourceMatchers(t *testing.T) {
+	_, _, err := ctlconf.NewConfFromResources([]ctlres.Resource{
+		ctlres.MustNewResourceFromBytes([]byte(`
+apiVersion: kbld.k14s.io/v1alpha1
+kind: Config
+searchRules:
+- keyMatcher:
+    name: config.yml
+  updateStrategy:
+    yaml:
+      searchRules:
+      - keyMatcher:
+          name: image
+        resourceMatchers:
+        - labelSelectorMatcher:
+            selector: "app in (foo"
+`)),
+	})
+	assert.ErrorContains(t, err, "Validating UpdateStrategy.YAML.SearchRules[0]: ResourceMatchers[0]: Parsing label selector: ")
+}
+
+func TestSourceValidateDependsOn(t *testing.T) {
+	src := ctlconf.Source{
+		ImageRef:  ctlconf.ImageRef{Image: "app"},
+		Path:      ".",
+		DependsOn: []ctlconf.SourceDependency{{Image: "base"}},
+	}
+	assert.EqualError(t, src.Validate(), "Expected DependsOn[0].BuildArg to be non-empty")
+
+	src.DependsOn[0].BuildArg = "BASE_IMAGE"
+	assert.NoError(t, src.Validate())
+}
+
+func TestSourceValidateBuildInputs(t *testing.T) {
+	val := "val"
+	env := "ENV"
+
+	src := ctlconf.Source{
+		ImageRef: ctlconf.ImageRef{Image: "app"},
+		Path:     ".",
+		Docker: &ctlconf.SourceDockerOpts{
+			Build: ctlconf.SourceDockerBuildOpts{
+				SourceBuildInputs: ctlconf.SourceBuildInputs{
+					BuildArgs: []ctlconf.SourceBuildArg{{Name: "ARG", Value: &val, ValueFromEnv: &env}},
+					Secrets:   []ctlconf.SourceBuildSecret{{ID: "token"}},
+				},
+			},
+		},
+	}
+	assert.EqualError(t, src.Validate(), "Expected BuildArgs[0] to specify exactly one of value, valueFromEnv or valueFromFile")
+
+	src.Docker.Build.BuildArgs[0].ValueFromEnv = nil
+	assert.EqualError(t, src.Validate(), "Expected Secrets[0] to specify exactly one of env or src")
+
+	src.Docker.Build.Secrets[0].Env = &env
+	assert.NoError(t, src.Validate())
+}
+
+func TestSourceValidateBuildxCache(t *testing.T) {
+	src := ctlconf.Source{
+		ImageRef: ctlconf.ImageRef{Image: "app"},
+		Path:     ".",
+		Docker: &ctlconf.SourceDockerOpts{
+			Buildx: &ctlconf.SourceDockerBuildxOpts{
+				CacheFrom: []ctlconf.SourceDockerBuildxCache{{Type: "registry"}},
+			},
+		},
+	}
+	assert.EqualError(t, src.Validate(), "Validating CacheFrom[0]: Expected Ref to be non-empty for registry cache")
+
+	src.Docker.Buildx.CacheFrom[0].Ref = "registry.example.com/cache"
+	src.Docker.Buildx.CacheTo = []ctlconf.SourceDockerBuildxCache{{Type: "s3"}}
+	assert.EqualError(t, src.Validate(), "Validating CacheTo[0]: Expected Type to be one of registry, local or gha, but was 's3'")
+
+	src.Docker.Buildx.CacheTo[0] = ctlconf.SourceDockerBuildxCache{Type: "local", Path: "/tmp/cache", Mode: "max"}
+	assert.NoError(t, src.Validate())
+}
+
+func TestSourceValidateKo(t *testing.T) {
+	trueVal := true
+	sbom := "json"
+
+	src := ctlconf.Source{
+		ImageRef: ctlconf.ImageRef{Image: "app"},
+		Path:     ".",
+		Ko: &ctlconf.SourceKoOpts{
+			Build: ctlconf.SourceKoBuildOpts{
+				Platforms: []string{"linux/amd64", "linux/arm64"},
+			},
+		},
+	}
+	assert.EqualError(t, src.Validate(), "Expected Ko.Build.Push to be enabled when building for multiple platforms")
+
+	src.Ko.Build.Platforms = []string{"all"}
+	assert.EqualError(t, src.Validate(), "Expected Ko.Build.Push to be enabled when building for multiple platforms")
+
+	src.Ko.Build.Push = &trueVal
+	src.Ko.Build.PreserveImportPaths = &trueVal
+	assert.EqualError(t, src.Validate(), "Expected Ko.Build.PreserveImportPaths to not be enabled when pushing to image destination")
+
+	src.Ko.Build.PreserveImportPaths = nil
+	src.Ko.Build.SBOM = &sbom
+	assert.EqualError(t, src.Validate(), "Expected Ko.Build.SBOM to be one of spdx, cyclonedx, go.version-m or none, but was 'json'")
+
+	sbom = "none"
+	assert.NoError(t, src.Validate())
+
+	src.Ko.Build.Ldflags = []string{"-X main.Version=1.0", `-X 'main.Name=app "v1"'`}
+	assert.EqualError(t, src.Validate(), `Expected Ko.Build.Ldflags to not contain both single and double quotes, but was '-X 'main.Name=app "v1"''`)
+
+	src.Ko.Build.Ldflags = []string{"-X main.Version=1.0", `-X "main.Name=app v1"`}
+	assert.NoError(t, src.Validate())
+}
+
+func TestSourceKoBuildOptsFromConfig(t *testing.T) {
+	_, conf, err := ctlconf.NewConfFromResources([]ctlres.Resource{
+		ctlres.MustNewResourceFromBytes([]byte(`
+apiVersion: kbld.k14s.io/v1alpha1
+kind: Config
+sources:
+- image: app
+  path: .
+  ko:
+    build:
+      baseImage: gcr.io/distroless/static
+      bare: true
+      push: true
+      sbom: none
+      ldflags: ["-s", "-w"]
+`)),
+	})
+	require.NoError(t, err)
+	require.Len(t, conf.Sources(), 1)
+
+	build := conf.Sources()[0].Ko.Build
+	assert.Equal(t, "gcr.io/distroless/static", *build.BaseImage)
+	assert.True(t, *build.Bare)
+	assert.True(t, build.PushEnabled())
+	assert.Equal(t, "none", *build.SBOM)
+	assert.Equal(t, []string{"-s", "-w"}, build.Ldflags)
+	assert.Nil(t, build.PreserveImportPaths)
+}
+
+func TestSourceValidateBazel(t *testing.T) {
+	target := "//app:image"
+	emptyTarget := ""
+
+	src := ctlconf.Source{
+		ImageRef: ctlconf.ImageRef{Image: "app"},
+		Path:     ".",
+		Bazel: &ctlconf.SourceBazelOpts{
+			Run:   ctlconf.SourceBazelRunOpts{Target: &target},
+			Build: &ctlconf.SourceBazelBuildOpts{Target: &target},
+		},
+	}
+	assert.EqualError(t, src.Validate(), "Expected only one of Bazel.Run or Bazel.Build to be specified")
+
+	src.Bazel.Run.Target = nil
+	src.Bazel.Build.Target = &emptyTarget
+	assert.EqualError(t, src.Validate(), "Expected Bazel.Build.Target to be non-empty")
+
+	src.Bazel.Build.Target = &target
+	assert.NoError(t, src.Validate())
+}
+
+func TestSourceValidateArtifact(t *testing.T) {
+	src := ctlconf.Source{
+		ImageRef: ctlconf.ImageRef{Image: "app"},
+		Path:     ".",
+		Artifact: &ctlconf.SourceArtifactOpts{},
+	}
+	assert.EqualError(t, src.Validate(), "Expected Artifact.Path to be non-empty")
+
+	src.Artifact.Path = "image.tar"
+	assert.NoError(t, src.Validate())
+}
+
+func TestConfigValidateRegistryMirrors(t *testing.T) {
+	config := ctlconf.Config{
+		Mirrors: []ctlconf.RegistryMirror{{Registry: "docker.io"}},
+	}
+	assert.EqualError(t, config.Validate(), "Validating Mirrors[0]: Expected Mirrors to be non-empty")
+
+	config.Mirrors[0] = ctlconf.RegistryMirror{Mirrors: []string{"mirror.example.com/dockerhub"}}
+	assert.EqualError(t, config.Validate(), "Validating Mirrors[0]: Expected Registry to be non-empty")
+
+	config.Mirrors[0].Registry = "docker.io"
+	assert.NoError(t, config.Validate())
+}
+
+func TestConfigValidateCredHelpers(t *testing.T) {
+	config := ctlconf.Config{
+		CredHelpers: map[string]string{"gcr.io": ""},
+	}
+	assert.EqualError(t, config.Validate(), "Validating CredHelpers[gcr.io]: Expected helper to be non-empty")
+
+	config.CredHelpers["gcr.io"] = "gcloud"
+	assert.NoError(t, config.Validate())
+}
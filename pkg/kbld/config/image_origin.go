@@ -14,6 +14,9 @@ type Origin struct {
 	Tagged           *OriginTagged           `json:"tagged,omitempty"`
 	Preresolved      *OriginPreresolved      `json:"preresolved,omitempty"`
 	PlatformSelected *OriginPlatformSelected `json:"platformSelected,omitempty"`
+	BuiltPlatform    *OriginBuiltPlatform    `json:"builtPlatform,omitempty"`
+	Cached           *OriginCached           `json:"cached,omitempty"`
+	Buildpacks       *OriginBuildpacks       `json:"buildpacks,omitempty"`
 }
 
 type OriginGit struct {
@@ -25,6 +28,8 @@ type OriginGit struct {
 
 type OriginLocal struct {
 	Path string `json:"path"`
+	// Digest is only recorded for pre-built image artifacts
+	Digest string `json:"digest,omitempty"`
 }
 
 type OriginResolved struct {
@@ -47,6 +52,40 @@ type OriginPlatformSelected struct {
 	Variant      string `json:"variant,omitempty"`
 }
 
+// OriginBuiltPlatform records one of the platforms
+// included in a multi-platform build
+type OriginBuiltPlatform struct {
+	OS           string `json:"os,omitempty"`
+	Architecture string `json:"architecture,omitempty"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+// OriginCached indicates that previously built image was reused
+// since its sources have not changed
+type OriginCached struct {
+	Fingerprint string `json:"fingerprint"`
+}
+
+// OriginBuildpacks records buildpacks metadata
+// (including bill of materials) of an image built by pack
+type OriginBuildpacks struct {
+	RunImage   string                     `json:"runImage,omitempty"`
+	Buildpacks []OriginBuildpack          `json:"buildpacks,omitempty"`
+	BOM        []OriginBuildpacksBOMEntry `json:"bom,omitempty"`
+}
+
+type OriginBuildpack struct {
+	ID       string `json:"id"`
+	Version  string `json:"version,omitempty"`
+	Homepage string `json:"homepage,omitempty"`
+}
+
+type OriginBuildpacksBOMEntry struct {
+	Name      string `json:"name"`
+	Version   string `json:"version,omitempty"`
+	Buildpack string `json:"buildpack,omitempty"`
+}
+
 func NewOriginsFromString(str string) ([]Origin, error) {
 	var origins []Origin
 
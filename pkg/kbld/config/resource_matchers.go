@@ -0,0 +1,117 @@
+// Copyright 2024 The Carvel Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"fmt"
+
+	ctlres "carvel.dev/kbld/pkg/kbld/resources"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// ResourceMatcher follows kapp's resource matchers format
+type ResourceMatcher struct {
+	APIVersionKindMatcher    *APIVersionKindMatcher    `json:"apiVersionKindMatcher,omitempty"`
+	KindNamespaceNameMatcher *KindNamespaceNameMatcher `json:"kindNamespaceNameMatcher,omitempty"`
+	LabelSelectorMatcher     *LabelSelectorMatcher     `json:"labelSelectorMatcher,omitempty"`
+	AnyMatcher               *AnyMatcher               `json:"anyMatcher,omitempty"`
+	AllMatcher               *AllMatcher               `json:"allMatcher,omitempty"`
+	NotMatcher               *NotMatcher               `json:"notMatcher,omitempty"`
+}
+
+type APIVersionKindMatcher struct {
+	APIVersion string `json:"apiVersion,omitempty"`
+	Kind       string `json:"kind,omitempty"`
+}
+
+type KindNamespaceNameMatcher struct {
+	Kind      string `json:"kind,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name,omitempty"`
+}
+
+type LabelSelectorMatcher struct {
+	// Selector uses kubectl syntax (e.g. app=foo,tier in (web,api))
+	Selector string `json:"selector"`
+}
+
+type AnyMatcher struct {
+	Matchers []ResourceMatcher `json:"matchers"`
+}
+
+type AllMatcher struct {
+	// Matches all resources when no matchers are specified
+	Matchers []ResourceMatcher `json:"matchers,omitempty"`
+}
+
+type NotMatcher struct {
+	Matcher ResourceMatcher `json:"matcher"`
+}
+
+type ResourceMatchers []ResourceMatcher
+
+// AsResourceMatcher returns matcher that matches when any of configured matchers match
+func (ms ResourceMatchers) AsResourceMatcher() (ctlres.ResourceMatcher, error) {
+	var result []ctlres.ResourceMatcher
+	for i, m := range ms {
+		matcher, err := m.AsResourceMatcher()
+		if err != nil {
+			return nil, fmt.Errorf("ResourceMatchers[%d]: %s", i, err)
+		}
+		result = append(result, matcher)
+	}
+	return ctlres.AnyMatcher{Matchers: result}, nil
+}
+
+func (m ResourceMatcher) AsResourceMatcher() (ctlres.ResourceMatcher, error) {
+	switch {
+	case m.APIVersionKindMatcher != nil:
+		return ctlres.APIVersionKindMatcher{
+			APIVersion: m.APIVersionKindMatcher.APIVersion,
+			Kind:       m.APIVersionKindMatcher.Kind,
+		}, nil
+
+	case m.KindNamespaceNameMatcher != nil:
+		return ctlres.KindNamespaceNameMatcher{
+			Kind:      m.KindNamespaceNameMatcher.Kind,
+			Namespace: m.KindNamespaceNameMatcher.Namespace,
+			Name:      m.KindNamespaceNameMatcher.Name,
+		}, nil
+
+	case m.LabelSelectorMatcher != nil:
+		sel, err := labels.Parse(m.LabelSelectorMatcher.Selector)
+		if err != nil {
+			return nil, fmt.Errorf("Parsing label selector: %s", err)
+		}
+		return ctlres.LabelSelectorMatcher{Selector: sel}, nil
+
+	case m.AnyMatcher != nil:
+		matcher, err := ResourceMatchers(m.AnyMatcher.Matchers).AsResourceMatcher()
+		if err != nil {
+			return nil, fmt.Errorf("AnyMatcher: %s", err)
+		}
+		return matcher, nil
+
+	case m.AllMatcher != nil:
+		var matchers []ctlres.ResourceMatcher
+		for i, subM := range m.AllMatcher.Matchers {
+			matcher, err := subM.AsResourceMatcher()
+			if err != nil {
+				return nil, fmt.Errorf("AllMatcher: Matchers[%d]: %s", i, err)
+			}
+			matchers = append(matchers, matcher)
+		}
+		return ctlres.AllMatcher{Matchers: matchers}, nil
+
+	case m.NotMatcher != nil:
+		matcher, err := m.NotMatcher.Matcher.AsResourceMatcher()
+		if err != nil {
+			return nil, fmt.Errorf("NotMatcher: %s", err)
+		}
+		return ctlres.NotMatcher{Matcher: matcher}, nil
+
+	default:
+		return nil, fmt.Errorf("Expected matcher to be specified")
+	}
+}
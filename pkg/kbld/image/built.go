@@ -4,20 +4,35 @@
 package image
 
 import (
+	"context"
+	"fmt"
 	"path/filepath"
+	"sort"
 
+	ctlb "carvel.dev/kbld/pkg/kbld/builder"
+	ctlbart "carvel.dev/kbld/pkg/kbld/builder/artifact"
 	ctlbbz "carvel.dev/kbld/pkg/kbld/builder/bazel"
+	ctlbbh "carvel.dev/kbld/pkg/kbld/builder/buildah"
 	ctlbdk "carvel.dev/kbld/pkg/kbld/builder/docker"
 	ctlbko "carvel.dev/kbld/pkg/kbld/builder/ko"
 	ctlbkb "carvel.dev/kbld/pkg/kbld/builder/kubectlbuildkit"
 	ctlbpk "carvel.dev/kbld/pkg/kbld/builder/pack"
+	ctlbpl "carvel.dev/kbld/pkg/kbld/builder/plugin"
 	ctlconf "carvel.dev/kbld/pkg/kbld/config"
+	ctlreg "carvel.dev/kbld/pkg/kbld/registry"
 )
 
 type BuiltImage struct {
 	url         string
 	buildSource ctlconf.Source
 	imgDst      *ctlconf.ImageDestination
+	buildArgs   map[string]string
+	buildInputs ctlb.BuildInputs
+
+	// pushDaemonless selects pushing exported image via registry client
+	// instead of `docker push` for pack, ko and bazel builds
+	registry       ctlreg.Registry
+	pushDaemonless bool
 
 	docker          ctlbdk.Docker
 	dockerBuildx    ctlbdk.Buildx
@@ -25,16 +40,35 @@ type BuiltImage struct {
 	kubectlBuildkit ctlbkb.KubectlBuildkit
 	ko              ctlbko.Ko
 	bazel           ctlbbz.Bazel
+	buildah         ctlbbh.Buildah
+	plugin          ctlbpl.Plugin
+	artifact        ctlbart.Artifact
 }
 
 func NewBuiltImage(url string, buildSource ctlconf.Source, imgDst *ctlconf.ImageDestination,
+	buildArgs map[string]string, buildInputs ctlb.BuildInputs, registry ctlreg.Registry, pushDaemonless bool,
 	docker ctlbdk.Docker, dockerBuildx ctlbdk.Buildx, pack ctlbpk.Pack,
-	kubectlBuildkit ctlbkb.KubectlBuildkit, ko ctlbko.Ko, bazel ctlbbz.Bazel) BuiltImage {
+	kubectlBuildkit ctlbkb.KubectlBuildkit, ko ctlbko.Ko, bazel ctlbbz.Bazel, buildah ctlbbh.Buildah,
+	plugin ctlbpl.Plugin, artifact ctlbart.Artifact) BuiltImage {
+
+	return BuiltImage{url, buildSource, imgDst, buildArgs, buildInputs, registry, pushDaemonless, docker, dockerBuildx, pack, kubectlBuildkit, ko, bazel, buildah, plugin, artifact}
+}
+
+func (i BuiltImage) URL(ctx context.Context) (string, []ctlconf.Origin, error) {
+	url, origins, err := i.build(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+
+	origins, err = i.buildInputs.RedactOrigins(origins)
+	if err != nil {
+		return "", nil, err
+	}
 
-	return BuiltImage{url, buildSource, imgDst, docker, dockerBuildx, pack, kubectlBuildkit, ko, bazel}
+	return url, origins, nil
 }
 
-func (i BuiltImage) URL() (string, []ctlconf.Origin, error) {
+func (i BuiltImage) build(ctx context.Context) (string, []ctlconf.Origin, error) {
 	origins, err := i.sources()
 	if err != nil {
 		return "", nil, err
@@ -44,46 +78,143 @@ func (i BuiltImage) URL() (string, []ctlconf.Origin, error) {
 
 	switch {
 	case i.buildSource.Pack != nil:
+		err := i.buildArgsUnsupported("pack")
+		if err != nil {
+			return "", nil, err
+		}
+
+		packOpts := i.buildSource.Pack.Build
+
 		opts := ctlbpk.PackBuildOpts{
-			Builder:    i.buildSource.Pack.Build.Builder,
-			Buildpacks: i.buildSource.Pack.Build.Buildpacks,
-			ClearCache: i.buildSource.Pack.Build.ClearCache,
-			RawOptions: i.buildSource.Pack.Build.RawOptions,
+			Builder:    packOpts.Builder,
+			Buildpacks: packOpts.Buildpacks,
+			ClearCache: packOpts.ClearCache,
+			Env:        packOpts.Env,
+			RunImage:   packOpts.RunImage,
+			PullPolicy: packOpts.PullPolicy,
+			Network:    packOpts.Network,
+			CacheImage: packOpts.CacheImage,
+			RawOptions: packOpts.RawOptions,
 		}
 
-		dockerTmpRef, err := i.pack.Build(urlRepo, i.buildSource.Path, opts)
+		if packOpts.PublishEnabled() {
+			if i.imgDst == nil {
+				return "", nil, fmt.Errorf("Expected image destination to be configured when Pack.Build.Publish is enabled")
+			}
+			url, moreOrigins, err := i.pack.Publish(ctx, urlRepo, i.buildSource.Path, opts, i.imgDst.NewImage)
+			return url, append(origins, moreOrigins...), err
+		}
+
+		dockerTmpRef, moreOrigins, err := i.pack.Build(ctx, urlRepo, i.buildSource.Path, opts)
 		if err != nil {
 			return "", nil, err
 		}
 
-		return i.optionalPushWithDocker(dockerTmpRef, origins)
+		return i.optionalPushDaemonless(ctx, dockerTmpRef, append(origins, moreOrigins...))
 
 	case i.buildSource.KubectlBuildkit != nil:
+		opts := *i.buildSource.KubectlBuildkit
+		opts.Build.RawOptions = i.withBuildArgs(i.buildInputs.WithArgs(opts.Build.RawOptions))
+
 		url, err := i.kubectlBuildkit.BuildAndPush(
-			urlRepo, i.buildSource.Path, i.imgDst, *i.buildSource.KubectlBuildkit)
+			ctx, urlRepo, i.buildSource.Path, i.imgDst, opts)
 		return url, origins, err
 
 	case i.buildSource.Ko != nil:
-		dockerTmpRef, err := i.ko.Build(urlRepo, i.buildSource.Path, i.buildSource.Ko.Build)
+		err := i.buildArgsUnsupported("ko")
+		if err != nil {
+			return "", nil, err
+		}
+
+		if i.buildSource.Ko.Build.PushEnabled() {
+			if i.imgDst == nil {
+				return "", nil, fmt.Errorf("Expected image destination to be configured when Ko.Build.Push is enabled")
+			}
+			url, err := i.ko.Publish(ctx, urlRepo, i.buildSource.Path, i.buildSource.Ko.Build, i.imgDst.NewImage)
+			return url, origins, err
+		}
+
+		// Avoid loading image into Docker daemon when it's going to be pushed
+		if i.imgDst != nil && i.pushDaemonless {
+			url, err := i.ko.BuildAndPush(ctx, urlRepo, i.buildSource.Path, i.buildSource.Ko.Build, i.imgDst.NewImage, i.registry)
+			return url, origins, err
+		}
+
+		dockerTmpRef, err := i.ko.Build(ctx, urlRepo, i.buildSource.Path, i.buildSource.Ko.Build)
 		if err != nil {
 			return "", nil, err
 		}
 
-		return i.optionalPushWithDocker(dockerTmpRef, origins)
+		return i.optionalPushDaemonless(ctx, dockerTmpRef, origins)
 
 	case i.buildSource.Bazel != nil:
-		dockerTmpRef, err := i.bazel.Run(urlRepo, i.buildSource.Path, i.buildSource.Bazel.Run)
+		err := i.buildArgsUnsupported("bazel")
 		if err != nil {
 			return "", nil, err
 		}
 
-		return i.optionalPushWithDocker(dockerTmpRef, origins)
+		if i.buildSource.Bazel.Build != nil {
+			if i.imgDst == nil {
+				return "", nil, fmt.Errorf("Expected image destination to be configured when using Bazel.Build")
+			}
+			url, err := i.bazel.BuildAndPush(ctx, urlRepo, i.buildSource.Path, *i.buildSource.Bazel.Build, i.imgDst.NewImage)
+			return url, origins, err
+		}
 
-	case i.buildSource.Docker != nil && i.buildSource.Docker.Buildx != nil:
-		url, err := i.dockerBuildx.BuildAndOptionallyPush(
-			urlRepo, i.buildSource.Path, i.imgDst, *i.buildSource.Docker.Buildx)
+		dockerTmpRef, err := i.bazel.Run(ctx, urlRepo, i.buildSource.Path, i.buildSource.Bazel.Run)
+		if err != nil {
+			return "", nil, err
+		}
+
+		return i.optionalPushDaemonless(ctx, dockerTmpRef, origins)
+
+	case i.buildSource.Plugin != nil:
+		url, moreOrigins, err := i.plugin.BuildAndOptionallyPush(
+			ctx, urlRepo, i.buildSource.Path, i.imgDst, i.buildArgs, *i.buildSource.Plugin)
+		if err != nil {
+			return "", nil, err
+		}
+
+		return url, append(origins, moreOrigins...), nil
+
+	case i.buildSource.Artifact != nil:
+		err := i.buildArgsUnsupported("artifact")
+		if err != nil {
+			return "", nil, err
+		}
+
+		if i.imgDst == nil {
+			return "", nil, fmt.Errorf("Expected image destination to be configured for artifact")
+		}
+
+		url, moreOrigins, err := i.artifact.BuildAndPush(
+			ctx, urlRepo, i.buildSource.Path, *i.buildSource.Artifact, i.imgDst.NewImage)
+		if err != nil {
+			return "", nil, err
+		}
+
+		return url, append(origins, moreOrigins...), nil
+
+	case i.buildSource.Buildah != nil:
+		opts := *i.buildSource.Buildah
+		opts.Build.RawOptions = i.withBuildArgs(opts.Build.RawOptions)
+
+		url, err := i.buildah.BuildAndOptionallyPush(
+			ctx, urlRepo, i.buildSource.Path, i.imgDst, opts)
 		return url, origins, err
 
+	case i.buildSource.Docker != nil && i.buildSource.Docker.Buildx != nil:
+		opts := *i.buildSource.Docker.Buildx
+		opts.RawOptions = i.withBuildArgs(i.buildInputs.WithArgs(opts.RawOptions))
+
+		url, moreOrigins, err := i.dockerBuildx.BuildAndOptionallyPush(
+			ctx, urlRepo, i.buildSource.Path, i.imgDst, opts)
+		if err != nil {
+			return "", nil, err
+		}
+
+		return url, append(origins, moreOrigins...), nil
+
 	// Fall back on Docker by default
 	default:
 		if i.buildSource.Docker == nil {
@@ -96,34 +227,85 @@ func (i BuiltImage) URL() (string, []ctlconf.Origin, error) {
 			NoCache:    i.buildSource.Docker.Build.NoCache,
 			File:       i.buildSource.Docker.Build.File,
 			Buildkit:   i.buildSource.Docker.Build.Buildkit,
-			RawOptions: i.buildSource.Docker.Build.RawOptions,
+			RawOptions: i.withBuildArgs(i.buildInputs.WithArgs(i.buildSource.Docker.Build.RawOptions)),
 		}
 
-		dockerTmpRef, err := i.docker.Build(urlRepo, i.buildSource.Path, opts)
+		dockerTmpRef, err := i.docker.Build(ctx, urlRepo, i.buildSource.Path, opts)
 		if err != nil {
 			return "", nil, err
 		}
 
-		return i.optionalPushWithDocker(dockerTmpRef, origins)
+		return i.optionalPushWithDocker(ctx, dockerTmpRef, origins)
 	}
 }
 
-func (i BuiltImage) optionalPushWithDocker(dockerTmpRef ctlbdk.TmpRef, origins []ctlconf.Origin) (string, []ctlconf.Origin, error) {
+func (i BuiltImage) optionalPushWithDocker(ctx context.Context, dockerTmpRef ctlbdk.TmpRef, origins []ctlconf.Origin) (string, []ctlconf.Origin, error) {
 	if i.imgDst != nil {
-		digest, err := i.docker.Push(dockerTmpRef, i.imgDst.NewImage)
+		digest, err := i.docker.Push(ctx, dockerTmpRef, i.imgDst.NewImage)
 		if err != nil {
 			return "", nil, err
 		}
 
-		url, moreOrigins, err := NewDigestedImageFromParts(i.imgDst.NewImage, digest.AsString()).URL()
+		return i.pushedURL(ctx, digest, origins)
+	}
+
+	return dockerTmpRef.AsString(), origins, nil
+}
+
+// optionalPushDaemonless exports image from Docker daemon and pushes it
+// via registry client when enabled (otherwise falls back to `docker push`)
+func (i BuiltImage) optionalPushDaemonless(ctx context.Context, dockerTmpRef ctlbdk.TmpRef, origins []ctlconf.Origin) (string, []ctlconf.Origin, error) {
+	if i.imgDst != nil && i.pushDaemonless {
+		digest, err := i.docker.PushDaemonless(ctx, dockerTmpRef, i.imgDst.NewImage, i.registry)
 		if err != nil {
 			return "", nil, err
 		}
 
-		return url, append(origins, moreOrigins...), nil
+		return i.pushedURL(ctx, digest, origins)
 	}
 
-	return dockerTmpRef.AsString(), origins, nil
+	return i.optionalPushWithDocker(ctx, dockerTmpRef, origins)
+}
+
+func (i BuiltImage) pushedURL(ctx context.Context, digest ctlbdk.ImageDigest, origins []ctlconf.Origin) (string, []ctlconf.Origin, error) {
+	url, moreOrigins, err := NewDigestedImageFromParts(i.imgDst.NewImage, digest.AsString()).URL(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return url, append(origins, moreOrigins...), nil
+}
+
+// withBuildArgs appends dependency build args to raw options
+// since all Docker-like builders support --build-arg flag
+func (i BuiltImage) withBuildArgs(rawOpts *[]string) *[]string {
+	if len(i.buildArgs) == 0 {
+		return rawOpts
+	}
+
+	var result []string
+	if rawOpts != nil {
+		result = append(result, *rawOpts...)
+	}
+
+	var names []string
+	for name := range i.buildArgs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		result = append(result, "--build-arg", name+"="+i.buildArgs[name])
+	}
+
+	return &result
+}
+
+func (i BuiltImage) buildArgsUnsupported(builderName string) error {
+	if len(i.buildArgs) > 0 {
+		return fmt.Errorf("Expected source dependencies to not be used with %s builder since it does not support build args", builderName)
+	}
+	return nil
 }
 
 func (i BuiltImage) sources() ([]ctlconf.Origin, error) {
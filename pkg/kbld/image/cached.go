@@ -0,0 +1,92 @@
+// Copyright 2024 The Carvel Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package image
+
+import (
+	"context"
+	"fmt"
+
+	ctlconf "carvel.dev/kbld/pkg/kbld/config"
+	ctllog "carvel.dev/kbld/pkg/kbld/logger"
+	ctlreg "carvel.dev/kbld/pkg/kbld/registry"
+	regname "github.com/google/go-containerregistry/pkg/name"
+)
+
+const (
+	fingerprintTagPrefix = "kbld-fp-"
+)
+
+// CachedBuiltImage skips building when image built from the same source fingerprint
+// was previously pushed (fingerprint is recorded as a tag in destination repository)
+type CachedBuiltImage struct {
+	image       BuiltImage
+	fingerprint SourceFingerprint
+	imgDst      ctlconf.ImageDestination
+	registry    ctlreg.Registry
+	logger      ctllog.Logger
+}
+
+func NewCachedBuiltImage(image BuiltImage, fingerprint SourceFingerprint, imgDst ctlconf.ImageDestination,
+	registry ctlreg.Registry, logger ctllog.Logger) CachedBuiltImage {
+
+	return CachedBuiltImage{image, fingerprint, imgDst, registry, logger}
+}
+
+func (i CachedBuiltImage) URL(ctx context.Context) (string, []ctlconf.Origin, error) {
+	fingerprint, err := i.fingerprint.Digest()
+	if err != nil {
+		return "", nil, fmt.Errorf("Calculating source fingerprint: %s", err)
+	}
+
+	fingerprintTag, err := regname.NewTag(i.imgDst.NewImage+":"+fingerprintTagPrefix+fingerprint, regname.WeakValidation)
+	if err != nil {
+		return "", nil, fmt.Errorf("Building fingerprint tag: %s", err)
+	}
+
+	prefixedLogger := i.logger.NewPrefixedWriter(i.image.url + " | ")
+
+	// Only missing fingerprint tag means that image has to be built,
+	// other errors (e.g. unauthorized) would otherwise silently disable caching
+	desc, err := i.registry.Generic(ctx, fingerprintTag)
+	if err != nil && !ctlreg.IsNotFoundErr(err) {
+		return "", nil, fmt.Errorf("Checking fingerprint tag '%s': %s", fingerprintTag.Name(), err)
+	}
+
+	if err == nil {
+		url := fingerprintTag.Context().Digest(desc.Digest.String()).Name()
+
+		prefixedLogger.WriteStr("skipping build since sources are unchanged (fingerprint: %s): %s\n", fingerprint, url)
+
+		origins, err := i.image.sources()
+		if err != nil {
+			return "", nil, err
+		}
+
+		origins = append(origins, ctlconf.Origin{Cached: &ctlconf.OriginCached{Fingerprint: fingerprint}})
+
+		return url, origins, nil
+	}
+
+	prefixedLogger.WriteStr("building since no image matches sources (fingerprint: %s)\n", fingerprint)
+
+	url, origins, err := i.image.URL(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+
+	digestRef, err := regname.NewDigest(url, regname.WeakValidation)
+	if err != nil {
+		return "", nil, fmt.Errorf("Expected built image '%s' to be a digest reference: %s", url, err)
+	}
+
+	// Failing to record fingerprint only affects future builds
+	err = i.registry.WriteTag(ctx, fingerprintTag, digestRef)
+	if err != nil {
+		prefixedLogger.WriteStr("warning: recording fingerprint tag: %s\n", err)
+	} else {
+		i.logger.Event(ctllog.Event{Type: ctllog.EventTagWritten, Image: url, URL: fingerprintTag.Name()})
+	}
+
+	return url, origins, nil
+}
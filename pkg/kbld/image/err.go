@@ -4,6 +4,8 @@
 package image
 
 import (
+	"context"
+
 	ctlconf "carvel.dev/kbld/pkg/kbld/config"
 )
 
@@ -15,4 +17,4 @@ var _ Image = ErrImage{}
 
 func NewErrImage(err error) ErrImage { return ErrImage{err} }
 
-func (i ErrImage) URL() (string, []ctlconf.Origin, error) { return "", nil, i.err }
+func (i ErrImage) URL(ctx context.Context) (string, []ctlconf.Origin, error) { return "", nil, i.err }
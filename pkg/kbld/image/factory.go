@@ -4,20 +4,26 @@
 package image
 
 import (
+	"context"
 	"fmt"
+	"time"
 
+	ctlb "carvel.dev/kbld/pkg/kbld/builder"
+	ctlbart "carvel.dev/kbld/pkg/kbld/builder/artifact"
 	ctlbbz "carvel.dev/kbld/pkg/kbld/builder/bazel"
+	ctlbbh "carvel.dev/kbld/pkg/kbld/builder/buildah"
 	ctlbdk "carvel.dev/kbld/pkg/kbld/builder/docker"
 	ctlbko "carvel.dev/kbld/pkg/kbld/builder/ko"
 	ctlbkb "carvel.dev/kbld/pkg/kbld/builder/kubectlbuildkit"
 	ctlbpk "carvel.dev/kbld/pkg/kbld/builder/pack"
+	ctlbpl "carvel.dev/kbld/pkg/kbld/builder/plugin"
 	ctlconf "carvel.dev/kbld/pkg/kbld/config"
 	ctllog "carvel.dev/kbld/pkg/kbld/logger"
 	ctlreg "carvel.dev/kbld/pkg/kbld/registry"
 )
 
 type Image interface {
-	URL() (string, []ctlconf.Origin, error)
+	URL(ctx context.Context) (string, []ctlconf.Origin, error)
 }
 
 type Factory struct {
@@ -30,6 +36,11 @@ type FactoryOpts struct {
 	Conf                    ctlconf.Conf
 	AllowedToBuild          bool
 	GlobalPlatformSelection *ctlconf.PlatformSelection
+	ResolveCache            *ResolveCache // optional
+	ResolveTimeout          time.Duration // optional
+	BuildTimeout            time.Duration // optional
+	SkipUnchangedBuilds     bool
+	PushDaemonless          bool
 }
 
 func NewFactory(opts FactoryOpts, registry ctlreg.Registry, logger ctllog.Logger) Factory {
@@ -37,58 +48,138 @@ func NewFactory(opts FactoryOpts, registry ctlreg.Registry, logger ctllog.Logger
 }
 
 func (f Factory) New(url string) Image {
-	platformSelection := f.opts.GlobalPlatformSelection
+	return f.NewWithDependencies(url, nil)
+}
+
+// NewWithDependencies provides resolved URLs (keyed by dependency image)
+// for sources that depend on other images
+func (f Factory) NewWithDependencies(url string, resolvedDeps map[string]string) Image {
+	plan := f.Plan(url)
+
+	switch plan.Action {
+	case ImagePlanActionPreresolved:
+		// Do not support platform selection against explicitly configured image
+		return NewPreresolvedImage(plan.URL, plan.Override.ImageOrigins)
+
+	case ImagePlanActionSelectTag:
+		tagSelected := NewTagSelectedImage(plan.URL, plan.Override.TagSelection, f.registry, f.opts.ResolveCache, f.logger)
+		return f.withResolveTimeout(NewPlatformSelectedImage(tagSelected, plan.PlatformSelection, f.registry))
+
+	case ImagePlanActionBuildDisallowed:
+		return NewErrImage(fmt.Errorf("Building of images is disallowed (tried to build '%s' because a source was configured for it)", plan.URL))
+
+	case ImagePlanActionBuild:
+		buildArgs := map[string]string{}
+		for _, dep := range plan.Source.DependsOn {
+			resolvedURL, found := resolvedDeps[dep.Image]
+			if !found {
+				return NewErrImage(fmt.Errorf("Expected dependency '%s' to be resolved before building '%s'", dep.Image, plan.URL))
+			}
+			buildArgs[dep.BuildArg] = resolvedURL
+		}
+
+		var buildInputs ctlb.BuildInputs
+		if inputs := plan.Source.BuildInputs(); inputs != nil {
+			var err error
+			buildInputs, err = ctlb.NewBuildInputs(*inputs, plan.Source.Path)
+			if err != nil {
+				return NewErrImage(fmt.Errorf("Preparing build inputs for '%s': %s", plan.URL, err))
+			}
+		}
+
+		// Secret values may show up in build output
+		logger := f.logger.WithRedactions(buildInputs.SecretValues)
+
+		docker := ctlbdk.New(logger)
+		dockerBuildx := ctlbdk.NewBuildx(docker, logger)
+		pack := ctlbpk.NewPack(docker, f.registry, logger)
+		kubectlBuildkit := ctlbkb.NewKubectlBuildkit(logger)
+		ko := ctlbko.NewKo(logger)
+		bazel := ctlbbz.NewBazel(docker, f.registry, logger)
+		buildah := ctlbbh.NewBuildah(f.registry, logger)
+		plugin := ctlbpl.NewPlugin(f.registry, logger)
+		artifact := ctlbart.NewArtifact(f.registry, logger)
+
+		builtImgWithoutCache := NewBuiltImage(plan.URL, *plan.Source, plan.Destination, buildArgs, buildInputs,
+			f.registry, f.opts.PushDaemonless, docker, dockerBuildx, pack, kubectlBuildkit, ko, bazel, buildah, plugin, artifact)
+
+		var builtImg Image = builtImgWithoutCache
+
+		// Fingerprints are stored in destination repository hence caching requires it
+		if f.opts.SkipUnchangedBuilds && plan.Destination != nil {
+			fingerprint := NewSourceFingerprint(*plan.Source, buildArgs, buildInputs.Args)
+			builtImg = NewCachedBuiltImage(builtImgWithoutCache, fingerprint, *plan.Destination, f.registry, logger)
+		}
+
+		if plan.Destination != nil {
+			builtImg = NewTaggedImage(builtImg, *plan.Destination, f.registry, logger)
+		}
+		// Build timeout also includes time to push and tag built image
+		return NewTimeoutImage(NewPlatformSelectedImage(builtImg, plan.PlatformSelection, f.registry), f.opts.BuildTimeout, "building")
+
+	case ImagePlanActionDigested:
+		return f.withResolveTimeout(NewPlatformSelectedImage(*MaybeNewDigestedImage(plan.URL), plan.PlatformSelection, f.registry))
+
+	default:
+		resolvedImg := NewResolvedImage(plan.URL, f.registry, f.opts.ResolveCache, f.logger)
+		return f.withResolveTimeout(NewPlatformSelectedImage(resolvedImg, plan.PlatformSelection, f.registry))
+	}
+}
+
+func (f Factory) withResolveTimeout(image Image) Image {
+	return NewTimeoutImage(image, f.opts.ResolveTimeout, "resolving")
+}
+
+// Plan determines how image will be processed without doing any work
+// (e.g. building, pushing or contacting registries)
+func (f Factory) Plan(url string) ImagePlan {
+	plan := ImagePlan{
+		URL:               url,
+		PlatformSelection: f.opts.GlobalPlatformSelection,
+	}
 
 	if overrideConf, found := f.shouldOverride(url); found {
+		plan.Override = &overrideConf
+
 		// Allow using same url but with additional selection (tag/platform)
 		if len(overrideConf.NewImage) > 0 {
-			url = overrideConf.NewImage
+			plan.URL = overrideConf.NewImage
 		}
 		if overrideConf.PlatformSelection != nil {
-			platformSelection = overrideConf.PlatformSelection
+			plan.PlatformSelection = overrideConf.PlatformSelection
 		}
 
 		if overrideConf.Preresolved {
-			// Do not support platform selection against explicitly configured image
-			return NewPreresolvedImage(url, overrideConf.ImageOrigins)
+			plan.Action = ImagePlanActionPreresolved
+			plan.PlatformSelection = nil
+			return plan
 		}
 		if overrideConf.TagSelection != nil {
-			tagSelected := NewTagSelectedImage(url, overrideConf.TagSelection, f.registry)
-			return NewPlatformSelectedImage(tagSelected, platformSelection, f.registry)
+			plan.Action = ImagePlanActionSelectTag
+			return plan
 		}
 		// Continue on with potentially changed url or platform selection
 	}
 
-	if srcConf, found := f.shouldBuild(url); found {
+	if srcConf, found := f.shouldBuild(plan.URL); found {
+		plan.Source = &srcConf
+
 		if !f.opts.AllowedToBuild {
-			return NewErrImage(fmt.Errorf("Building of images is disallowed (tried to build '%s' because a source was configured for it)", url))
+			plan.Action = ImagePlanActionBuildDisallowed
+			return plan
 		}
 
-		imgDstConf := f.optionalPushConf(url)
-
-		docker := ctlbdk.New(f.logger)
-		dockerBuildx := ctlbdk.NewBuildx(docker, f.logger)
-		pack := ctlbpk.NewPack(docker, f.logger)
-		kubectlBuildkit := ctlbkb.NewKubectlBuildkit(f.logger)
-		ko := ctlbko.NewKo(f.logger)
-		bazel := ctlbbz.NewBazel(docker, f.logger)
-
-		var builtImg Image = NewBuiltImage(url, srcConf, imgDstConf,
-			docker, dockerBuildx, pack, kubectlBuildkit, ko, bazel)
-
-		if imgDstConf != nil {
-			builtImg = NewTaggedImage(builtImg, *imgDstConf, f.registry)
-		}
-		return NewPlatformSelectedImage(builtImg, platformSelection, f.registry)
+		plan.Action = ImagePlanActionBuild
+		plan.Destination = f.optionalPushConf(plan.URL)
+		return plan
 	}
 
-	var resolvedImg Image
-	if digestedImage := MaybeNewDigestedImage(url); digestedImage != nil {
-		resolvedImg = digestedImage
+	if digestedImage := MaybeNewDigestedImage(plan.URL); digestedImage != nil {
+		plan.Action = ImagePlanActionDigested
 	} else {
-		resolvedImg = NewResolvedImage(url, f.registry)
+		plan.Action = ImagePlanActionResolve
 	}
-	return NewPlatformSelectedImage(resolvedImg, platformSelection, f.registry)
+	return plan
 }
 
 func (f Factory) shouldOverride(url string) (ctlconf.ImageOverride, bool) {
@@ -0,0 +1,273 @@
+// Copyright 2024 The Carvel Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package image
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	ctlconf "carvel.dev/kbld/pkg/kbld/config"
+)
+
+const (
+	fingerprintVersion = "v1"
+)
+
+// SourceFingerprint identifies build context contents (honoring .dockerignore)
+// together with builder options so that unchanged sources do not need to be rebuilt
+type SourceFingerprint struct {
+	source         ctlconf.Source
+	buildArgs      map[string]string
+	buildInputArgs []string
+}
+
+func NewSourceFingerprint(source ctlconf.Source, buildArgs map[string]string, buildInputArgs []string) SourceFingerprint {
+	return SourceFingerprint{source, buildArgs, buildInputArgs}
+}
+
+// Digest returns sha256 hex digest of the fingerprint
+func (f SourceFingerprint) Digest() (string, error) {
+	hash := sha256.New()
+
+	// Path is excluded since the same sources may be checked out
+	// into different locations (e.g. on different CI workers)
+	src := f.source
+	src.ImageRef = ctlconf.ImageRef{}
+	src.Path = ""
+
+	optsBs, err := json.Marshal(struct {
+		Version        string
+		Source         ctlconf.Source
+		BuildArgs      map[string]string
+		BuildInputArgs []string
+	}{fingerprintVersion, src, f.buildArgs, f.buildInputArgs})
+	if err != nil {
+		return "", fmt.Errorf("Marshaling build options: %s", err)
+	}
+
+	hash.Write(optsBs)
+
+	err = f.hashFiles(hash)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func (f SourceFingerprint) hashFiles(hash io.Writer) error {
+	rootPath := f.source.Path
+
+	ignore, err := newDockerIgnore(filepath.Join(rootPath, ".dockerignore"))
+	if err != nil {
+		return err
+	}
+
+	var relPaths []string
+
+	err = filepath.WalkDir(rootPath, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(rootPath, path)
+		if err != nil {
+			return err
+		}
+
+		relPath = filepath.ToSlash(relPath)
+		if relPath == "." {
+			return nil
+		}
+
+		// Git metadata changes frequently without affecting build results
+		if relPath == ".git" && entry.IsDir() {
+			return filepath.SkipDir
+		}
+
+		if ignore.Excluded(relPath) {
+			// Cannot skip whole directory since its contents may be re-included
+			return nil
+		}
+
+		if !entry.IsDir() {
+			relPaths = append(relPaths, relPath)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("Walking source path '%s': %s", rootPath, err)
+	}
+
+	sort.Strings(relPaths)
+
+	for _, relPath := range relPaths {
+		err := f.hashFile(hash, rootPath, relPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (f SourceFingerprint) hashFile(hash io.Writer, rootPath, relPath string) error {
+	path := filepath.Join(rootPath, filepath.FromSlash(relPath))
+
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(hash, "%s\x00%o\x00", relPath, info.Mode()&(fs.ModeType|0111))
+
+	if info.Mode()&fs.ModeSymlink != 0 {
+		target, err := os.Readlink(path)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(hash, "%s\x00", target)
+		return nil
+	}
+
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		return fmt.Errorf("Hashing file '%s': %s", path, err)
+	}
+
+	hash.Write([]byte{0})
+	return nil
+}
+
+type dockerIgnorePattern struct {
+	regexp  *regexp.Regexp
+	exclude bool
+}
+
+// dockerIgnore implements subset of .dockerignore matching rules:
+// patterns are relative to context root, support *, ? and **,
+// later patterns take precedence and ! re-includes matched paths
+type dockerIgnore struct {
+	patterns []dockerIgnorePattern
+}
+
+func newDockerIgnore(path string) (dockerIgnore, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return dockerIgnore{}, nil
+		}
+		return dockerIgnore{}, fmt.Errorf("Reading .dockerignore: %s", err)
+	}
+	defer file.Close()
+
+	var result dockerIgnore
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		exclude := true
+		if strings.HasPrefix(line, "!") {
+			exclude = false
+			line = strings.TrimSpace(line[1:])
+		}
+
+		line = strings.Trim(filepath.ToSlash(filepath.Clean(line)), "/")
+
+		re, err := regexp.Compile(dockerIgnoreRegexp(line))
+		if err != nil {
+			return dockerIgnore{}, fmt.Errorf("Parsing .dockerignore pattern '%s': %s", line, err)
+		}
+
+		result.patterns = append(result.patterns, dockerIgnorePattern{re, exclude})
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return dockerIgnore{}, fmt.Errorf("Reading .dockerignore: %s", err)
+	}
+
+	return result, nil
+}
+
+// Excluded checks if path (or any of its parent directories) is excluded
+func (d dockerIgnore) Excluded(relPath string) bool {
+	var excluded bool
+
+	for _, pattern := range d.patterns {
+		if d.matches(pattern.regexp, relPath) {
+			excluded = pattern.exclude
+		}
+	}
+
+	return excluded
+}
+
+func (d dockerIgnore) matches(re *regexp.Regexp, relPath string) bool {
+	if re.MatchString(relPath) {
+		return true
+	}
+	for dir := filepath.ToSlash(filepath.Dir(relPath)); dir != "."; dir = filepath.ToSlash(filepath.Dir(dir)) {
+		if re.MatchString(dir) {
+			return true
+		}
+	}
+	return false
+}
+
+func dockerIgnoreRegexp(pattern string) string {
+	var result strings.Builder
+
+	result.WriteString("^")
+
+	for i := 0; i < len(pattern); i++ {
+		switch ch := pattern[i]; ch {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				i++
+				// Consume slash following ** so that it also matches zero directories
+				if i+1 < len(pattern) && pattern[i+1] == '/' {
+					i++
+					result.WriteString("(.*/)?")
+				} else {
+					result.WriteString(".*")
+				}
+			} else {
+				result.WriteString("[^/]*")
+			}
+		case '?':
+			result.WriteString("[^/]")
+		default:
+			result.WriteString(regexp.QuoteMeta(string(ch)))
+		}
+	}
+
+	result.WriteString("$")
+
+	return result.String()
+}
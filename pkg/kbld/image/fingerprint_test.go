@@ -0,0 +1,82 @@
+// Copyright 2024 The Carvel Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package image_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	ctlconf "carvel.dev/kbld/pkg/kbld/config"
+	ctlimg "carvel.dev/kbld/pkg/kbld/image"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSourceFingerprint(t *testing.T) {
+	writeFiles := func(t *testing.T, dir string, files map[string]string) {
+		for path, content := range files {
+			fullPath := filepath.Join(dir, path)
+			require.NoError(t, os.MkdirAll(filepath.Dir(fullPath), 0700))
+			require.NoError(t, os.WriteFile(fullPath, []byte(content), 0600))
+		}
+	}
+
+	newSource := func(t *testing.T, files map[string]string) ctlconf.Source {
+		dir := t.TempDir()
+		writeFiles(t, dir, map[string]string{
+			"Dockerfile":       "FROM scratch",
+			"main.go":          "package main",
+			"docs/README.md":   "docs",
+			"tmp/keep.txt":     "keep",
+			"tmp/ignored.txt":  "ignored",
+			".git/HEAD":        "ref: refs/heads/main",
+			".dockerignore":    "docs\n**/*.log\ntmp/*\n!tmp/keep.txt\n",
+			"logs/nested/a.go": "package nested",
+		})
+		writeFiles(t, dir, files)
+		return ctlconf.Source{ImageRef: ctlconf.ImageRef{Image: "app"}, Path: dir}
+	}
+
+	digest := func(t *testing.T, src ctlconf.Source) string {
+		result, err := ctlimg.NewSourceFingerprint(src, nil, nil).Digest()
+		require.NoError(t, err)
+		return result
+	}
+
+	baseline := digest(t, newSource(t, nil))
+
+	t.Run("does not depend on source location or image name", func(t *testing.T) {
+		src := newSource(t, nil)
+		src.Image = "other-app"
+		assert.Equal(t, baseline, digest(t, src))
+	})
+
+	t.Run("ignores files excluded by .dockerignore and git metadata", func(t *testing.T) {
+		assert.Equal(t, baseline, digest(t, newSource(t, map[string]string{
+			"docs/README.md":  "changed",
+			"tmp/ignored.txt": "changed",
+			"logs/debug.log":  "new",
+			".git/HEAD":       "ref: refs/heads/other",
+		})))
+	})
+
+	t.Run("includes files that are not excluded", func(t *testing.T) {
+		assert.NotEqual(t, baseline, digest(t, newSource(t, map[string]string{"main.go": "package main // changed"})))
+		assert.NotEqual(t, baseline, digest(t, newSource(t, map[string]string{"tmp/keep.txt": "changed"})))
+		assert.NotEqual(t, baseline, digest(t, newSource(t, map[string]string{"logs/nested/a.go": "changed"})))
+	})
+
+	t.Run("includes builder options and build args", func(t *testing.T) {
+		target := "prod"
+
+		src := newSource(t, nil)
+		src.Docker = &ctlconf.SourceDockerOpts{Build: ctlconf.SourceDockerBuildOpts{Target: &target}}
+		assert.NotEqual(t, baseline, digest(t, src))
+
+		withArgs, err := ctlimg.NewSourceFingerprint(newSource(t, nil), map[string]string{"BASE": "base@sha256:abc"}, nil).Digest()
+		require.NoError(t, err)
+		assert.NotEqual(t, baseline, withArgs)
+	})
+}
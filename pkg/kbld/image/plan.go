@@ -0,0 +1,96 @@
+// Copyright 2024 The Carvel Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package image
+
+import (
+	"encoding/json"
+	"path/filepath"
+
+	ctlbbh "carvel.dev/kbld/pkg/kbld/builder/buildah"
+	ctlbpl "carvel.dev/kbld/pkg/kbld/builder/plugin"
+	ctlconf "carvel.dev/kbld/pkg/kbld/config"
+)
+
+type ImagePlanAction string
+
+const (
+	ImagePlanActionPreresolved     ImagePlanAction = "preresolved"
+	ImagePlanActionSelectTag       ImagePlanAction = "select-tag"
+	ImagePlanActionBuild           ImagePlanAction = "build"
+	ImagePlanActionBuildDisallowed ImagePlanAction = "build-disallowed"
+	ImagePlanActionDigested        ImagePlanAction = "digested"
+	ImagePlanActionResolve         ImagePlanAction = "resolve"
+)
+
+// ImagePlan describes what Factory decided to do with an image
+type ImagePlan struct {
+	// URL after applying override
+	URL    string
+	Action ImagePlanAction
+
+	Override          *ctlconf.ImageOverride
+	Source            *ctlconf.Source
+	Destination       *ctlconf.ImageDestination
+	PlatformSelection *ctlconf.PlatformSelection
+}
+
+// BuilderName returns name of the builder that will be used for a source
+func (p ImagePlan) BuilderName() string {
+	if p.Source == nil {
+		return ""
+	}
+	switch {
+	case p.Source.Pack != nil:
+		return "pack"
+	case p.Source.KubectlBuildkit != nil:
+		return "kubectl-buildkit"
+	case p.Source.Ko != nil:
+		return "ko"
+	case p.Source.Bazel != nil:
+		return "bazel"
+	case p.Source.Plugin != nil:
+		return ctlbpl.BuilderName(*p.Source.Plugin)
+	case p.Source.Buildah != nil:
+		return ctlbbh.CommandName(*p.Source.Buildah)
+	case p.Source.Artifact != nil:
+		return "artifact"
+	case p.Source.Docker != nil && p.Source.Docker.Buildx != nil:
+		return "docker-buildx"
+	default:
+		return "docker"
+	}
+}
+
+// BuildKey identifies build work so that images with the same source path,
+// builder options, destination and platform selection are only built once
+func (p ImagePlan) BuildKey() (string, bool) {
+	if p.Action != ImagePlanActionBuild || p.Source == nil {
+		return "", false
+	}
+
+	src := *p.Source
+	src.ImageRef = ctlconf.ImageRef{}
+
+	if absPath, err := filepath.Abs(src.Path); err == nil {
+		src.Path = absPath
+	}
+
+	var dst *ctlconf.ImageDestination
+	if p.Destination != nil {
+		dstCopy := *p.Destination
+		dstCopy.ImageRef = ctlconf.ImageRef{}
+		dst = &dstCopy
+	}
+
+	bs, err := json.Marshal(struct {
+		Source            ctlconf.Source
+		Destination       *ctlconf.ImageDestination
+		PlatformSelection *ctlconf.PlatformSelection
+	}{src, dst, p.PlatformSelection})
+	if err != nil {
+		return "", false
+	}
+
+	return string(bs), true
+}
@@ -4,6 +4,7 @@
 package image
 
 import (
+	"context"
 	"fmt"
 
 	ctlconf "carvel.dev/kbld/pkg/kbld/config"
@@ -26,8 +27,8 @@ func NewPlatformSelectedImage(image Image,
 	return PlatformSelectedImage{image, selection, registry}
 }
 
-func (i PlatformSelectedImage) URL() (string, []ctlconf.Origin, error) {
-	url, origins, err := i.image.URL()
+func (i PlatformSelectedImage) URL(ctx context.Context) (string, []ctlconf.Origin, error) {
+	url, origins, err := i.image.URL(ctx)
 	if err != nil {
 		return url, origins, err
 	}
@@ -42,14 +43,14 @@ func (i PlatformSelectedImage) URL() (string, []ctlconf.Origin, error) {
 		return "", nil, err
 	}
 
-	desc, err := i.registry.Generic(ref)
+	desc, err := i.registry.Generic(ctx, ref)
 	if err != nil {
 		return "", nil, err
 	}
 
 	switch desc.MediaType {
 	case regtypes.OCIImageIndex, regtypes.DockerManifestList:
-		imgIndex, err := i.registry.Index(ref)
+		imgIndex, err := i.registry.Index(ctx, ref)
 		if err != nil {
 			return "", nil, err
 		}
@@ -71,7 +72,7 @@ func (i PlatformSelectedImage) URL() (string, []ctlconf.Origin, error) {
 		}
 
 		if matchedMan != nil {
-			newURL, newOrigins, err := NewDigestedImageFromParts(ref.Context().Name(), matchedMan.Digest.String()).URL()
+			newURL, newOrigins, err := NewDigestedImageFromParts(ref.Context().Name(), matchedMan.Digest.String()).URL(ctx)
 			if err != nil {
 				return "", nil, err
 			}
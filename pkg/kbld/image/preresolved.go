@@ -4,6 +4,8 @@
 package image
 
 import (
+	"context"
+
 	ctlconf "carvel.dev/kbld/pkg/kbld/config"
 )
 
@@ -16,7 +18,7 @@ func NewPreresolvedImage(url string, origins []ctlconf.Origin) PreresolvedImage
 	return PreresolvedImage{url, copyAndAppendOrigins(origins)}
 }
 
-func (i PreresolvedImage) URL() (string, []ctlconf.Origin, error) {
+func (i PreresolvedImage) URL(ctx context.Context) (string, []ctlconf.Origin, error) {
 	for _, origin := range i.origins {
 		if origin.Preresolved != nil && origin.Preresolved.URL == i.url {
 			imageOrigins := copyAndAppendOrigins(i.origins)
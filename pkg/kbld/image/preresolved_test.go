@@ -4,6 +4,7 @@
 package image_test
 
 import (
+	"context"
 	"testing"
 
 	ctlconf "carvel.dev/kbld/pkg/kbld/config"
@@ -17,7 +18,7 @@ func TestPreResolvedOrigins(t *testing.T) {
 
 	subject := NewPreresolvedImage(preresolvedImage, originsFromImagesLockConfig)
 
-	url, origins, err := subject.URL()
+	url, origins, err := subject.URL(context.Background())
 	assert.NoError(t, err)
 	assert.Equal(t, url, preresolvedImage)
 	assert.Len(t, origins, 1)
@@ -0,0 +1,135 @@
+// Copyright 2024 The Carvel Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package image
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	regname "github.com/google/go-containerregistry/pkg/name"
+)
+
+// ResolveCache persists tag to digest mappings on disk so that
+// repeated resolution of unchanged tags does not hit registries.
+// Entries are grouped by registry (to allow per-registry invalidation)
+// and keyed by a hash of the fully qualified tag reference.
+type ResolveCache struct {
+	dir string
+	ttl time.Duration
+}
+
+type resolveCacheEntry struct {
+	Tag        string    `json:"tag"`
+	Digest     string    `json:"digest"`
+	ResolvedAt time.Time `json:"resolvedAt"`
+}
+
+// NewResolveCache returns cache stored in given directory.
+// Entries older than ttl are ignored; zero ttl means entries never expire.
+func NewResolveCache(dir string, ttl time.Duration) *ResolveCache {
+	return &ResolveCache{dir: dir, ttl: ttl}
+}
+
+// Get returns previously recorded digest for the tag
+// if it's present and has not expired.
+func (c *ResolveCache) Get(tag regname.Tag) (string, bool) {
+	bs, err := os.ReadFile(c.entryPath(tag))
+	if err != nil {
+		return "", false
+	}
+
+	var entry resolveCacheEntry
+
+	err = json.Unmarshal(bs, &entry)
+	if err != nil {
+		// Treat corrupted entries as missing; they will be overwritten
+		return "", false
+	}
+
+	if entry.Tag != tag.Name() || len(entry.Digest) == 0 {
+		return "", false
+	}
+	if c.ttl > 0 && time.Since(entry.ResolvedAt) > c.ttl {
+		return "", false
+	}
+
+	return entry.Digest, true
+}
+
+// Put records digest for the tag
+func (c *ResolveCache) Put(tag regname.Tag, digest string) error {
+	entry := resolveCacheEntry{
+		Tag:        tag.Name(),
+		Digest:     digest,
+		ResolvedAt: time.Now().UTC(),
+	}
+
+	bs, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("Marshaling resolve cache entry: %s", err)
+	}
+
+	path := c.entryPath(tag)
+
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return fmt.Errorf("Creating resolve cache directory: %s", err)
+	}
+
+	// Write to a temporary file first so that concurrent readers
+	// never observe partially written entries
+	tmpFile, err := os.CreateTemp(filepath.Dir(path), ".entry-")
+	if err != nil {
+		return fmt.Errorf("Creating resolve cache entry: %s", err)
+	}
+
+	_, err = tmpFile.Write(bs)
+	closeErr := tmpFile.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpFile.Name())
+		return fmt.Errorf("Writing resolve cache entry: %s", err)
+	}
+
+	err = os.Rename(tmpFile.Name(), path)
+	if err != nil {
+		os.Remove(tmpFile.Name())
+		return fmt.Errorf("Writing resolve cache entry: %s", err)
+	}
+
+	return nil
+}
+
+// InvalidateRegistry removes all entries recorded for given registry (e.g. gcr.io, index.docker.io)
+func (c *ResolveCache) InvalidateRegistry(registry string) error {
+	reg, err := regname.NewRegistry(registry, regname.WeakValidation)
+	if err != nil {
+		return fmt.Errorf("Parsing registry hostname '%s': %s", registry, err)
+	}
+
+	err = os.RemoveAll(c.registryDir(reg.RegistryStr()))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("Invalidating resolve cache for registry '%s': %s", registry, err)
+	}
+
+	return nil
+}
+
+func (c *ResolveCache) registryDir(registry string) string {
+	// Registry may include port which is not a valid path character on all platforms
+	return filepath.Join(c.dir, strings.Replace(registry, ":", "_", -1))
+}
+
+func (c *ResolveCache) entryPath(tag regname.Tag) string {
+	sum := sha256.Sum256([]byte(tag.Name()))
+	return filepath.Join(c.registryDir(tag.RegistryStr()), fmt.Sprintf("%x.json", sum))
+}
@@ -0,0 +1,118 @@
+// Copyright 2024 The Carvel Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package image_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	ctlimg "carvel.dev/kbld/pkg/kbld/image"
+	ctllog "carvel.dev/kbld/pkg/kbld/logger"
+	ctlreg "carvel.dev/kbld/pkg/kbld/registry"
+	regname "github.com/google/go-containerregistry/pkg/name"
+	regregistry "github.com/google/go-containerregistry/pkg/registry"
+	regrandom "github.com/google/go-containerregistry/pkg/v1/random"
+	regremote "github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const resolveCacheDigest = "sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+
+func TestResolveCacheRoundTrip(t *testing.T) {
+	cache := ctlimg.NewResolveCache(t.TempDir(), 0)
+
+	tag, err := regname.NewTag("gcr.io/repo:1.0", regname.WeakValidation)
+	require.NoError(t, err)
+
+	_, found := cache.Get(tag)
+	assert.False(t, found)
+
+	require.NoError(t, cache.Put(tag, resolveCacheDigest))
+
+	digest, found := cache.Get(tag)
+	assert.True(t, found)
+	assert.Equal(t, resolveCacheDigest, digest)
+
+	otherTag, err := regname.NewTag("gcr.io/repo:2.0", regname.WeakValidation)
+	require.NoError(t, err)
+
+	_, found = cache.Get(otherTag)
+	assert.False(t, found)
+}
+
+func TestResolveCacheExpiresEntries(t *testing.T) {
+	cache := ctlimg.NewResolveCache(t.TempDir(), time.Nanosecond)
+
+	tag, err := regname.NewTag("gcr.io/repo:1.0", regname.WeakValidation)
+	require.NoError(t, err)
+
+	require.NoError(t, cache.Put(tag, resolveCacheDigest))
+	time.Sleep(time.Millisecond)
+
+	_, found := cache.Get(tag)
+	assert.False(t, found)
+}
+
+func TestResolveCacheInvalidateRegistry(t *testing.T) {
+	cache := ctlimg.NewResolveCache(t.TempDir(), 0)
+
+	gcrTag, err := regname.NewTag("gcr.io/repo:1.0", regname.WeakValidation)
+	require.NoError(t, err)
+
+	localTag, err := regname.NewTag("localhost:5000/repo:1.0", regname.WeakValidation)
+	require.NoError(t, err)
+
+	require.NoError(t, cache.Put(gcrTag, resolveCacheDigest))
+	require.NoError(t, cache.Put(localTag, resolveCacheDigest))
+
+	require.NoError(t, cache.InvalidateRegistry("localhost:5000"))
+
+	_, found := cache.Get(localTag)
+	assert.False(t, found)
+
+	_, found = cache.Get(gcrTag)
+	assert.True(t, found)
+
+	// Invalidating registry without entries is not an error
+	require.NoError(t, cache.InvalidateRegistry("docker.io"))
+}
+
+func TestResolvedImageIgnoresResolveCacheWriteErrors(t *testing.T) {
+	server := httptest.NewServer(regregistry.New(regregistry.Logger(log.New(io.Discard, "", 0))))
+	defer server.Close()
+
+	tag, err := regname.NewTag(strings.TrimPrefix(server.URL, "http://")+"/app:v1", regname.WeakValidation)
+	require.NoError(t, err)
+
+	img, err := regrandom.Image(1024, 1)
+	require.NoError(t, err)
+	require.NoError(t, regremote.Write(tag, img))
+
+	imgDigest, err := img.Digest()
+	require.NoError(t, err)
+
+	// Cache directory cannot be created since regular file is in its place
+	cacheDir := filepath.Join(t.TempDir(), "cache")
+	require.NoError(t, os.WriteFile(cacheDir, nil, 0600))
+
+	registry, err := ctlreg.NewRegistry(ctlreg.Opts{EnvAuthPrefix: "KBLD_TEST_REGISTRY"})
+	require.NoError(t, err)
+
+	var logOutput bytes.Buffer
+
+	url, _, err := ctlimg.NewResolvedImage(tag.Name(), registry,
+		ctlimg.NewResolveCache(cacheDir, 0), ctllog.NewLogger(&logOutput)).URL(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, tag.Context().Name()+"@"+imgDigest.String(), url)
+	assert.Contains(t, logOutput.String(), "warning: recording resolved digest in cache: Creating resolve cache directory: ")
+}
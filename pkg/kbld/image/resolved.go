@@ -4,9 +4,11 @@
 package image
 
 import (
+	"context"
 	"fmt"
 
 	ctlconf "carvel.dev/kbld/pkg/kbld/config"
+	ctllog "carvel.dev/kbld/pkg/kbld/logger"
 	ctlreg "carvel.dev/kbld/pkg/kbld/registry"
 	regname "github.com/google/go-containerregistry/pkg/name"
 )
@@ -15,19 +17,27 @@ import (
 type ResolvedImage struct {
 	url      string
 	registry ctlreg.Registry
+	cache    *ResolveCache // optional
+	logger   ctllog.Logger
 }
 
-func NewResolvedImage(url string, registry ctlreg.Registry) ResolvedImage {
-	return ResolvedImage{url, registry}
+func NewResolvedImage(url string, registry ctlreg.Registry, cache *ResolveCache, logger ctllog.Logger) ResolvedImage {
+	return ResolvedImage{url, registry, cache, logger}
 }
 
-func (i ResolvedImage) URL() (string, []ctlconf.Origin, error) {
+func (i ResolvedImage) URL(ctx context.Context) (string, []ctlconf.Origin, error) {
 	tag, err := regname.NewTag(i.url, regname.WeakValidation)
 	if err != nil {
 		return "", nil, err
 	}
 
-	imgDescriptor, err := i.registry.Generic(tag)
+	if i.cache != nil {
+		if digest, found := i.cache.Get(tag); found {
+			return i.digestedURL(ctx, tag, digest)
+		}
+	}
+
+	imgDescriptor, err := i.registry.Generic(ctx, tag)
 	if err != nil {
 		return "", nil, err
 	}
@@ -35,7 +45,7 @@ func (i ResolvedImage) URL() (string, []ctlconf.Origin, error) {
 	// Resolve image second time because some older registry can
 	// return "random" digests that change for every request.
 	// See https://carvel.dev/kbld/issues/21 for details.
-	imgDescriptor2, err := i.registry.Generic(tag)
+	imgDescriptor2, err := i.registry.Generic(ctx, tag)
 	if err != nil {
 		return "", nil, err
 	}
@@ -44,7 +54,24 @@ func (i ResolvedImage) URL() (string, []ctlconf.Origin, error) {
 		return "", nil, fmt.Errorf("Expected digest resolution to be consistent over two separate requests")
 	}
 
-	url, origins, err := NewDigestedImageFromParts(tag.Repository.String(), imgDescriptor.Digest.String()).URL()
+	// Failing to record digest only affects future resolutions
+	if i.cache != nil {
+		err := i.cache.Put(tag, imgDescriptor.Digest.String())
+		if err != nil {
+			i.logger.NewPrefixedWriter(i.url+" | ").WriteStr("warning: recording resolved digest in cache: %s\n", err)
+		}
+	}
+
+	return i.digestedURL(ctx, tag, imgDescriptor.Digest.String())
+}
+
+func (i ResolvedImage) digestedURL(ctx context.Context, tag regname.Tag, digest string) (string, []ctlconf.Origin, error) {
+	repo, err := i.registry.OutputRepository(ctx, tag.Repository, digest)
+	if err != nil {
+		return "", nil, err
+	}
+
+	url, origins, err := NewDigestedImageFromParts(repo, digest).URL(ctx)
 	if err != nil {
 		return "", nil, err
 	}
@@ -4,9 +4,11 @@
 package image
 
 import (
+	"context"
 	"fmt"
 
 	ctlconf "carvel.dev/kbld/pkg/kbld/config"
+	ctllog "carvel.dev/kbld/pkg/kbld/logger"
 	ctlreg "carvel.dev/kbld/pkg/kbld/registry"
 	"carvel.dev/vendir/pkg/vendir/versions"
 	"carvel.dev/vendir/pkg/vendir/versions/v1alpha1"
@@ -18,15 +20,17 @@ type TagSelectedImage struct {
 	url       string
 	selection *v1alpha1.VersionSelection
 	registry  ctlreg.Registry
+	cache     *ResolveCache // optional
+	logger    ctllog.Logger
 }
 
 func NewTagSelectedImage(url string, selection *v1alpha1.VersionSelection,
-	registry ctlreg.Registry) TagSelectedImage {
+	registry ctlreg.Registry, cache *ResolveCache, logger ctllog.Logger) TagSelectedImage {
 
-	return TagSelectedImage{url, selection, registry}
+	return TagSelectedImage{url, selection, registry, cache, logger}
 }
 
-func (i TagSelectedImage) URL() (string, []ctlconf.Origin, error) {
+func (i TagSelectedImage) URL(ctx context.Context) (string, []ctlconf.Origin, error) {
 	repo, err := regname.NewRepository(i.url, regname.WeakValidation)
 	if err != nil {
 		return "", nil, err
@@ -36,7 +40,7 @@ func (i TagSelectedImage) URL() (string, []ctlconf.Origin, error) {
 
 	switch {
 	case i.selection.Semver != nil:
-		tags, err := i.registry.ListTags(repo)
+		tags, err := i.registry.ListTags(ctx, repo)
 		if err != nil {
 			return "", nil, err
 		}
@@ -62,5 +66,5 @@ func (i TagSelectedImage) URL() (string, []ctlconf.Origin, error) {
 	}
 
 	// tag value is included by ResolvedImage
-	return NewResolvedImage(i.url+":"+tag, i.registry).URL()
+	return NewResolvedImage(i.url+":"+tag, i.registry, i.cache, i.logger).URL(ctx)
 }
@@ -4,7 +4,10 @@
 package image
 
 import (
+	"context"
+
 	ctlconf "carvel.dev/kbld/pkg/kbld/config"
+	ctllog "carvel.dev/kbld/pkg/kbld/logger"
 	ctlreg "carvel.dev/kbld/pkg/kbld/registry"
 	regname "github.com/google/go-containerregistry/pkg/name"
 )
@@ -14,14 +17,17 @@ type TaggedImage struct {
 	image    Image
 	imgDst   ctlconf.ImageDestination
 	registry ctlreg.Registry
+	logger   ctllog.Logger
 }
 
-func NewTaggedImage(image Image, imgDst ctlconf.ImageDestination, registry ctlreg.Registry) TaggedImage {
-	return TaggedImage{image, imgDst, registry}
+func NewTaggedImage(image Image, imgDst ctlconf.ImageDestination,
+	registry ctlreg.Registry, logger ctllog.Logger) TaggedImage {
+
+	return TaggedImage{image, imgDst, registry, logger}
 }
 
-func (i TaggedImage) URL() (string, []ctlconf.Origin, error) {
-	url, origins, err := i.image.URL()
+func (i TaggedImage) URL(ctx context.Context) (string, []ctlconf.Origin, error) {
+	url, origins, err := i.image.URL(ctx)
 	if err != nil {
 		return "", nil, err
 	}
@@ -40,10 +46,14 @@ func (i TaggedImage) URL() (string, []ctlconf.Origin, error) {
 		}
 
 		for _, tag := range i.imgDst.Tags {
-			err := i.registry.WriteTag(dstRef.Context().Tag(tag), srcRef)
+			tagRef := dstRef.Context().Tag(tag)
+
+			err := i.registry.WriteTag(ctx, tagRef, srcRef)
 			if err != nil {
 				return "", nil, err
 			}
+
+			i.logger.Event(ctllog.Event{Type: ctllog.EventTagWritten, Image: url, URL: tagRef.Name()})
 		}
 
 		origins = append(origins, ctlconf.Origin{Tagged: &ctlconf.OriginTagged{Tags: i.imgDst.Tags}})
@@ -0,0 +1,43 @@
+// Copyright 2024 The Carvel Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package image
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	ctlconf "carvel.dev/kbld/pkg/kbld/config"
+)
+
+// TimeoutImage limits how long wrapped image is allowed to take
+// to produce its URL (zero timeout means no limit)
+type TimeoutImage struct {
+	image   Image
+	timeout time.Duration
+	desc    string
+}
+
+var _ Image = TimeoutImage{}
+
+func NewTimeoutImage(image Image, timeout time.Duration, desc string) TimeoutImage {
+	return TimeoutImage{image, timeout, desc}
+}
+
+func (i TimeoutImage) URL(ctx context.Context) (string, []ctlconf.Origin, error) {
+	if i.timeout <= 0 {
+		return i.image.URL(ctx)
+	}
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, i.timeout)
+	defer cancel()
+
+	url, origins, err := i.image.URL(timeoutCtx)
+	if err != nil && errors.Is(timeoutCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil {
+		return "", nil, fmt.Errorf("Timed out %s after %s: %s", i.desc, i.timeout, err)
+	}
+
+	return url, origins, err
+}
@@ -0,0 +1,48 @@
+// Copyright 2024 The Carvel Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package image_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	ctlconf "carvel.dev/kbld/pkg/kbld/config"
+	ctlimg "carvel.dev/kbld/pkg/kbld/image"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type blockingImage struct{}
+
+func (blockingImage) URL(ctx context.Context) (string, []ctlconf.Origin, error) {
+	<-ctx.Done()
+	return "", nil, ctx.Err()
+}
+
+func TestTimeoutImageTimesOut(t *testing.T) {
+	subject := ctlimg.NewTimeoutImage(blockingImage{}, 10*time.Millisecond, "resolving")
+
+	_, _, err := subject.URL(context.Background())
+	require.Error(t, err)
+	assert.Equal(t, "Timed out resolving after 10ms: context deadline exceeded", err.Error())
+}
+
+func TestTimeoutImageReturnsParentCancellation(t *testing.T) {
+	subject := ctlimg.NewTimeoutImage(blockingImage{}, time.Hour, "resolving")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, _, err := subject.URL(ctx)
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestTimeoutImageWithoutTimeout(t *testing.T) {
+	subject := ctlimg.NewTimeoutImage(ctlimg.NewPreresolvedImage("nginx@sha256:9999", nil), 0, "resolving")
+
+	url, _, err := subject.URL(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "nginx@sha256:9999", url)
+}
@@ -4,6 +4,7 @@
 package imagedesc
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -20,9 +21,9 @@ import (
 )
 
 type Registry interface {
-	Generic(regname.Reference) (regv1.Descriptor, error)
-	Index(regname.Reference) (regv1.ImageIndex, error)
-	Image(regname.Reference) (regv1.Image, error)
+	Generic(context.Context, regname.Reference) (regv1.Descriptor, error)
+	Index(context.Context, regname.Reference) (regv1.ImageIndex, error)
+	Image(context.Context, regname.Reference) (regv1.Image, error)
 }
 
 type ImageRefDescriptors struct {
@@ -45,7 +46,7 @@ func NewImageRefDescriptorsFromBytes(data []byte) (*ImageRefDescriptors, error)
 	return &ImageRefDescriptors{descs: descs}, nil
 }
 
-func NewImageRefDescriptors(refs []regname.Reference, registry Registry) (*ImageRefDescriptors, error) {
+func NewImageRefDescriptors(ctx context.Context, refs []regname.Reference, registry Registry) (*ImageRefDescriptors, error) {
 	registry = errRegistry{registry}
 
 	imageRefDescs := &ImageRefDescriptors{
@@ -64,7 +65,7 @@ func NewImageRefDescriptors(refs []regname.Reference, registry Registry) (*Image
 			buildThrottle.Take()
 			defer buildThrottle.Done()
 
-			regDesc, err := registry.Generic(ref)
+			regDesc, err := registry.Generic(ctx, ref)
 			if err != nil {
 				return err
 			}
@@ -72,13 +73,13 @@ func NewImageRefDescriptors(refs []regname.Reference, registry Registry) (*Image
 			var td ImageOrImageIndexDescriptor
 
 			if imageRefDescs.isImageIndex(regDesc) {
-				imgIndexTd, err := imageRefDescs.buildImageIndex(ref, regDesc)
+				imgIndexTd, err := imageRefDescs.buildImageIndex(ctx, ref, regDesc)
 				if err != nil {
 					return err
 				}
 				td = ImageOrImageIndexDescriptor{ImageIndex: &imgIndexTd}
 			} else {
-				imgTd, err := imageRefDescs.buildImage(ref)
+				imgTd, err := imageRefDescs.buildImage(ctx, ref)
 				if err != nil {
 					return err
 				}
@@ -102,14 +103,14 @@ func (ids *ImageRefDescriptors) Descriptors() []ImageOrImageIndexDescriptor {
 	return ids.descs
 }
 
-func (ids *ImageRefDescriptors) buildImageIndex(ref regname.Reference, regDesc regv1.Descriptor) (ImageIndexDescriptor, error) {
+func (ids *ImageRefDescriptors) buildImageIndex(ctx context.Context, ref regname.Reference, regDesc regv1.Descriptor) (ImageIndexDescriptor, error) {
 	td := ImageIndexDescriptor{
 		Refs:      []string{ref.Name()},
 		MediaType: string(regDesc.MediaType),
 		Digest:    regDesc.Digest.String(),
 	}
 
-	imgIndex, err := ids.registry.Index(ref)
+	imgIndex, err := ids.registry.Index(ctx, ref)
 	if err != nil {
 		return td, err
 	}
@@ -128,13 +129,13 @@ func (ids *ImageRefDescriptors) buildImageIndex(ref regname.Reference, regDesc r
 
 	for _, manDesc := range imgIndexManifest.Manifests {
 		if ids.isImageIndex(manDesc) {
-			imgIndexTd, err := ids.buildImageIndex(ids.buildRef(ref, manDesc.Digest.String()), manDesc)
+			imgIndexTd, err := ids.buildImageIndex(ctx, ids.buildRef(ref, manDesc.Digest.String()), manDesc)
 			if err != nil {
 				return ImageIndexDescriptor{}, err
 			}
 			td.Indexes = append(td.Indexes, imgIndexTd)
 		} else {
-			imgTd, err := ids.buildImage(ids.buildRef(ref, manDesc.Digest.String()))
+			imgTd, err := ids.buildImage(ctx, ids.buildRef(ref, manDesc.Digest.String()))
 			if err != nil {
 				return ImageIndexDescriptor{}, err
 			}
@@ -145,10 +146,10 @@ func (ids *ImageRefDescriptors) buildImageIndex(ref regname.Reference, regDesc r
 	return td, nil
 }
 
-func (ids *ImageRefDescriptors) buildImage(ref regname.Reference) (ImageDescriptor, error) {
+func (ids *ImageRefDescriptors) buildImage(ctx context.Context, ref regname.Reference) (ImageDescriptor, error) {
 	td := ImageDescriptor{}
 
-	img, err := ids.registry.Image(ref)
+	img, err := ids.registry.Image(ctx, ref)
 	if err != nil {
 		return td, err
 	}
@@ -285,18 +286,18 @@ type errRegistry struct {
 	delegate Registry
 }
 
-func (m errRegistry) Generic(ref regname.Reference) (regv1.Descriptor, error) {
-	regDesc, err := m.delegate.Generic(ref)
+func (m errRegistry) Generic(ctx context.Context, ref regname.Reference) (regv1.Descriptor, error) {
+	regDesc, err := m.delegate.Generic(ctx, ref)
 	return regDesc, m.betterErr(ref, err)
 }
 
-func (m errRegistry) Index(ref regname.Reference) (regv1.ImageIndex, error) {
-	idx, err := m.delegate.Index(ref)
+func (m errRegistry) Index(ctx context.Context, ref regname.Reference) (regv1.ImageIndex, error) {
+	idx, err := m.delegate.Index(ctx, ref)
 	return idx, m.betterErr(ref, err)
 }
 
-func (m errRegistry) Image(ref regname.Reference) (regv1.Image, error) {
-	img, err := m.delegate.Image(ref)
+func (m errRegistry) Image(ctx context.Context, ref regname.Reference) (regv1.Image, error) {
+	img, err := m.delegate.Image(ctx, ref)
 	return img, m.betterErr(ref, err)
 }
 
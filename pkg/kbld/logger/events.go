@@ -0,0 +1,125 @@
+// Copyright 2024 The Carvel Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+type Format string
+
+const (
+	FormatText Format = "text"
+	FormatJSON Format = "json"
+)
+
+func NewFormat(str string) (Format, error) {
+	switch Format(str) {
+	case FormatText, FormatJSON:
+		return Format(str), nil
+	default:
+		return "", fmt.Errorf("Expected log format to be one of 'text' or 'json', but was '%s'", str)
+	}
+}
+
+type EventType string
+
+const (
+	EventLog             EventType = "log"
+	EventResolveStart    EventType = "resolve-start"
+	EventResolveFinished EventType = "resolve-finished"
+	EventBuildStart      EventType = "build-start"
+	EventBuildOutput     EventType = "build-output"
+	EventBuildFinished   EventType = "build-finished"
+	EventPushStart       EventType = "push-start"
+	EventPushFinished    EventType = "push-finished"
+	EventTagWritten      EventType = "tag-written"
+	EventFinalMapping    EventType = "final-mapping"
+	EventRegistryRetry   EventType = "registry-retry"
+)
+
+// Event is emitted as a single JSON line when JSON log format is used
+type Event struct {
+	Type EventType `json:"type"`
+	Time time.Time `json:"time"`
+
+	// Source is set for free-form log lines (e.g. resolve)
+	Source  string `json:"source,omitempty"`
+	Image   string `json:"image,omitempty"`
+	URL     string `json:"url,omitempty"`
+	Builder string `json:"builder,omitempty"`
+	Message string `json:"message,omitempty"`
+	Error   string `json:"error,omitempty"`
+
+	Duration   time.Duration `json:"-"`
+	DurationMs int64         `json:"durationMs,omitempty"`
+}
+
+// StartedEvent helps to emit a matching finish event with a duration
+type StartedEvent struct {
+	logger    Logger
+	event     Event
+	startTime time.Time
+}
+
+// Event emits event only when JSON log format is used
+// since text format is already covered by prefixed writers
+func (l Logger) Event(ev Event) {
+	if l.format != FormatJSON {
+		return
+	}
+	// Logging should never fail the operation
+	_ = l.writeEvent(ev)
+}
+
+func (l Logger) StartEvent(ev Event) StartedEvent {
+	started := StartedEvent{l, ev, time.Now()}
+	l.Event(ev)
+	return started
+}
+
+func (e StartedEvent) Finish(eventType EventType) {
+	e.FinishWith(eventType, "", nil)
+}
+
+func (e StartedEvent) FinishWith(eventType EventType, url string, err error) {
+	ev := e.event
+	ev.Type = eventType
+	ev.Duration = time.Since(e.startTime)
+	if len(url) > 0 {
+		ev.URL = url
+	}
+	if err != nil {
+		ev.Error = err.Error()
+	}
+	e.logger.Event(ev)
+}
+
+func (l Logger) writeEvent(ev Event) error {
+	if ev.Time.IsZero() {
+		ev.Time = time.Now().UTC()
+	}
+	if ev.Duration > 0 {
+		ev.DurationMs = ev.Duration.Milliseconds()
+	}
+
+	ev.Message = l.redact(ev.Message)
+	ev.Error = l.redact(ev.Error)
+
+	bs, err := json.Marshal(ev)
+	if err != nil {
+		return fmt.Errorf("Marshaling event: %s", err)
+	}
+
+	l.writerLock.Lock()
+	defer l.writerLock.Unlock()
+
+	_, err = l.writer.Write(append(bs, '\n'))
+	if err != nil {
+		return fmt.Errorf("write err: %s", err)
+	}
+	return nil
+}
@@ -7,31 +7,110 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"strings"
 	"sync"
 )
 
+const (
+	// Incomplete lines longer than this (e.g. progress output
+	// without line breaks) are written out without waiting for line end
+	maxPendingLineSize = 64 * 1024
+)
+
 type Logger struct {
 	writer     io.Writer
 	writerLock *sync.Mutex
+	format     Format
+	redactions []string
 }
 
 func NewLogger(writer io.Writer) Logger {
-	return Logger{writer: writer, writerLock: &sync.Mutex{}}
+	return NewLoggerWithFormat(writer, FormatText)
+}
+
+func NewLoggerWithFormat(writer io.Writer, format Format) Logger {
+	return Logger{writer: writer, writerLock: &sync.Mutex{}, format: format}
 }
 
 func (l Logger) NewPrefixedWriter(prefix string) *PrefixWriter {
-	return &PrefixWriter{prefix, l.writer, l.writerLock}
+	return &PrefixWriter{prefix, l.writer, l.writerLock, l,
+		Event{Type: EventLog, Source: strings.TrimSuffix(prefix, " | ")}, nil, &sync.Mutex{}}
+}
+
+// NewEventWriter returns writer that emits each written line as an event of given type
+// (in text format it behaves same as writer prefixed with image)
+func (l Logger) NewEventWriter(eventType EventType, image string) *PrefixWriter {
+	return &PrefixWriter{image + " | ", l.writer, l.writerLock, l,
+		Event{Type: eventType, Image: image}, nil, &sync.Mutex{}}
 }
 
 type PrefixWriter struct {
 	prefix     string
 	writer     io.Writer
 	writerLock *sync.Mutex
+
+	logger    Logger
+	lineEvent Event
+
+	// Incomplete line is held back when redactions are configured
+	// so that values split across multiple writes are still redacted
+	pending     []byte
+	pendingLock *sync.Mutex
 }
 
 func (w *PrefixWriter) Write(data []byte) (int, error) {
-	newData := make([]byte, len(data))
-	copy(newData, data)
+	if len(w.logger.redactions) == 0 {
+		return w.write(data)
+	}
+
+	w.pendingLock.Lock()
+	defer w.pendingLock.Unlock()
+
+	w.pending = append(w.pending, data...)
+
+	completeIdx := bytes.LastIndexByte(w.pending, '\n') + 1
+	if completeIdx == 0 && len(w.pending) > maxPendingLineSize {
+		completeIdx = len(w.pending)
+	}
+	if completeIdx == 0 {
+		return len(data), nil
+	}
+
+	completeData := w.pending[:completeIdx]
+	w.pending = append([]byte{}, w.pending[completeIdx:]...)
+
+	_, err := w.write(completeData)
+	if err != nil {
+		return 0, err
+	}
+
+	// return original data length
+	return len(data), nil
+}
+
+// Flush writes out incomplete line held back for redaction
+// (should be called once writing is done, e.g. after build finishes)
+func (w *PrefixWriter) Flush() error {
+	w.pendingLock.Lock()
+	defer w.pendingLock.Unlock()
+
+	if len(w.pending) == 0 {
+		return nil
+	}
+
+	data := w.pending
+	w.pending = nil
+
+	_, err := w.write(data)
+	return err
+}
+
+func (w *PrefixWriter) write(data []byte) (int, error) {
+	if w.logger.format == FormatJSON {
+		return w.writeEvents(data)
+	}
+
+	newData := []byte(w.logger.redact(string(data)))
 
 	endsWithNl := bytes.HasSuffix(newData, []byte("\n"))
 	if endsWithNl {
@@ -54,6 +133,22 @@ func (w *PrefixWriter) Write(data []byte) (int, error) {
 	return len(data), nil
 }
 
+func (w *PrefixWriter) writeEvents(data []byte) (int, error) {
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+
+	for _, line := range lines {
+		ev := w.lineEvent
+		ev.Message = line
+
+		err := w.logger.writeEvent(ev)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(data), nil
+}
+
 func (w *PrefixWriter) WriteStr(str string, args ...interface{}) error {
 	_, err := w.Write([]byte(fmt.Sprintf(str, args...)))
 	return err
@@ -5,9 +5,14 @@ package logger_test
 
 import (
 	"bytes"
+	"encoding/json"
+	"strings"
 	"testing"
+	"time"
 
 	ctllog "carvel.dev/kbld/pkg/kbld/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestLogger(t *testing.T) {
@@ -41,3 +46,97 @@ prefix:
 		t.Fatalf("Expected >>>%s<<< to match >>>%s<<<", out, expectedOut)
 	}
 }
+
+func TestLoggerJSONFormat(t *testing.T) {
+	var buf bytes.Buffer
+
+	logger := ctllog.NewLoggerWithFormat(&buf, ctllog.FormatJSON)
+
+	logger.NewPrefixedWriter("resolve | ").Write([]byte("content1\ncontent2\n"))
+	logger.NewEventWriter(ctllog.EventBuildOutput, "app").Write([]byte("step 1\n"))
+	logger.Event(ctllog.Event{Type: ctllog.EventFinalMapping, Image: "app", URL: "app@sha256:aaa", Duration: 1500 * time.Millisecond})
+
+	var events []map[string]interface{}
+
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n") {
+		var event map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(line), &event))
+		require.NotEmpty(t, event["time"])
+		delete(event, "time")
+		events = append(events, event)
+	}
+
+	expectedEvents := []map[string]interface{}{
+		{"type": "log", "source": "resolve", "message": "content1"},
+		{"type": "log", "source": "resolve", "message": "content2"},
+		{"type": "build-output", "image": "app", "message": "step 1"},
+		{"type": "final-mapping", "image": "app", "url": "app@sha256:aaa", "durationMs": float64(1500)},
+	}
+
+	assert.Equal(t, expectedEvents, events)
+}
+
+func TestLoggerTextFormatSkipsEvents(t *testing.T) {
+	var buf bytes.Buffer
+
+	logger := ctllog.NewLogger(&buf)
+	logger.Event(ctllog.Event{Type: ctllog.EventFinalMapping, Image: "app"})
+	logger.NewEventWriter(ctllog.EventBuildOutput, "app").Write([]byte("step 1\n"))
+
+	assert.Equal(t, "app | step 1\n", buf.String())
+}
+
+func TestLoggerRedactions(t *testing.T) {
+	t.Run("text format", func(t *testing.T) {
+		var buf bytes.Buffer
+
+		logger := ctllog.NewLogger(&buf).WithRedactions([]string{"s3cr3t", ""})
+		logger.NewPrefixedWriter("app | ").Write([]byte("token=s3cr3t\nother s3cr3t\n"))
+
+		assert.Equal(t, "app | token=<redacted>\napp | other <redacted>\n", buf.String())
+	})
+
+	t.Run("json format", func(t *testing.T) {
+		var buf bytes.Buffer
+
+		logger := ctllog.NewLoggerWithFormat(&buf, ctllog.FormatJSON).WithRedactions([]string{"s3cr3t"})
+		logger.NewEventWriter(ctllog.EventBuildOutput, "app").Write([]byte("token=s3cr3t\n"))
+
+		var ev ctllog.Event
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &ev))
+		assert.Equal(t, "token=<redacted>", ev.Message)
+	})
+}
+
+func TestLoggerRedactionsAcrossWrites(t *testing.T) {
+	t.Run("text format", func(t *testing.T) {
+		var buf bytes.Buffer
+
+		logger := ctllog.NewLogger(&buf).WithRedactions([]string{"s3cr3t"})
+		writer := logger.NewPrefixedWriter("app | ")
+
+		writer.Write([]byte("token=s3c"))
+		assert.Equal(t, "", buf.String())
+
+		writer.Write([]byte("r3t\nother s3"))
+		writer.Write([]byte("cr3t"))
+		assert.Equal(t, "app | token=<redacted>\n", buf.String())
+
+		require.NoError(t, writer.Flush())
+		assert.Equal(t, "app | token=<redacted>\napp | other <redacted>\n", buf.String())
+	})
+
+	t.Run("json format", func(t *testing.T) {
+		var buf bytes.Buffer
+
+		logger := ctllog.NewLoggerWithFormat(&buf, ctllog.FormatJSON).WithRedactions([]string{"s3cr3t"})
+		writer := logger.NewEventWriter(ctllog.EventBuildOutput, "app")
+
+		writer.Write([]byte("token=s3c"))
+		writer.Write([]byte("r3t\n"))
+
+		var ev ctllog.Event
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &ev))
+		assert.Equal(t, "token=<redacted>", ev.Message)
+	})
+}
@@ -0,0 +1,40 @@
+// Copyright 2024 The Carvel Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package logger
+
+import (
+	"strings"
+)
+
+const (
+	RedactedValue = "<redacted>"
+)
+
+// WithRedactions returns logger that replaces given values
+// (e.g. build secrets) in all of its output
+func (l Logger) WithRedactions(values []string) Logger {
+	var redactions []string
+	redactions = append(redactions, l.redactions...)
+	for _, val := range values {
+		if len(val) > 0 {
+			redactions = append(redactions, val)
+		}
+	}
+	l.redactions = redactions
+	return l
+}
+
+func (l Logger) redact(str string) string {
+	return Redact(str, l.redactions)
+}
+
+// Redact replaces all occurrences of given values in a string
+func Redact(str string, values []string) string {
+	for _, val := range values {
+		if len(val) > 0 {
+			str = strings.ReplaceAll(str, val, RedactedValue)
+		}
+	}
+	return str
+}
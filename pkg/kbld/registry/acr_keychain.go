@@ -0,0 +1,161 @@
+// Copyright 2024 The Carvel Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+const (
+	// ACR expects this username when refresh token is used as a password
+	acrUsername             = "00000000-0000-0000-0000-000000000000"
+	acrResource             = "https://management.azure.com/"
+	acrDefaultAuthorityHost = "https://login.microsoftonline.com/"
+	acrDefaultIMDSHost      = "http://169.254.169.254"
+)
+
+var (
+	acrRegistrySuffixes = []string{".azurecr.io", ".azurecr.cn", ".azurecr.us"}
+)
+
+// acrProvider provides refresh tokens for Azure Container Registry
+// by exchanging Microsoft Entra ID access token obtained from (in order):
+//   - workload identity token file (AZURE_FEDERATED_TOKEN_FILE, AZURE_CLIENT_ID, AZURE_TENANT_ID)
+//   - service principal secret (AZURE_CLIENT_SECRET, AZURE_CLIENT_ID, AZURE_TENANT_ID)
+//   - managed identity via instance metadata (AZURE_CLIENT_ID optionally selects identity)
+//
+// AZURE_AUTHORITY_HOST and AZURE_POD_IDENTITY_AUTHORITY_HOST override token endpoints.
+type acrProvider struct {
+	client cloudHTTPClient
+}
+
+func (acrProvider) Matches(registry string) bool {
+	hostname := registryHostname(registry)
+	for _, suffix := range acrRegistrySuffixes {
+		if strings.HasSuffix(hostname, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p acrProvider) Token(ctx context.Context, registry string) (cloudToken, error) {
+	aadToken, err := p.aadToken(ctx)
+	if err != nil {
+		return cloudToken{}, err
+	}
+
+	form := url.Values{
+		"grant_type":   {"access_token"},
+		"service":      {registry},
+		"access_token": {aadToken.AccessToken},
+	}
+	if tenantID := os.Getenv("AZURE_TENANT_ID"); len(tenantID) > 0 {
+		form.Set("tenant", tenantID)
+	}
+
+	bs, err := p.client.PostForm(ctx, "https://"+registry+"/oauth2/exchange", form)
+	if err != nil {
+		return cloudToken{}, fmt.Errorf("Exchanging access token for registry refresh token: %s", err)
+	}
+
+	var resp struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	err = json.Unmarshal(bs, &resp)
+	if err != nil {
+		return cloudToken{}, fmt.Errorf("Unmarshaling registry refresh token: %s", err)
+	}
+
+	// Refresh token outlives access token it was exchanged for
+	return cloudToken{Username: acrUsername, Password: resp.RefreshToken, ExpiresAt: aadToken.ExpiresAt()}, nil
+}
+
+func (p acrProvider) aadToken(ctx context.Context) (oauthToken, error) {
+	clientID := os.Getenv("AZURE_CLIENT_ID")
+	tenantID := os.Getenv("AZURE_TENANT_ID")
+
+	form := url.Values{
+		"grant_type": {"client_credentials"},
+		"client_id":  {clientID},
+		"scope":      {acrResource + ".default"},
+	}
+
+	switch {
+	case len(os.Getenv("AZURE_FEDERATED_TOKEN_FILE")) > 0 && len(clientID) > 0 && len(tenantID) > 0:
+		assertion, err := os.ReadFile(os.Getenv("AZURE_FEDERATED_TOKEN_FILE"))
+		if err != nil {
+			return oauthToken{}, fmt.Errorf("Reading federated token file: %s", err)
+		}
+		form.Set("client_assertion_type", "urn:ietf:params:oauth:client-assertion-type:jwt-bearer")
+		form.Set("client_assertion", strings.TrimSpace(string(assertion)))
+
+	case len(os.Getenv("AZURE_CLIENT_SECRET")) > 0 && len(clientID) > 0 && len(tenantID) > 0:
+		form.Set("client_secret", os.Getenv("AZURE_CLIENT_SECRET"))
+
+	default:
+		return p.managedIdentityToken(ctx, clientID)
+	}
+
+	authorityHost := os.Getenv("AZURE_AUTHORITY_HOST")
+	if len(authorityHost) == 0 {
+		authorityHost = acrDefaultAuthorityHost
+	}
+
+	bs, err := p.client.PostForm(ctx, strings.TrimSuffix(authorityHost, "/")+"/"+tenantID+"/oauth2/v2.0/token", form)
+	if err != nil {
+		return oauthToken{}, fmt.Errorf("Getting access token: %s", err)
+	}
+
+	var token oauthToken
+
+	err = json.Unmarshal(bs, &token)
+	if err != nil {
+		return oauthToken{}, fmt.Errorf("Unmarshaling access token: %s", err)
+	}
+
+	return token, nil
+}
+
+func (p acrProvider) managedIdentityToken(ctx context.Context, clientID string) (oauthToken, error) {
+	host := os.Getenv("AZURE_POD_IDENTITY_AUTHORITY_HOST")
+	if len(host) == 0 {
+		host = acrDefaultIMDSHost
+	}
+
+	query := url.Values{
+		"api-version": {"2018-02-01"},
+		"resource":    {acrResource},
+	}
+	if len(clientID) > 0 {
+		query.Set("client_id", clientID)
+	}
+
+	ctx, cancel := withMetadataTimeout(ctx)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		strings.TrimSuffix(host, "/")+"/metadata/identity/oauth2/token?"+query.Encode(), nil)
+	if err != nil {
+		return oauthToken{}, err
+	}
+	req.Header.Set("Metadata", "true")
+
+	var token oauthToken
+
+	err = p.client.DoJSON(req, &token)
+	if err != nil {
+		return oauthToken{}, fmt.Errorf("Getting managed identity token "+
+			"(no service principal or workload identity found in env variables): %s", err)
+	}
+
+	return token, nil
+}
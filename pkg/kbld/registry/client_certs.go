@@ -0,0 +1,106 @@
+// Copyright 2024 The Carvel Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package registry
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+
+	regname "github.com/google/go-containerregistry/pkg/name"
+)
+
+// ClientCertPaths points to PEM encoded client certificate and its key
+type ClientCertPaths struct {
+	CertPath string
+	KeyPath  string
+}
+
+func (p ClientCertPaths) IsEmpty() bool { return len(p.CertPath) == 0 && len(p.KeyPath) == 0 }
+
+func (p ClientCertPaths) load() (*tls.Certificate, error) {
+	if len(p.CertPath) == 0 || len(p.KeyPath) == 0 {
+		return nil, fmt.Errorf("Expected both client certificate and key to be specified")
+	}
+
+	cert, err := tls.LoadX509KeyPair(p.CertPath, p.KeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("Loading client certificate from '%s' and key from '%s': %s", p.CertPath, p.KeyPath, err)
+	}
+
+	return &cert, nil
+}
+
+// clientCerts provides certificates for registries requiring mutual TLS.
+// Registry specific certificate takes precedence over default one.
+type clientCerts struct {
+	byHostname map[string]*tls.Certificate
+	fallback   *tls.Certificate
+}
+
+func newClientCerts(opts Opts) (clientCerts, error) {
+	certs := clientCerts{byHostname: map[string]*tls.Certificate{}}
+
+	if !opts.ClientCert.IsEmpty() {
+		cert, err := opts.ClientCert.load()
+		if err != nil {
+			return clientCerts{}, err
+		}
+		certs.fallback = cert
+	}
+
+	pathsByHostname, err := NewEnvKeychain(opts.EnvAuthPrefix).ClientCertPaths()
+	if err != nil {
+		return clientCerts{}, err
+	}
+
+	for hostname, paths := range pathsByHostname {
+		cert, err := paths.load()
+		if err != nil {
+			return clientCerts{}, fmt.Errorf("Preparing client certificate for registry '%s': %s", hostname, err)
+		}
+		certs.byHostname[hostname] = cert
+	}
+
+	return certs, nil
+}
+
+func (c clientCerts) IsEmpty() bool { return c.fallback == nil && len(c.byHostname) == 0 }
+
+// GetClientCertificate is used during TLS handshake only when server requests
+// client certificate. Hostname is carried via handshake context (see clientCertsTransport).
+func (c clientCerts) GetClientCertificate(info *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	if hostname, ok := info.Context().Value(clientCertHostnameKey{}).(string); ok {
+		if cert, found := c.byHostname[hostname]; found {
+			return cert, nil
+		}
+	}
+	if c.fallback != nil {
+		return c.fallback, nil
+	}
+	// Empty certificate indicates that none is available
+	return &tls.Certificate{}, nil
+}
+
+type clientCertHostnameKey struct{}
+
+// clientCertsTransport records request's registry hostname so that
+// matching client certificate could be selected during TLS handshake
+// (connections are pooled per host, hence they are not shared between registries)
+type clientCertsTransport struct {
+	http.RoundTripper
+}
+
+func (t clientCertsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	hostname := req.URL.Host
+
+	// Normalize hostname the same way env keychain does (e.g. docker.io)
+	if registry, err := regname.NewRegistry(hostname, regname.WeakValidation); err == nil {
+		hostname = registry.RegistryStr()
+	}
+
+	ctx := context.WithValue(req.Context(), clientCertHostnameKey{}, hostname)
+	return t.RoundTripper.RoundTrip(req.WithContext(ctx))
+}
@@ -0,0 +1,159 @@
+// Copyright 2024 The Carvel Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package registry_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	ctlreg "carvel.dev/kbld/pkg/kbld/registry"
+	regname "github.com/google/go-containerregistry/pkg/name"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistryClientCerts(t *testing.T) {
+	tmpDir := t.TempDir()
+	caCert, caKey := generateCert(t, nil, nil)
+
+	clientCertPath := filepath.Join(tmpDir, "client.pem")
+	clientKeyPath := filepath.Join(tmpDir, "client-key.pem")
+	writeCert(t, clientCertPath, clientKeyPath, caCert, caKey)
+
+	var manifestRequests int32
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "/manifests/") {
+			atomic.AddInt32(&manifestRequests, 1)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(caCert)
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	server.StartTLS()
+	defer server.Close()
+
+	hostname := strings.TrimPrefix(server.URL, "https://")
+
+	reachesRegistry := func(opts ctlreg.Opts) bool {
+		t.Helper()
+
+		opts.EnvAuthPrefix = "KBLD_TEST_REGISTRY"
+		opts.VerifyCerts = false
+
+		registry, err := ctlreg.NewRegistry(opts)
+		require.NoError(t, err)
+
+		ref, err := regname.NewTag(hostname + "/app:v1")
+		require.NoError(t, err)
+
+		before := atomic.LoadInt32(&manifestRequests)
+		_, err = registry.Generic(context.Background(), ref)
+		require.Error(t, err)
+
+		return atomic.LoadInt32(&manifestRequests) > before
+	}
+
+	t.Run("without client certificate", func(t *testing.T) {
+		assert.False(t, reachesRegistry(ctlreg.Opts{}))
+	})
+
+	t.Run("with default client certificate", func(t *testing.T) {
+		assert.True(t, reachesRegistry(ctlreg.Opts{
+			ClientCert: ctlreg.ClientCertPaths{CertPath: clientCertPath, KeyPath: clientKeyPath},
+		}))
+	})
+
+	t.Run("with registry specific client certificate", func(t *testing.T) {
+		t.Setenv("KBLD_TEST_REGISTRY_HOSTNAME_0", hostname)
+		t.Setenv("KBLD_TEST_REGISTRY_CLIENT_CERT_0", clientCertPath)
+		t.Setenv("KBLD_TEST_REGISTRY_CLIENT_KEY_0", clientKeyPath)
+
+		assert.True(t, reachesRegistry(ctlreg.Opts{}))
+	})
+
+	t.Run("with client certificate for other registry", func(t *testing.T) {
+		t.Setenv("KBLD_TEST_REGISTRY_HOSTNAME_0", "other.example.com")
+		t.Setenv("KBLD_TEST_REGISTRY_CLIENT_CERT_0", clientCertPath)
+		t.Setenv("KBLD_TEST_REGISTRY_CLIENT_KEY_0", clientKeyPath)
+
+		assert.False(t, reachesRegistry(ctlreg.Opts{}))
+	})
+}
+
+func TestRegistryClientCertsRequireKey(t *testing.T) {
+	_, err := ctlreg.NewRegistry(ctlreg.Opts{
+		EnvAuthPrefix: "KBLD_TEST_REGISTRY",
+		ClientCert:    ctlreg.ClientCertPaths{CertPath: "/tmp/cert.pem"},
+	})
+	require.Error(t, err)
+	assert.Equal(t, "Expected both client certificate and key to be specified", err.Error())
+
+	t.Setenv("KBLD_TEST_REGISTRY_CLIENT_CERT", "/tmp/cert.pem")
+	t.Setenv("KBLD_TEST_REGISTRY_CLIENT_KEY", "/tmp/key.pem")
+
+	_, err = ctlreg.NewRegistry(ctlreg.Opts{EnvAuthPrefix: "KBLD_TEST_REGISTRY"})
+	require.Error(t, err)
+	assert.Equal(t, "Expected registry hostname to be specified for client certificate '/tmp/cert.pem'", err.Error())
+}
+
+func generateCert(t *testing.T, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "kbld-test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign
+		parent, parentKey = template, key
+	}
+
+	certBs, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(certBs)
+	require.NoError(t, err)
+
+	return cert, key
+}
+
+func writeCert(t *testing.T, certPath, keyPath string, caCert *x509.Certificate, caKey *ecdsa.PrivateKey) {
+	cert, key := generateCert(t, caCert, caKey)
+
+	keyBs, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	err = os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}), 0600)
+	require.NoError(t, err)
+
+	err = os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyBs}), 0600)
+	require.NoError(t, err)
+}
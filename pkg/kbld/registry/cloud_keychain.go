@@ -0,0 +1,225 @@
+// Copyright 2024 The Carvel Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package registry
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	regauthn "github.com/google/go-containerregistry/pkg/authn"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	CloudKeychainECR = "ecr"
+	CloudKeychainGCR = "gcr"
+	CloudKeychainACR = "acr"
+
+	cloudKeychainTimeout = 30 * time.Second
+	// Metadata endpoints are not reachable outside of cloud environments
+	cloudMetadataTimeout = 5 * time.Second
+	// Tokens are refreshed slightly before they expire
+	cloudTokenExpiryLeeway = 5 * time.Minute
+)
+
+var (
+	CloudKeychainNames = []string{CloudKeychainECR, CloudKeychainGCR, CloudKeychainACR}
+)
+
+type cloudToken struct {
+	Username  string
+	Password  string
+	ExpiresAt time.Time // zero if unknown
+}
+
+type cloudProvider interface {
+	Matches(registry string) bool
+	Token(ctx context.Context, registry string) (cloudToken, error)
+}
+
+// CloudKeychain derives registry credentials from cloud provider
+// credentials found in environment (env variables, credential files,
+// workload identity token files or instance metadata)
+type CloudKeychain struct {
+	name     string
+	provider cloudProvider
+	ctx      context.Context
+
+	tokens       map[string]cloudToken
+	tokensMux    *sync.Mutex
+	tokenFetches *singleflight.Group
+}
+
+var _ regauthn.Keychain = CloudKeychain{}
+
+func NewCloudKeychain(name string, httpClient *http.Client) (CloudKeychain, error) {
+	client := cloudHTTPClient{httpClient}
+
+	var provider cloudProvider
+
+	switch name {
+	case CloudKeychainECR:
+		provider = ecrProvider{client}
+	case CloudKeychainGCR:
+		provider = gcrProvider{client}
+	case CloudKeychainACR:
+		provider = acrProvider{client}
+	default:
+		return CloudKeychain{}, fmt.Errorf("Expected registry keychain '%s' to be one of: %s",
+			name, strings.Join(CloudKeychainNames, ", "))
+	}
+
+	return CloudKeychain{name, provider, context.Background(),
+		map[string]cloudToken{}, &sync.Mutex{}, &singleflight.Group{}}, nil
+}
+
+// WithContext returns keychain (sharing obtained tokens) that uses
+// given context for token requests since regauthn.Keychain does not accept one
+func (k CloudKeychain) WithContext(ctx context.Context) CloudKeychain {
+	k.ctx = ctx
+	return k
+}
+
+func (k CloudKeychain) Resolve(target regauthn.Resource) (regauthn.Authenticator, error) {
+	registry := target.RegistryStr()
+
+	if !k.provider.Matches(registry) {
+		return regauthn.Anonymous, nil
+	}
+
+	token, err := k.token(registry)
+	if err != nil {
+		return nil, fmt.Errorf("Getting %s credentials for registry '%s': %s", strings.ToUpper(k.name), registry, err)
+	}
+
+	return regauthn.FromConfig(regauthn.AuthConfig{Username: token.Username, Password: token.Password}), nil
+}
+
+func (k CloudKeychain) token(registry string) (cloudToken, error) {
+	k.tokensMux.Lock()
+	token, found := k.tokens[registry]
+	k.tokensMux.Unlock()
+
+	if found && token.ExpiresAt.After(time.Now().Add(cloudTokenExpiryLeeway)) {
+		return token, nil
+	}
+
+	// Concurrent requests for the same registry share single token request,
+	// while requests for other registries are not blocked by it
+	resultCh := k.tokenFetches.DoChan(registry, func() (interface{}, error) {
+		token, err := k.provider.Token(k.ctx, registry)
+		if err != nil {
+			return nil, err
+		}
+
+		k.tokensMux.Lock()
+		k.tokens[registry] = token
+		k.tokensMux.Unlock()
+
+		return token, nil
+	})
+
+	select {
+	case <-k.ctx.Done():
+		return cloudToken{}, k.ctx.Err()
+	case result := <-resultCh:
+		if result.Err != nil {
+			return cloudToken{}, result.Err
+		}
+		return result.Val.(cloudToken), nil
+	}
+}
+
+// oauthToken is a response of OAuth 2.0 token endpoints
+type oauthToken struct {
+	AccessToken string `json:"access_token"`
+	// Some endpoints (e.g. Azure IMDS) return number as a string
+	ExpiresIn json.Number `json:"expires_in"`
+}
+
+func (t oauthToken) ExpiresAt() time.Time {
+	secs, err := t.ExpiresIn.Int64()
+	if err != nil || secs <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(time.Duration(secs) * time.Second)
+}
+
+// newCloudKeychainHTTPClient returns client for cloud provider credential endpoints.
+// Registry TLS settings (disabled verification, custom CAs, client certificates)
+// are not meant for these endpoints, hence only system roots are trusted.
+func newCloudKeychainHTTPClient() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{}
+
+	return &http.Client{Transport: transport, Timeout: cloudKeychainTimeout}
+}
+
+type cloudHTTPClient struct {
+	*http.Client
+}
+
+func (c cloudHTTPClient) PostForm(ctx context.Context, endpoint string, form url.Values) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return c.Do(req)
+}
+
+func (c cloudHTTPClient) DoJSON(req *http.Request, out interface{}) error {
+	body, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(body, out)
+	if err != nil {
+		return fmt.Errorf("Unmarshaling response from '%s': %s", c.describeURL(req.URL), err)
+	}
+	return nil
+}
+
+func (c cloudHTTPClient) Do(req *http.Request) ([]byte, error) {
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("Reading response from '%s': %s", c.describeURL(req.URL), err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("Requesting '%s': %s: %s", c.describeURL(req.URL), resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	return body, nil
+}
+
+// describeURL excludes query since it may contain sensitive values
+func (cloudHTTPClient) describeURL(u *url.URL) string {
+	return (&url.URL{Scheme: u.Scheme, Host: u.Host, Path: u.Path}).String()
+}
+
+func withMetadataTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, cloudMetadataTimeout)
+}
+
+func registryHostname(registry string) string {
+	if u, err := url.Parse("//" + registry); err == nil {
+		return u.Hostname()
+	}
+	return registry
+}
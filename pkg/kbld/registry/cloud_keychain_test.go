@@ -0,0 +1,543 @@
+// Copyright 2024 The Carvel Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package registry_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	ctlreg "carvel.dev/kbld/pkg/kbld/registry"
+	regauthn "github.com/google/go-containerregistry/pkg/authn"
+	regname "github.com/google/go-containerregistry/pkg/name"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	cloudEnvKeys = []string{
+		"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN",
+		"AWS_WEB_IDENTITY_TOKEN_FILE", "AWS_ROLE_ARN", "AWS_ROLE_SESSION_NAME",
+		"AWS_CONTAINER_CREDENTIALS_FULL_URI", "AWS_CONTAINER_CREDENTIALS_RELATIVE_URI",
+		"AWS_CONTAINER_AUTHORIZATION_TOKEN", "AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE",
+		"AWS_EC2_METADATA_SERVICE_ENDPOINT", "AWS_ENDPOINT_URL", "AWS_ENDPOINT_URL_ECR", "AWS_ENDPOINT_URL_STS",
+		"GOOGLE_APPLICATION_CREDENTIALS", "GCE_METADATA_HOST",
+		"AZURE_CLIENT_ID", "AZURE_TENANT_ID", "AZURE_CLIENT_SECRET", "AZURE_FEDERATED_TOKEN_FILE",
+		"AZURE_AUTHORITY_HOST", "AZURE_POD_IDENTITY_AUTHORITY_HOST",
+	}
+)
+
+// cloudFakeServer serves all cloud endpoints (all requests are routed to it)
+type cloudFakeServer struct {
+	*httptest.Server
+	t        *testing.T
+	requests int32
+}
+
+func newCloudFakeServer(t *testing.T, handler http.HandlerFunc) *cloudFakeServer {
+	s := &cloudFakeServer{t: t}
+	// Handlers run outside of test goroutine hence must not use require (t.FailNow)
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&s.requests, 1)
+		if !assert.NoError(t, r.ParseForm()) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		handler(w, r)
+	}))
+	t.Cleanup(s.Close)
+
+	// Isolate from credentials that may be present in environment
+	for _, key := range cloudEnvKeys {
+		t.Setenv(key, "")
+	}
+	t.Setenv("CLOUDSDK_CONFIG", t.TempDir())
+
+	return s
+}
+
+func (s *cloudFakeServer) Client() *http.Client {
+	target, err := url.Parse(s.URL)
+	require.NoError(s.t, err)
+
+	return &http.Client{Transport: rewriteHostTransport{target}}
+}
+
+func (s *cloudFakeServer) Resolve(keychainName, registry string) (regauthn.AuthConfig, error) {
+	keychain, err := ctlreg.NewCloudKeychain(keychainName, s.Client())
+	require.NoError(s.t, err)
+
+	return s.resolve(keychain, registry)
+}
+
+func (s *cloudFakeServer) resolve(keychain ctlreg.CloudKeychain, registry string) (regauthn.AuthConfig, error) {
+	reg, err := regname.NewRegistry(registry)
+	require.NoError(s.t, err)
+
+	auth, err := keychain.Resolve(reg)
+	if err != nil {
+		return regauthn.AuthConfig{}, err
+	}
+
+	authConfig, err := auth.Authorization()
+	require.NoError(s.t, err)
+
+	return *authConfig, nil
+}
+
+type rewriteHostTransport struct {
+	target *url.URL
+}
+
+func (t rewriteHostTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme = t.target.Scheme
+	req.URL.Host = t.target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func writeJSON(w http.ResponseWriter, val interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(val)
+}
+
+func TestCloudKeychainUnknownName(t *testing.T) {
+	_, err := ctlreg.NewCloudKeychain("docker", http.DefaultClient)
+	require.Error(t, err)
+	assert.Equal(t, "Expected registry keychain 'docker' to be one of: ecr, gcr, acr", err.Error())
+}
+
+func TestCloudKeychainSkipsOtherRegistries(t *testing.T) {
+	server := newCloudFakeServer(t, func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	for _, name := range ctlreg.CloudKeychainNames {
+		keychain, err := ctlreg.NewCloudKeychain(name, server.Client())
+		require.NoError(t, err)
+
+		reg, err := regname.NewRegistry("index.docker.io")
+		require.NoError(t, err)
+
+		auth, err := keychain.Resolve(reg)
+		require.NoError(t, err)
+		assert.Equal(t, regauthn.Anonymous, auth)
+	}
+
+	assert.Equal(t, int32(0), atomic.LoadInt32(&server.requests))
+}
+
+func TestCloudKeychainECRWithStaticCredentials(t *testing.T) {
+	server := newCloudFakeServer(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "AmazonEC2ContainerRegistry_V20150921.GetAuthorizationToken", r.Header.Get("X-Amz-Target"))
+		assert.True(t, strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/"))
+		assert.Contains(t, r.Header.Get("Authorization"), "/us-west-2/ecr/aws4_request")
+		assert.Equal(t, "session", r.Header.Get("X-Amz-Security-Token"))
+
+		writeJSON(w, map[string]interface{}{
+			"authorizationData": []interface{}{map[string]interface{}{
+				"authorizationToken": base64.StdEncoding.EncodeToString([]byte("AWS:ecr-password")),
+				"expiresAt":          time.Now().Add(12 * time.Hour).Unix(),
+			}},
+		})
+	})
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_SESSION_TOKEN", "session")
+
+	keychain, err := ctlreg.NewCloudKeychain("ecr", server.Client())
+	require.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		authConfig, err := server.resolve(keychain, "123456789012.dkr.ecr.us-west-2.amazonaws.com")
+		require.NoError(t, err)
+		assert.Equal(t, "AWS", authConfig.Username)
+		assert.Equal(t, "ecr-password", authConfig.Password)
+	}
+
+	// Token is reused until it expires
+	assert.Equal(t, int32(1), atomic.LoadInt32(&server.requests))
+}
+
+func TestCloudKeychainECRWithWebIdentity(t *testing.T) {
+	server := newCloudFakeServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/sts/":
+			assert.Equal(t, "AssumeRoleWithWebIdentity", r.Form.Get("Action"))
+			assert.Equal(t, "arn:aws:iam::123456789012:role/kbld", r.Form.Get("RoleArn"))
+			assert.Equal(t, "k8s-token", r.Form.Get("WebIdentityToken"))
+
+			fmt.Fprint(w, `<AssumeRoleWithWebIdentityResponse><AssumeRoleWithWebIdentityResult><Credentials>`+
+				`<AccessKeyId>ASIA</AccessKeyId><SecretAccessKey>secret</SecretAccessKey><SessionToken>sts-session</SessionToken>`+
+				`</Credentials></AssumeRoleWithWebIdentityResult></AssumeRoleWithWebIdentityResponse>`)
+
+		case "/ecr/":
+			assert.True(t, strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=ASIA/"))
+			assert.Equal(t, "sts-session", r.Header.Get("X-Amz-Security-Token"))
+
+			writeJSON(w, map[string]interface{}{
+				"authorizationData": []interface{}{map[string]interface{}{
+					"authorizationToken": base64.StdEncoding.EncodeToString([]byte("AWS:ecr-password")),
+				}},
+			})
+
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("k8s-token\n"), 0600))
+
+	t.Setenv("AWS_WEB_IDENTITY_TOKEN_FILE", tokenFile)
+	t.Setenv("AWS_ROLE_ARN", "arn:aws:iam::123456789012:role/kbld")
+	t.Setenv("AWS_ENDPOINT_URL_STS", server.URL+"/sts/")
+	t.Setenv("AWS_ENDPOINT_URL_ECR", server.URL+"/ecr/")
+
+	authConfig, err := server.Resolve("ecr", "123456789012.dkr.ecr.us-west-2.amazonaws.com")
+	require.NoError(t, err)
+	assert.Equal(t, "ecr-password", authConfig.Password)
+}
+
+func TestCloudKeychainECRWithInstanceMetadata(t *testing.T) {
+	server := newCloudFakeServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/latest/api/token" && r.Method == http.MethodPut:
+			fmt.Fprint(w, "imds-token")
+
+		case strings.HasPrefix(r.URL.Path, "/latest/meta-data/iam/security-credentials/"):
+			assert.Equal(t, "imds-token", r.Header.Get("X-Aws-Ec2-Metadata-Token"))
+
+			if strings.HasSuffix(r.URL.Path, "/kbld-role") {
+				writeJSON(w, map[string]string{"AccessKeyId": "ASIA", "SecretAccessKey": "secret", "Token": "imds-session"})
+			} else {
+				fmt.Fprint(w, "kbld-role\n")
+			}
+
+		default:
+			assert.Equal(t, "imds-session", r.Header.Get("X-Amz-Security-Token"))
+
+			writeJSON(w, map[string]interface{}{
+				"authorizationData": []interface{}{map[string]interface{}{
+					"authorizationToken": base64.StdEncoding.EncodeToString([]byte("AWS:ecr-password")),
+				}},
+			})
+		}
+	})
+
+	t.Setenv("AWS_EC2_METADATA_SERVICE_ENDPOINT", server.URL)
+
+	authConfig, err := server.Resolve("ecr", "123456789012.dkr.ecr.us-west-2.amazonaws.com")
+	require.NoError(t, err)
+	assert.Equal(t, "ecr-password", authConfig.Password)
+}
+
+func TestCloudKeychainGCRWithMetadata(t *testing.T) {
+	server := newCloudFakeServer(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/computeMetadata/v1/instance/service-accounts/default/token", r.URL.Path)
+		assert.Equal(t, "Google", r.Header.Get("Metadata-Flavor"))
+
+		writeJSON(w, map[string]interface{}{"access_token": "gce-token", "expires_in": 3600})
+	})
+
+	t.Setenv("GCE_METADATA_HOST", strings.TrimPrefix(server.URL, "http://"))
+
+	for _, registry := range []string{"gcr.io", "eu.gcr.io", "us-docker.pkg.dev"} {
+		authConfig, err := server.Resolve("gcr", registry)
+		require.NoError(t, err)
+		assert.Equal(t, "oauth2accesstoken", authConfig.Username)
+		assert.Equal(t, "gce-token", authConfig.Password)
+	}
+}
+
+func TestCloudKeychainGCRWithServiceAccountKey(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	server := newCloudFakeServer(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "urn:ietf:params:oauth:grant-type:jwt-bearer", r.Form.Get("grant_type"))
+
+		parts := strings.Split(r.Form.Get("assertion"), ".")
+		if !assert.Len(t, parts, 3) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+		assert.NoError(t, err)
+
+		hash := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		assert.NoError(t, rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, hash[:], signature))
+
+		claimsBs, err := base64.RawURLEncoding.DecodeString(parts[1])
+		assert.NoError(t, err)
+		assert.Contains(t, string(claimsBs), `"iss":"kbld@project.iam.gserviceaccount.com"`)
+
+		writeJSON(w, map[string]interface{}{"access_token": "sa-token", "expires_in": 3600})
+	})
+
+	keyBs, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	credsBs, err := json.Marshal(map[string]string{
+		"type":         "service_account",
+		"client_email": "kbld@project.iam.gserviceaccount.com",
+		"private_key":  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyBs})),
+		"token_uri":    server.URL + "/token",
+	})
+	require.NoError(t, err)
+
+	credsFile := filepath.Join(t.TempDir(), "creds.json")
+	require.NoError(t, os.WriteFile(credsFile, credsBs, 0600))
+	t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", credsFile)
+
+	authConfig, err := server.Resolve("gcr", "gcr.io")
+	require.NoError(t, err)
+	assert.Equal(t, "sa-token", authConfig.Password)
+}
+
+func TestCloudKeychainGCRWithWorkloadIdentityFederation(t *testing.T) {
+	server := newCloudFakeServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/sts":
+			assert.Equal(t, "urn:ietf:params:oauth:grant-type:token-exchange", r.Form.Get("grant_type"))
+			assert.Equal(t, "oidc-token", r.Form.Get("subject_token"))
+			assert.Equal(t, "//iam.googleapis.com/projects/1/locations/global/workloadIdentityPools/p/providers/k8s", r.Form.Get("audience"))
+
+			writeJSON(w, map[string]interface{}{"access_token": "federated-token", "expires_in": 3600})
+
+		case "/impersonate":
+			assert.Equal(t, "Bearer federated-token", r.Header.Get("Authorization"))
+
+			writeJSON(w, map[string]interface{}{"accessToken": "impersonated-token",
+				"expireTime": time.Now().Add(time.Hour).Format(time.RFC3339)})
+
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	tmpDir := t.TempDir()
+
+	tokenFile := filepath.Join(tmpDir, "token.json")
+	require.NoError(t, os.WriteFile(tokenFile, []byte(`{"id_token": "oidc-token"}`), 0600))
+
+	credsBs, err := json.Marshal(map[string]interface{}{
+		"type":                              "external_account",
+		"audience":                          "//iam.googleapis.com/projects/1/locations/global/workloadIdentityPools/p/providers/k8s",
+		"subject_token_type":                "urn:ietf:params:oauth:token-type:jwt",
+		"token_url":                         server.URL + "/sts",
+		"service_account_impersonation_url": server.URL + "/impersonate",
+		"credential_source": map[string]interface{}{
+			"file":   tokenFile,
+			"format": map[string]string{"type": "json", "subject_token_field_name": "id_token"},
+		},
+	})
+	require.NoError(t, err)
+
+	credsFile := filepath.Join(tmpDir, "creds.json")
+	require.NoError(t, os.WriteFile(credsFile, credsBs, 0600))
+	t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", credsFile)
+
+	authConfig, err := server.Resolve("gcr", "us-docker.pkg.dev")
+	require.NoError(t, err)
+	assert.Equal(t, "impersonated-token", authConfig.Password)
+}
+
+func TestCloudKeychainACRWithWorkloadIdentity(t *testing.T) {
+	server := newCloudFakeServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/tenant-id/oauth2/v2.0/token":
+			assert.Equal(t, "client_credentials", r.Form.Get("grant_type"))
+			assert.Equal(t, "client-id", r.Form.Get("client_id"))
+			assert.Equal(t, "federated-token", r.Form.Get("client_assertion"))
+			assert.Equal(t, "https://management.azure.com/.default", r.Form.Get("scope"))
+
+			writeJSON(w, map[string]interface{}{"access_token": "aad-token", "expires_in": 3600})
+
+		case "/oauth2/exchange":
+			assert.Equal(t, "example.azurecr.io", r.Host)
+			assert.Equal(t, "example.azurecr.io", r.Form.Get("service"))
+			assert.Equal(t, "aad-token", r.Form.Get("access_token"))
+
+			writeJSON(w, map[string]string{"refresh_token": "acr-refresh-token"})
+
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("federated-token"), 0600))
+
+	t.Setenv("AZURE_FEDERATED_TOKEN_FILE", tokenFile)
+	t.Setenv("AZURE_CLIENT_ID", "client-id")
+	t.Setenv("AZURE_TENANT_ID", "tenant-id")
+	t.Setenv("AZURE_AUTHORITY_HOST", server.URL)
+
+	authConfig, err := server.Resolve("acr", "example.azurecr.io")
+	require.NoError(t, err)
+	assert.Equal(t, "00000000-0000-0000-0000-000000000000", authConfig.Username)
+	assert.Equal(t, "acr-refresh-token", authConfig.Password)
+}
+
+func TestCloudKeychainACRWithManagedIdentity(t *testing.T) {
+	server := newCloudFakeServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/metadata/identity/oauth2/token":
+			assert.Equal(t, "true", r.Header.Get("Metadata"))
+			assert.Equal(t, "https://management.azure.com/", r.Form.Get("resource"))
+
+			// IMDS returns expiration as a string
+			writeJSON(w, map[string]interface{}{"access_token": "msi-token", "expires_in": "3599"})
+
+		case "/oauth2/exchange":
+			assert.Equal(t, "msi-token", r.Form.Get("access_token"))
+
+			writeJSON(w, map[string]string{"refresh_token": "acr-refresh-token"})
+
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	t.Setenv("AZURE_POD_IDENTITY_AUTHORITY_HOST", server.URL)
+
+	authConfig, err := server.Resolve("acr", "example.azurecr.io")
+	require.NoError(t, err)
+	assert.Equal(t, "acr-refresh-token", authConfig.Password)
+}
+
+func TestCloudKeychainReportsErrors(t *testing.T) {
+	server := newCloudFakeServer(t, func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, "access denied")
+	})
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+
+	_, err := server.Resolve("ecr", "123456789012.dkr.ecr.us-west-2.amazonaws.com")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Getting ECR credentials for registry '123456789012.dkr.ecr.us-west-2.amazonaws.com'")
+	assert.Contains(t, err.Error(), "403 Forbidden: access denied")
+}
+
+func TestCloudKeychainIgnoresRegistryTLSSettings(t *testing.T) {
+	var requests int32
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		writeJSON(w, map[string]interface{}{"access_token": "user-token", "expires_in": 3600})
+	}))
+	// Rejected handshakes are expected
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	defer server.Close()
+
+	for _, key := range cloudEnvKeys {
+		t.Setenv(key, "")
+	}
+	t.Setenv("CLOUDSDK_CONFIG", t.TempDir())
+
+	credsBs, err := json.Marshal(map[string]string{
+		"type":          "authorized_user",
+		"client_id":     "client-id",
+		"client_secret": "client-secret",
+		"refresh_token": "refresh-token",
+		"token_uri":     server.URL + "/token",
+	})
+	require.NoError(t, err)
+
+	credsFile := filepath.Join(t.TempDir(), "creds.json")
+	require.NoError(t, os.WriteFile(credsFile, credsBs, 0600))
+	t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", credsFile)
+
+	// Disabled verification applies to registries only,
+	// hence self-signed token endpoint is not trusted
+	reg, err := ctlreg.NewRegistry(ctlreg.Opts{
+		EnvAuthPrefix: "KBLD_TEST_REGISTRY",
+		VerifyCerts:   false,
+		Keychains:     []string{"gcr"},
+	})
+	require.NoError(t, err)
+
+	_, err = reg.AuthInfo(context.Background(), "gcr.io")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "certificate")
+	assert.Equal(t, int32(0), atomic.LoadInt32(&requests))
+}
+
+func TestCloudKeychainTokenRequestsUseContextAndDoNotBlockOtherRegistries(t *testing.T) {
+	blockedCh := make(chan struct{})
+
+	server := newCloudFakeServer(t, func(w http.ResponseWriter, r *http.Request) {
+		// Token endpoint for one of the regions does not respond until request is cancelled
+		// (body has to be consumed for server to notice client disconnect)
+		if strings.Contains(r.Host, "us-west-2") {
+			io.Copy(io.Discard, r.Body)
+			close(blockedCh)
+			<-r.Context().Done()
+			return
+		}
+
+		writeJSON(w, map[string]interface{}{
+			"authorizationData": []interface{}{map[string]interface{}{
+				"authorizationToken": base64.StdEncoding.EncodeToString([]byte("AWS:ecr-password")),
+				"expiresAt":          time.Now().Add(12 * time.Hour).Unix(),
+			}},
+		})
+	})
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+
+	keychain, err := ctlreg.NewCloudKeychain("ecr", server.Client())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	blockedErrCh := make(chan error, 1)
+	go func() {
+		_, err := server.resolve(keychain.WithContext(ctx), "123456789012.dkr.ecr.us-west-2.amazonaws.com")
+		blockedErrCh <- err
+	}()
+
+	<-blockedCh
+
+	authConfig, err := server.resolve(keychain, "123456789012.dkr.ecr.us-east-1.amazonaws.com")
+	require.NoError(t, err)
+	assert.Equal(t, "ecr-password", authConfig.Password)
+
+	cancel()
+
+	select {
+	case err := <-blockedErrCh:
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "Getting ECR credentials for registry '123456789012.dkr.ecr.us-west-2.amazonaws.com': ")
+		assert.Contains(t, err.Error(), "context canceled")
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected token request to be cancelled")
+	}
+}
@@ -0,0 +1,347 @@
+// Copyright 2024 The Carvel Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package registry
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	ecrDefaultMetadataEndpoint  = "http://169.254.169.254"
+	ecrDefaultContainerEndpoint = "http://169.254.170.2"
+)
+
+var (
+	// Matches private ECR registries (e.g. 123456789012.dkr.ecr.us-east-1.amazonaws.com)
+	ecrRegistryRegexp = regexp.MustCompile(`^\d{12}\.dkr\.ecr(?:-fips)?\.([a-z0-9-]+)\.(amazonaws\.com(?:\.cn)?)$`)
+)
+
+// ecrProvider provides authorization tokens for Elastic Container Registry
+// based on AWS credentials found in (in order):
+//   - AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, AWS_SESSION_TOKEN env variables
+//   - web identity token file (AWS_WEB_IDENTITY_TOKEN_FILE, AWS_ROLE_ARN) used by EKS
+//   - container credentials endpoint (AWS_CONTAINER_CREDENTIALS_FULL_URI or _RELATIVE_URI)
+//   - EC2 instance metadata (AWS_EC2_METADATA_SERVICE_ENDPOINT overrides its location)
+//
+// AWS_ENDPOINT_URL_ECR, AWS_ENDPOINT_URL_STS and AWS_ENDPOINT_URL override API endpoints.
+type ecrProvider struct {
+	client cloudHTTPClient
+}
+
+type awsCredentials struct {
+	AccessKeyID     string `json:"AccessKeyId"`
+	SecretAccessKey string `json:"SecretAccessKey"`
+	SessionToken    string `json:"Token"`
+}
+
+func (ecrProvider) Matches(registry string) bool {
+	return ecrRegistryRegexp.MatchString(registryHostname(registry))
+}
+
+func (p ecrProvider) Token(ctx context.Context, registry string) (cloudToken, error) {
+	match := ecrRegistryRegexp.FindStringSubmatch(registryHostname(registry))
+	if match == nil {
+		return cloudToken{}, fmt.Errorf("Expected registry to be ECR registry")
+	}
+
+	region, domain := match[1], match[2]
+
+	creds, err := p.credentials(ctx, region, domain)
+	if err != nil {
+		return cloudToken{}, err
+	}
+
+	body := []byte("{}")
+	endpoint := p.endpoint("ECR", fmt.Sprintf("https://api.ecr.%s.%s", region, domain))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return cloudToken{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "AmazonEC2ContainerRegistry_V20150921.GetAuthorizationToken")
+
+	signAWSRequest(req, body, creds, region, "ecr", time.Now())
+
+	var resp struct {
+		AuthorizationData []struct {
+			AuthorizationToken string  `json:"authorizationToken"`
+			ExpiresAt          float64 `json:"expiresAt"`
+		} `json:"authorizationData"`
+	}
+
+	err = p.client.DoJSON(req, &resp)
+	if err != nil {
+		return cloudToken{}, fmt.Errorf("Getting authorization token: %s", err)
+	}
+
+	if len(resp.AuthorizationData) == 0 {
+		return cloudToken{}, fmt.Errorf("Expected authorization token to be returned")
+	}
+
+	decodedToken, err := base64.StdEncoding.DecodeString(resp.AuthorizationData[0].AuthorizationToken)
+	if err != nil {
+		return cloudToken{}, fmt.Errorf("Decoding authorization token: %s", err)
+	}
+
+	pieces := strings.SplitN(string(decodedToken), ":", 2)
+	if len(pieces) != 2 {
+		return cloudToken{}, fmt.Errorf("Expected authorization token to be in format 'username:password'")
+	}
+
+	return cloudToken{
+		Username:  pieces[0],
+		Password:  pieces[1],
+		ExpiresAt: time.Unix(int64(resp.AuthorizationData[0].ExpiresAt), 0),
+	}, nil
+}
+
+func (p ecrProvider) credentials(ctx context.Context, region, domain string) (awsCredentials, error) {
+	if accessKeyID := os.Getenv("AWS_ACCESS_KEY_ID"); len(accessKeyID) > 0 {
+		return awsCredentials{
+			AccessKeyID:     accessKeyID,
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		}, nil
+	}
+
+	if tokenFile := os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE"); len(tokenFile) > 0 {
+		return p.webIdentityCredentials(ctx, tokenFile, region, domain)
+	}
+
+	fullURI := os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI")
+	if relativeURI := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); len(relativeURI) > 0 {
+		fullURI = ecrDefaultContainerEndpoint + relativeURI
+	}
+	if len(fullURI) > 0 {
+		return p.containerCredentials(ctx, fullURI)
+	}
+
+	return p.instanceCredentials(ctx)
+}
+
+func (p ecrProvider) webIdentityCredentials(ctx context.Context, tokenFile, region, domain string) (awsCredentials, error) {
+	token, err := os.ReadFile(tokenFile)
+	if err != nil {
+		return awsCredentials{}, fmt.Errorf("Reading web identity token file: %s", err)
+	}
+
+	roleARN := os.Getenv("AWS_ROLE_ARN")
+	if len(roleARN) == 0 {
+		return awsCredentials{}, fmt.Errorf("Expected AWS_ROLE_ARN to be set when using AWS_WEB_IDENTITY_TOKEN_FILE")
+	}
+
+	sessionName := os.Getenv("AWS_ROLE_SESSION_NAME")
+	if len(sessionName) == 0 {
+		sessionName = fmt.Sprintf("kbld-%d", time.Now().UnixNano())
+	}
+
+	form := url.Values{
+		"Action":           {"AssumeRoleWithWebIdentity"},
+		"Version":          {"2011-06-15"},
+		"RoleArn":          {roleARN},
+		"RoleSessionName":  {sessionName},
+		"WebIdentityToken": {strings.TrimSpace(string(token))},
+	}
+
+	bs, err := p.client.PostForm(ctx, p.endpoint("STS", fmt.Sprintf("https://sts.%s.%s", region, domain)), form)
+	if err != nil {
+		return awsCredentials{}, fmt.Errorf("Assuming role with web identity: %s", err)
+	}
+
+	var resp struct {
+		Result struct {
+			Credentials struct {
+				AccessKeyID     string `xml:"AccessKeyId"`
+				SecretAccessKey string `xml:"SecretAccessKey"`
+				SessionToken    string `xml:"SessionToken"`
+			} `xml:"Credentials"`
+		} `xml:"AssumeRoleWithWebIdentityResult"`
+	}
+
+	err = xml.Unmarshal(bs, &resp)
+	if err != nil {
+		return awsCredentials{}, fmt.Errorf("Unmarshaling assume role response: %s", err)
+	}
+
+	return awsCredentials{
+		AccessKeyID:     resp.Result.Credentials.AccessKeyID,
+		SecretAccessKey: resp.Result.Credentials.SecretAccessKey,
+		SessionToken:    resp.Result.Credentials.SessionToken,
+	}, nil
+}
+
+func (p ecrProvider) containerCredentials(ctx context.Context, endpoint string) (awsCredentials, error) {
+	ctx, cancel := withMetadataTimeout(ctx)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+
+	authToken := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN")
+	if tokenFile := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE"); len(tokenFile) > 0 {
+		tokenBs, err := os.ReadFile(tokenFile)
+		if err != nil {
+			return awsCredentials{}, fmt.Errorf("Reading container authorization token file: %s", err)
+		}
+		authToken = strings.TrimSpace(string(tokenBs))
+	}
+	if len(authToken) > 0 {
+		req.Header.Set("Authorization", authToken)
+	}
+
+	var creds awsCredentials
+
+	err = p.client.DoJSON(req, &creds)
+	if err != nil {
+		return awsCredentials{}, fmt.Errorf("Getting container credentials: %s", err)
+	}
+
+	return creds, nil
+}
+
+// instanceCredentials uses IMDSv2 to get instance role credentials
+func (p ecrProvider) instanceCredentials(ctx context.Context) (awsCredentials, error) {
+	endpoint := os.Getenv("AWS_EC2_METADATA_SERVICE_ENDPOINT")
+	if len(endpoint) == 0 {
+		endpoint = ecrDefaultMetadataEndpoint
+	}
+	endpoint = strings.TrimSuffix(endpoint, "/")
+
+	ctx, cancel := withMetadataTimeout(ctx)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, endpoint+"/latest/api/token", nil)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	req.Header.Set("X-Aws-Ec2-Metadata-Token-Ttl-Seconds", "300")
+
+	token, err := p.client.Do(req)
+	if err != nil {
+		return awsCredentials{}, fmt.Errorf("Getting instance metadata token "+
+			"(no credentials found in env variables): %s", err)
+	}
+
+	get := func(path string) ([]byte, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint+path, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("X-Aws-Ec2-Metadata-Token", string(token))
+		return p.client.Do(req)
+	}
+
+	const credsPath = "/latest/meta-data/iam/security-credentials/"
+
+	roles, err := get(credsPath)
+	if err != nil {
+		return awsCredentials{}, fmt.Errorf("Getting instance role: %s", err)
+	}
+
+	role := strings.TrimSpace(strings.SplitN(string(roles), "\n", 2)[0])
+	if len(role) == 0 {
+		return awsCredentials{}, fmt.Errorf("Expected instance to have IAM role")
+	}
+
+	credsBs, err := get(credsPath + role)
+	if err != nil {
+		return awsCredentials{}, fmt.Errorf("Getting instance role credentials: %s", err)
+	}
+
+	var creds awsCredentials
+
+	err = json.Unmarshal(credsBs, &creds)
+	if err != nil {
+		return awsCredentials{}, fmt.Errorf("Unmarshaling instance role credentials: %s", err)
+	}
+
+	return creds, nil
+}
+
+func (ecrProvider) endpoint(service, defaultEndpoint string) string {
+	for _, key := range []string{"AWS_ENDPOINT_URL_" + service, "AWS_ENDPOINT_URL"} {
+		if endpoint := os.Getenv(key); len(endpoint) > 0 {
+			return endpoint
+		}
+	}
+	return defaultEndpoint
+}
+
+// signAWSRequest adds AWS Signature Version 4 to request
+// (https://docs.aws.amazon.com/IAM/latest/UserGuide/create-signed-request.html)
+func signAWSRequest(req *http.Request, body []byte, creds awsCredentials, region, service string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	if len(creds.SessionToken) > 0 {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	headerNames := []string{"host"}
+	for name := range req.Header {
+		headerNames = append(headerNames, strings.ToLower(name))
+	}
+	sort.Strings(headerNames)
+
+	var canonicalHeaders strings.Builder
+
+	for _, name := range headerNames {
+		val := req.URL.Host
+		if name != "host" {
+			val = strings.TrimSpace(req.Header.Get(name))
+		}
+		canonicalHeaders.WriteString(name + ":" + val + "\n")
+	}
+
+	signedHeaders := strings.Join(headerNames, ";")
+
+	path := req.URL.EscapedPath()
+	if len(path) == 0 {
+		path = "/"
+	}
+
+	canonicalRequest := strings.Join([]string{req.Method, path, req.URL.Query().Encode(),
+		canonicalHeaders.String(), signedHeaders, sha256Hex(body)}, "\n")
+
+	scope := strings.Join([]string{date, region, service, "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+
+	key := []byte("AWS4" + creds.SecretAccessKey)
+	for _, val := range []string{date, region, service, "aws4_request"} {
+		key = hmacSHA256(key, val)
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.AccessKeyID, scope, signedHeaders, hex.EncodeToString(hmacSHA256(key, stringToSign))))
+}
+
+func sha256Hex(bs []byte) string {
+	hash := sha256.Sum256(bs)
+	return hex.EncodeToString(hash[:])
+}
+
+func hmacSHA256(key []byte, val string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(val))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,85 @@
+// Copyright 2024 The Carvel Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package registry
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Examples come from AWS Signature Version 4 test suite
+// (https://docs.aws.amazon.com/general/latest/gr/signature-v4-test-suite.html)
+func TestSignAWSRequestTestSuite(t *testing.T) {
+	creds := awsCredentials{
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+	}
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+
+	type example struct {
+		Description string
+		Method      string
+		URL         string
+		Headers     map[string]string
+		Body        string
+
+		ExpectedSignedHeaders string
+		ExpectedSignature     string
+	}
+
+	exs := []example{
+		{
+			Description:           "get-vanilla",
+			Method:                http.MethodGet,
+			URL:                   "https://example.amazonaws.com/",
+			ExpectedSignedHeaders: "host;x-amz-date",
+			ExpectedSignature:     "5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		},
+		{
+			Description:           "get-vanilla-query-order-key-case",
+			Method:                http.MethodGet,
+			URL:                   "https://example.amazonaws.com/?Param2=value2&Param1=value1",
+			ExpectedSignedHeaders: "host;x-amz-date",
+			ExpectedSignature:     "b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500",
+		},
+		{
+			Description:           "post-vanilla",
+			Method:                http.MethodPost,
+			URL:                   "https://example.amazonaws.com/",
+			ExpectedSignedHeaders: "host;x-amz-date",
+			ExpectedSignature:     "5da7c1a2acd57cee7505fc6676e4e544621c30862966e37dddb68e92efbe5d6b",
+		},
+		{
+			Description:           "post-x-www-form-urlencoded",
+			Method:                http.MethodPost,
+			URL:                   "https://example.amazonaws.com/",
+			Headers:               map[string]string{"Content-Type": "application/x-www-form-urlencoded"},
+			Body:                  "Param1=value1",
+			ExpectedSignedHeaders: "content-type;host;x-amz-date",
+			ExpectedSignature:     "ff11897932ad3f4e8b18135d722051e5ac45fc38421b1da7b9d196a0fe09473a",
+		},
+	}
+
+	for _, ex := range exs {
+		t.Run(ex.Description, func(t *testing.T) {
+			req, err := http.NewRequest(ex.Method, ex.URL, strings.NewReader(ex.Body))
+			require.NoError(t, err)
+
+			for key, val := range ex.Headers {
+				req.Header.Set(key, val)
+			}
+
+			signAWSRequest(req, []byte(ex.Body), creds, "us-east-1", "service", now)
+
+			assert.Equal(t, "20150830T123600Z", req.Header.Get("X-Amz-Date"))
+			assert.Equal(t, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, "+
+				"SignedHeaders="+ex.ExpectedSignedHeaders+", Signature="+ex.ExpectedSignature, req.Header.Get("Authorization"))
+		})
+	}
+}
@@ -17,6 +17,8 @@ import (
 //   export KBLD_REGISTRY_HOSTNAME_0=...
 //   export KBLD_REGISTRY_USERNAME_0=...
 //   export KBLD_REGISTRY_PASSWORD_0=...
+//   export KBLD_REGISTRY_CLIENT_CERT_0=/path/to/cert.pem (mutual TLS)
+//   export KBLD_REGISTRY_CLIENT_KEY_0=/path/to/key.pem
 
 type EnvKeychain struct {
 	globalPrefix string
@@ -40,7 +42,8 @@ func (k *EnvKeychain) Resolve(target regauthn.Resource) (regauthn.Authenticator,
 	}
 
 	for _, info := range infos {
-		if info.Hostname == target.RegistryStr() {
+		// Entries may only specify client certificates
+		if info.Hostname == target.RegistryStr() && info.hasCredentials() {
 			return regauthn.FromConfig(regauthn.AuthConfig{
 				Username:      info.Username,
 				Password:      info.Password,
@@ -58,6 +61,35 @@ type envKeychainInfo struct {
 	Password      string
 	IdentityToken string
 	RegistryToken string
+
+	ClientCertPath string
+	ClientKeyPath  string
+}
+
+func (i envKeychainInfo) hasCredentials() bool {
+	return len(i.Username) > 0 || len(i.Password) > 0 || len(i.IdentityToken) > 0 || len(i.RegistryToken) > 0
+}
+
+// ClientCertPaths returns client certificate and key paths by registry hostname
+func (k *EnvKeychain) ClientCertPaths() (map[string]ClientCertPaths, error) {
+	infos, err := k.collect()
+	if err != nil {
+		return nil, err
+	}
+
+	result := map[string]ClientCertPaths{}
+
+	for _, info := range infos {
+		if len(info.ClientCertPath) == 0 && len(info.ClientKeyPath) == 0 {
+			continue
+		}
+		if len(info.Hostname) == 0 {
+			return nil, fmt.Errorf("Expected registry hostname to be specified for client certificate '%s'", info.ClientCertPath)
+		}
+		result[info.Hostname] = ClientCertPaths{CertPath: info.ClientCertPath, KeyPath: info.ClientKeyPath}
+	}
+
+	return result, nil
 }
 
 func (k *EnvKeychain) collect() ([]envKeychainInfo, error) {
@@ -97,6 +129,14 @@ func (k *EnvKeychain) collect() ([]envKeychainInfo, error) {
 			info.RegistryToken = val
 			return nil
 		},
+		"CLIENT_CERT": func(info *envKeychainInfo, val string) error {
+			info.ClientCertPath = val
+			return nil
+		},
+		"CLIENT_KEY": func(info *envKeychainInfo, val string) error {
+			info.ClientKeyPath = val
+			return nil
+		},
 	}
 
 	defaultInfo := envKeychainInfo{}
@@ -0,0 +1,373 @@
+// Copyright 2024 The Carvel Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package registry
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	gcrUsername            = "oauth2accesstoken"
+	gcrScope               = "https://www.googleapis.com/auth/cloud-platform"
+	gcrDefaultTokenURL     = "https://oauth2.googleapis.com/token"
+	gcrDefaultMetadataHost = "metadata.google.internal"
+)
+
+// gcrProvider provides access tokens for Google Container Registry
+// and Artifact Registry based on application default credentials:
+//   - credentials file (GOOGLE_APPLICATION_CREDENTIALS or gcloud ADC file)
+//     with service account key, user or workload identity federation credentials
+//   - metadata server (GCE_METADATA_HOST overrides its location)
+type gcrProvider struct {
+	client cloudHTTPClient
+}
+
+func (gcrProvider) Matches(registry string) bool {
+	hostname := registryHostname(registry)
+	return hostname == "gcr.io" || strings.HasSuffix(hostname, ".gcr.io") ||
+		hostname == "docker.pkg.dev" || strings.HasSuffix(hostname, "-docker.pkg.dev")
+}
+
+func (p gcrProvider) Token(ctx context.Context, _ string) (cloudToken, error) {
+	var token oauthToken
+	var err error
+
+	if path := p.credentialsPath(); len(path) > 0 {
+		token, err = p.tokenFromCredentialsFile(ctx, path)
+	} else {
+		token, err = p.tokenFromMetadata(ctx)
+	}
+	if err != nil {
+		return cloudToken{}, err
+	}
+
+	return cloudToken{Username: gcrUsername, Password: token.AccessToken, ExpiresAt: token.ExpiresAt()}, nil
+}
+
+func (gcrProvider) credentialsPath() string {
+	if path := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"); len(path) > 0 {
+		return path
+	}
+
+	configDir := os.Getenv("CLOUDSDK_CONFIG")
+	if len(configDir) == 0 {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		configDir = filepath.Join(homeDir, ".config", "gcloud")
+	}
+
+	path := filepath.Join(configDir, "application_default_credentials.json")
+	if _, err := os.Stat(path); err != nil {
+		return ""
+	}
+	return path
+}
+
+type gcrCredentialsFile struct {
+	Type string `json:"type"`
+
+	// Used by service_account
+	ClientEmail  string `json:"client_email"`
+	PrivateKey   string `json:"private_key"`
+	PrivateKeyID string `json:"private_key_id"`
+	TokenURI     string `json:"token_uri"`
+
+	// Used by authorized_user
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	RefreshToken string `json:"refresh_token"`
+
+	// Used by external_account
+	Audience                       string                  `json:"audience"`
+	SubjectTokenType               string                  `json:"subject_token_type"`
+	TokenURL                       string                  `json:"token_url"`
+	ServiceAccountImpersonationURL string                  `json:"service_account_impersonation_url"`
+	CredentialSource               gcrCredentialSourceFile `json:"credential_source"`
+}
+
+type gcrCredentialSourceFile struct {
+	File    string            `json:"file"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+	Format  struct {
+		Type                  string `json:"type"`
+		SubjectTokenFieldName string `json:"subject_token_field_name"`
+	} `json:"format"`
+}
+
+func (p gcrProvider) tokenFromCredentialsFile(ctx context.Context, path string) (oauthToken, error) {
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		return oauthToken{}, fmt.Errorf("Reading credentials file: %s", err)
+	}
+
+	var creds gcrCredentialsFile
+
+	err = json.Unmarshal(bs, &creds)
+	if err != nil {
+		return oauthToken{}, fmt.Errorf("Unmarshaling credentials file '%s': %s", path, err)
+	}
+
+	switch creds.Type {
+	case "service_account":
+		return p.serviceAccountToken(ctx, creds)
+	case "authorized_user":
+		return p.authorizedUserToken(ctx, creds)
+	case "external_account":
+		return p.externalAccountToken(ctx, creds)
+	default:
+		return oauthToken{}, fmt.Errorf("Expected credentials file '%s' type '%s' to be one of: "+
+			"service_account, authorized_user, external_account", path, creds.Type)
+	}
+}
+
+func (p gcrProvider) serviceAccountToken(ctx context.Context, creds gcrCredentialsFile) (oauthToken, error) {
+	key, err := p.parsePrivateKey(creds.PrivateKey)
+	if err != nil {
+		return oauthToken{}, err
+	}
+
+	tokenURI := creds.TokenURI
+	if len(tokenURI) == 0 {
+		tokenURI = gcrDefaultTokenURL
+	}
+
+	now := time.Now()
+
+	header := map[string]interface{}{"alg": "RS256", "typ": "JWT", "kid": creds.PrivateKeyID}
+	claims := map[string]interface{}{
+		"iss":   creds.ClientEmail,
+		"scope": gcrScope,
+		"aud":   tokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	}
+
+	var encodedParts []string
+
+	for _, part := range []interface{}{header, claims} {
+		partBs, err := json.Marshal(part)
+		if err != nil {
+			return oauthToken{}, err
+		}
+		encodedParts = append(encodedParts, base64.RawURLEncoding.EncodeToString(partBs))
+	}
+
+	signingInput := strings.Join(encodedParts, ".")
+	hash := sha256.Sum256([]byte(signingInput))
+
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hash[:])
+	if err != nil {
+		return oauthToken{}, fmt.Errorf("Signing service account assertion: %s", err)
+	}
+
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)},
+	}
+
+	return p.requestToken(ctx, tokenURI, form)
+}
+
+func (gcrProvider) parsePrivateKey(privateKey string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(privateKey))
+	if block == nil {
+		return nil, fmt.Errorf("Expected service account private key to be PEM encoded")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("Parsing service account private key: %s", err)
+	}
+
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("Expected service account private key to be RSA key")
+	}
+	return rsaKey, nil
+}
+
+func (p gcrProvider) authorizedUserToken(ctx context.Context, creds gcrCredentialsFile) (oauthToken, error) {
+	tokenURI := creds.TokenURI
+	if len(tokenURI) == 0 {
+		tokenURI = gcrDefaultTokenURL
+	}
+
+	form := url.Values{
+		"grant_type":    {"refresh_token"},
+		"client_id":     {creds.ClientID},
+		"client_secret": {creds.ClientSecret},
+		"refresh_token": {creds.RefreshToken},
+	}
+
+	return p.requestToken(ctx, tokenURI, form)
+}
+
+// externalAccountToken exchanges workload identity token
+// (e.g. Kubernetes service account token) via Security Token Service
+func (p gcrProvider) externalAccountToken(ctx context.Context, creds gcrCredentialsFile) (oauthToken, error) {
+	subjectToken, err := p.subjectToken(ctx, creds.CredentialSource)
+	if err != nil {
+		return oauthToken{}, err
+	}
+
+	form := url.Values{
+		"grant_type":           {"urn:ietf:params:oauth:grant-type:token-exchange"},
+		"audience":             {creds.Audience},
+		"scope":                {gcrScope},
+		"requested_token_type": {"urn:ietf:params:oauth:token-type:access_token"},
+		"subject_token":        {subjectToken},
+		"subject_token_type":   {creds.SubjectTokenType},
+	}
+
+	token, err := p.requestToken(ctx, creds.TokenURL, form)
+	if err != nil {
+		return oauthToken{}, err
+	}
+
+	if len(creds.ServiceAccountImpersonationURL) == 0 {
+		return token, nil
+	}
+
+	reqBs, err := json.Marshal(map[string]interface{}{"scope": []string{gcrScope}})
+	if err != nil {
+		return oauthToken{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, creds.ServiceAccountImpersonationURL, bytes.NewReader(reqBs))
+	if err != nil {
+		return oauthToken{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+
+	var impersonated struct {
+		AccessToken string    `json:"accessToken"`
+		ExpireTime  time.Time `json:"expireTime"`
+	}
+
+	err = p.client.DoJSON(req, &impersonated)
+	if err != nil {
+		return oauthToken{}, fmt.Errorf("Impersonating service account: %s", err)
+	}
+
+	expiresIn := int64(time.Until(impersonated.ExpireTime).Seconds())
+
+	return oauthToken{AccessToken: impersonated.AccessToken, ExpiresIn: json.Number(fmt.Sprintf("%d", expiresIn))}, nil
+}
+
+func (p gcrProvider) subjectToken(ctx context.Context, source gcrCredentialSourceFile) (string, error) {
+	var bs []byte
+	var err error
+
+	switch {
+	case len(source.File) > 0:
+		bs, err = os.ReadFile(source.File)
+		if err != nil {
+			return "", fmt.Errorf("Reading credential source file: %s", err)
+		}
+
+	case len(source.URL) > 0:
+		ctx, cancel := withMetadataTimeout(ctx)
+		defer cancel()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, source.URL, nil)
+		if err != nil {
+			return "", err
+		}
+		for key, val := range source.Headers {
+			req.Header.Set(key, val)
+		}
+
+		bs, err = p.client.Do(req)
+		if err != nil {
+			return "", fmt.Errorf("Getting credential source token: %s", err)
+		}
+
+	default:
+		return "", fmt.Errorf("Expected credential source to specify file or url")
+	}
+
+	if source.Format.Type != "json" {
+		return strings.TrimSpace(string(bs)), nil
+	}
+
+	var fields map[string]interface{}
+
+	err = json.Unmarshal(bs, &fields)
+	if err != nil {
+		return "", fmt.Errorf("Unmarshaling credential source token: %s", err)
+	}
+
+	token, ok := fields[source.Format.SubjectTokenFieldName].(string)
+	if !ok {
+		return "", fmt.Errorf("Expected credential source token to include field '%s'", source.Format.SubjectTokenFieldName)
+	}
+	return token, nil
+}
+
+func (p gcrProvider) tokenFromMetadata(ctx context.Context) (oauthToken, error) {
+	host := os.Getenv("GCE_METADATA_HOST")
+	if len(host) == 0 {
+		host = gcrDefaultMetadataHost
+	}
+
+	ctx, cancel := withMetadataTimeout(ctx)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		"http://"+host+"/computeMetadata/v1/instance/service-accounts/default/token", nil)
+	if err != nil {
+		return oauthToken{}, err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+
+	var token oauthToken
+
+	err = p.client.DoJSON(req, &token)
+	if err != nil {
+		return oauthToken{}, fmt.Errorf("Getting token from metadata server "+
+			"(no credentials file found via GOOGLE_APPLICATION_CREDENTIALS): %s", err)
+	}
+
+	return token, nil
+}
+
+func (p gcrProvider) requestToken(ctx context.Context, tokenURL string, form url.Values) (oauthToken, error) {
+	bs, err := p.client.PostForm(ctx, tokenURL, form)
+	if err != nil {
+		return oauthToken{}, err
+	}
+
+	var token oauthToken
+
+	err = json.Unmarshal(bs, &token)
+	if err != nil {
+		return oauthToken{}, fmt.Errorf("Unmarshaling token response: %s", err)
+	}
+
+	return token, nil
+}
@@ -0,0 +1,233 @@
+// Copyright 2024 The Carvel Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package registry
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+
+	dockerconfig "github.com/docker/cli/cli/config"
+	dockerconfigfile "github.com/docker/cli/cli/config/configfile"
+	dockertypes "github.com/docker/cli/cli/config/types"
+	credclient "github.com/docker/docker-credential-helpers/client"
+	credentials "github.com/docker/docker-credential-helpers/credentials"
+	regauthn "github.com/google/go-containerregistry/pkg/authn"
+	regname "github.com/google/go-containerregistry/pkg/name"
+)
+
+const (
+	credHelperPrefix = "docker-credential-"
+)
+
+// AuthInfo describes credentials that would be used for a registry
+type AuthInfo struct {
+	Source   string
+	Username string
+}
+
+type namedKeychain struct {
+	Source   string
+	Keychain regauthn.Keychain
+}
+
+// sourcedKeychain tries keychains in order (similar to regauthn.MultiKeychain)
+// and remembers which credential source was used
+type sourcedKeychain []namedKeychain
+
+var _ regauthn.Keychain = sourcedKeychain{}
+
+func (k sourcedKeychain) Resolve(target regauthn.Resource) (regauthn.Authenticator, error) {
+	auth, _, err := k.ResolveWithSource(target)
+	return auth, err
+}
+
+func (k sourcedKeychain) ResolveWithSource(target regauthn.Resource) (regauthn.Authenticator, string, error) {
+	for _, named := range k {
+		auth, err := named.Keychain.Resolve(target)
+		if err != nil {
+			return nil, "", fmt.Errorf("Resolving credentials (%s): %s", named.Source, err)
+		}
+		if auth != regauthn.Anonymous {
+			return auth, named.Source, nil
+		}
+	}
+	return regauthn.Anonymous, "anonymous", nil
+}
+
+// WithContext returns keychain that uses given context
+// for network requests made by cloud keychains
+func (k sourcedKeychain) WithContext(ctx context.Context) sourcedKeychain {
+	result := make(sourcedKeychain, len(k))
+	for i, named := range k {
+		if cloudKeychain, ok := named.Keychain.(CloudKeychain); ok {
+			named.Keychain = cloudKeychain.WithContext(ctx)
+		}
+		result[i] = named
+	}
+	return result
+}
+
+func newSourcedKeychain(opts Opts, httpClient *http.Client) (sourcedKeychain, error) {
+	keychain := sourcedKeychain{{
+		Source:   fmt.Sprintf("env variables (%s_*)", opts.EnvAuthPrefix),
+		Keychain: NewEnvKeychain(opts.EnvAuthPrefix),
+	}}
+
+	var registries []string
+	for registry := range opts.CredHelpers {
+		registries = append(registries, registry)
+	}
+	sort.Strings(registries)
+
+	for _, registry := range registries {
+		helper := opts.CredHelpers[registry]
+		keychain = append(keychain, namedKeychain{
+			Source:   fmt.Sprintf("credential helper '%s%s'", credHelperPrefix, helper),
+			Keychain: NewCredHelperKeychain(registry, helper),
+		})
+	}
+
+	for _, name := range opts.Keychains {
+		cloudKeychain, err := NewCloudKeychain(name, httpClient)
+		if err != nil {
+			return nil, err
+		}
+		keychain = append(keychain, namedKeychain{
+			Source:   fmt.Sprintf("%s keychain", name),
+			Keychain: cloudKeychain,
+		})
+	}
+
+	if len(opts.AuthFile) > 0 {
+		keychain = append(keychain, namedKeychain{
+			Source:   fmt.Sprintf("auth file '%s'", opts.AuthFile),
+			Keychain: NewAuthFileKeychain(opts.AuthFile),
+		})
+	} else {
+		keychain = append(keychain, namedKeychain{
+			Source:   "default Docker config",
+			Keychain: regauthn.DefaultKeychain,
+		})
+	}
+
+	return keychain, nil
+}
+
+// CredHelperKeychain uses Docker credential helper for a single registry
+type CredHelperKeychain struct {
+	registry string
+	helper   string
+}
+
+var _ regauthn.Keychain = CredHelperKeychain{}
+
+func NewCredHelperKeychain(registry, helper string) CredHelperKeychain {
+	return CredHelperKeychain{registry, helper}
+}
+
+func (k CredHelperKeychain) Resolve(target regauthn.Resource) (regauthn.Authenticator, error) {
+	registry, err := regname.NewRegistry(k.registry, regname.WeakValidation)
+	if err != nil {
+		return nil, fmt.Errorf("Parsing credential helper registry '%s': %s", k.registry, err)
+	}
+
+	if registry.RegistryStr() != target.RegistryStr() {
+		return regauthn.Anonymous, nil
+	}
+
+	creds, err := credclient.Get(credclient.NewShellProgramFunc(credHelperPrefix+k.helper), authKey(target.RegistryStr()))
+	if err != nil {
+		if credentials.IsErrCredentialsNotFound(err) {
+			return regauthn.Anonymous, nil
+		}
+		return nil, fmt.Errorf("Getting credentials from '%s%s': %s", credHelperPrefix, k.helper, err)
+	}
+
+	// Identity tokens are returned with special username
+	// (https://docs.docker.com/engine/reference/commandline/login/#credential-helper-protocol)
+	if creds.Username == "<token>" {
+		return regauthn.FromConfig(regauthn.AuthConfig{Username: creds.Username, IdentityToken: creds.Secret}), nil
+	}
+
+	return regauthn.FromConfig(regauthn.AuthConfig{Username: creds.Username, Password: creds.Secret}), nil
+}
+
+// AuthFileKeychain reads credentials from a specific Docker config.json
+// or Podman auth.json (including credential helpers configured within it)
+type AuthFileKeychain struct {
+	path string
+
+	configFile *dockerconfigfile.ConfigFile
+	loadErr    error
+	loadOnce   *sync.Once
+}
+
+var _ regauthn.Keychain = &AuthFileKeychain{}
+
+func NewAuthFileKeychain(path string) *AuthFileKeychain {
+	return &AuthFileKeychain{path: path, loadOnce: &sync.Once{}}
+}
+
+func (k *AuthFileKeychain) Resolve(target regauthn.Resource) (regauthn.Authenticator, error) {
+	configFile, err := k.load()
+	if err != nil {
+		return nil, err
+	}
+
+	var authConfig, empty dockertypes.AuthConfig
+
+	for _, key := range []string{target.String(), target.RegistryStr()} {
+		authConfig, err = configFile.GetAuthConfig(authKey(key))
+		if err != nil {
+			return nil, err
+		}
+		// Server address is always populated
+		authConfig.ServerAddress = ""
+		if authConfig != empty {
+			break
+		}
+	}
+
+	if authConfig == empty {
+		return regauthn.Anonymous, nil
+	}
+
+	return regauthn.FromConfig(regauthn.AuthConfig{
+		Username:      authConfig.Username,
+		Password:      authConfig.Password,
+		Auth:          authConfig.Auth,
+		IdentityToken: authConfig.IdentityToken,
+		RegistryToken: authConfig.RegistryToken,
+	}), nil
+}
+
+func (k *AuthFileKeychain) load() (*dockerconfigfile.ConfigFile, error) {
+	k.loadOnce.Do(func() {
+		file, err := os.Open(k.path)
+		if err != nil {
+			k.loadErr = fmt.Errorf("Opening auth file: %s", err)
+			return
+		}
+		defer file.Close()
+
+		k.configFile, err = dockerconfig.LoadFromReader(file)
+		if err != nil {
+			k.loadErr = fmt.Errorf("Loading auth file '%s': %s", k.path, err)
+		}
+	})
+	return k.configFile, k.loadErr
+}
+
+// authKey returns key used for a registry in Docker config files
+// and credential helpers (Docker Hub uses a legacy URL)
+func authKey(registry string) string {
+	if registry == regname.DefaultRegistry {
+		return regauthn.DefaultAuthKey
+	}
+	return registry
+}
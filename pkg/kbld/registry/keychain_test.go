@@ -0,0 +1,115 @@
+// Copyright 2024 The Carvel Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package registry_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	ctlreg "carvel.dev/kbld/pkg/kbld/registry"
+	regauthn "github.com/google/go-containerregistry/pkg/authn"
+	regname "github.com/google/go-containerregistry/pkg/name"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthFileKeychain(t *testing.T) {
+	authFile := filepath.Join(t.TempDir(), "auth.json")
+
+	err := os.WriteFile(authFile, []byte(`{
+  "auths": {
+    "https://index.docker.io/v1/": {"auth": "aHViLXVzZXI6aHViLXBhc3M="},
+    "registry.example.com": {"username": "example-user", "password": "example-pass"},
+    "registry.example.com/team": {"username": "team-user", "password": "team-pass"}
+  }
+}`), 0600)
+	require.NoError(t, err)
+
+	keychain := ctlreg.NewAuthFileKeychain(authFile)
+
+	assertAuth := func(repo, username, password string) {
+		t.Helper()
+
+		ref, err := regname.NewRepository(repo)
+		require.NoError(t, err)
+
+		auth, err := keychain.Resolve(ref)
+		require.NoError(t, err)
+
+		authConfig, err := auth.Authorization()
+		require.NoError(t, err)
+		assert.Equal(t, username, authConfig.Username)
+		assert.Equal(t, password, authConfig.Password)
+	}
+
+	assertAuth("library/nginx", "hub-user", "hub-pass")
+	assertAuth("registry.example.com/app", "example-user", "example-pass")
+	assertAuth("registry.example.com/team", "team-user", "team-pass")
+
+	ref, err := regname.NewRepository("other.example.com/app")
+	require.NoError(t, err)
+
+	auth, err := keychain.Resolve(ref)
+	require.NoError(t, err)
+	assert.Equal(t, regauthn.Anonymous, auth)
+}
+
+func TestAuthFileKeychainMissingFile(t *testing.T) {
+	keychain := ctlreg.NewAuthFileKeychain(filepath.Join(t.TempDir(), "missing.json"))
+
+	ref, err := regname.NewRepository("registry.example.com/app")
+	require.NoError(t, err)
+
+	_, err = keychain.Resolve(ref)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Opening auth file")
+}
+
+func TestRegistryAuthInfo(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	authFile := filepath.Join(tmpDir, "auth.json")
+	err := os.WriteFile(authFile, []byte(`{"auths": {"registry.example.com": {"username": "file-user", "password": "file-pass"}}}`), 0600)
+	require.NoError(t, err)
+
+	// Credential helper protocol: server URL on stdin, JSON credentials on stdout
+	helper := `#!/bin/sh
+read server
+if [ "$server" = "helper.example.com" ]; then
+  echo '{"ServerURL":"helper.example.com","Username":"helper-user","Secret":"helper-pass"}'
+else
+  echo 'credentials not found in native keychain'
+  exit 1
+fi
+`
+	err = os.WriteFile(filepath.Join(tmpDir, "docker-credential-kbld-test"), []byte(helper), 0700)
+	require.NoError(t, err)
+
+	t.Setenv("PATH", tmpDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("KBLD_TEST_REGISTRY_HOSTNAME", "env.example.com")
+	t.Setenv("KBLD_TEST_REGISTRY_USERNAME", "env-user")
+	t.Setenv("KBLD_TEST_REGISTRY_PASSWORD", "env-pass")
+
+	registry, err := ctlreg.NewRegistry(ctlreg.Opts{
+		EnvAuthPrefix: "KBLD_TEST_REGISTRY",
+		AuthFile:      authFile,
+		CredHelpers:   map[string]string{"helper.example.com": "kbld-test"},
+	})
+	require.NoError(t, err)
+
+	expected := map[string]ctlreg.AuthInfo{
+		"env.example.com":      {Source: "env variables (KBLD_TEST_REGISTRY_*)", Username: "env-user"},
+		"helper.example.com":   {Source: "credential helper 'docker-credential-kbld-test'", Username: "helper-user"},
+		"registry.example.com": {Source: "auth file '" + authFile + "'", Username: "file-user"},
+		"other.example.com":    {Source: "anonymous"},
+	}
+
+	for registryName, expectedInfo := range expected {
+		authInfo, err := registry.AuthInfo(context.Background(), registryName)
+		require.NoError(t, err)
+		assert.Equal(t, expectedInfo, authInfo, registryName)
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2024 The Carvel Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package registry
+
+import (
+	"fmt"
+	"strings"
+
+	regname "github.com/google/go-containerregistry/pkg/name"
+)
+
+// Mirror lists endpoints (registry host with optional path prefix,
+// e.g. mirror.example.com/dockerhub) that serve content of a registry
+type Mirror struct {
+	Registry  string
+	Endpoints []string
+	// RewriteToMirror records resolved references against
+	// first mirror that serves content instead of canonical registry
+	RewriteToMirror bool
+}
+
+type mirrors struct {
+	byRegistry map[string]Mirror
+}
+
+func newMirrors(mirrorList []Mirror) (mirrors, error) {
+	result := mirrors{byRegistry: map[string]Mirror{}}
+
+	for _, mirror := range mirrorList {
+		reg, err := regname.NewRegistry(mirror.Registry, regname.WeakValidation)
+		if err != nil {
+			return mirrors{}, fmt.Errorf("Parsing mirrored registry '%s': %s", mirror.Registry, err)
+		}
+
+		if len(mirror.Endpoints) == 0 {
+			return mirrors{}, fmt.Errorf("Expected registry '%s' to have at least one mirror", mirror.Registry)
+		}
+
+		for _, endpoint := range mirror.Endpoints {
+			_, err := regname.NewRepository(strings.TrimSuffix(endpoint, "/")+"/kbld", regname.WeakValidation)
+			if err != nil {
+				return mirrors{}, fmt.Errorf("Parsing registry mirror '%s': %s", endpoint, err)
+			}
+		}
+
+		// Mirrors specified multiple times for the same registry are tried in order
+		existing := result.byRegistry[reg.Name()]
+		existing.Registry = reg.Name()
+		existing.Endpoints = append(existing.Endpoints, mirror.Endpoints...)
+		existing.RewriteToMirror = existing.RewriteToMirror || mirror.RewriteToMirror
+
+		result.byRegistry[reg.Name()] = existing
+	}
+
+	return result, nil
+}
+
+// Refs returns references within mirrors (in order) for given reference
+func (m mirrors) Refs(ref regname.Reference, refOpts ...regname.Option) ([]regname.Reference, error) {
+	mirror, found := m.byRegistry[ref.Context().RegistryStr()]
+	if !found {
+		return nil, nil
+	}
+
+	sep := ":"
+	if _, isDigest := ref.(regname.Digest); isDigest {
+		sep = "@"
+	}
+
+	var result []regname.Reference
+
+	for _, endpoint := range mirror.Endpoints {
+		mirrorRefStr := m.repository(endpoint, ref.Context()) + sep + ref.Identifier()
+
+		mirrorRef, err := regname.ParseReference(mirrorRefStr, refOpts...)
+		if err != nil {
+			return nil, fmt.Errorf("Parsing mirrored reference '%s': %s", mirrorRefStr, err)
+		}
+
+		result = append(result, mirrorRef)
+	}
+
+	return result, nil
+}
+
+// RewriteRepositories returns mirror repositories (in order) that could be
+// recorded in resolved references instead of given repository
+// (none if rewriting is not enabled for repository's registry)
+func (m mirrors) RewriteRepositories(repo regname.Repository) []string {
+	mirror, found := m.byRegistry[repo.RegistryStr()]
+	if !found || !mirror.RewriteToMirror {
+		return nil
+	}
+
+	var result []string
+
+	for _, endpoint := range mirror.Endpoints {
+		result = append(result, m.repository(endpoint, repo))
+	}
+
+	return result
+}
+
+func (m mirrors) repository(endpoint string, repo regname.Repository) string {
+	return strings.TrimSuffix(endpoint, "/") + "/" + repo.RepositoryStr()
+}
@@ -0,0 +1,342 @@
+// Copyright 2024 The Carvel Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package registry_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	ctlreg "carvel.dev/kbld/pkg/kbld/registry"
+	regname "github.com/google/go-containerregistry/pkg/name"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRegistry serves manifests (without blobs) over Docker Registry HTTP API
+type fakeRegistry struct {
+	*httptest.Server
+
+	manifests    map[string]string // keyed by repo:tag and repo@digest
+	requests     []string
+	requestsLock sync.Mutex
+}
+
+func newFakeRegistry(t *testing.T) *fakeRegistry {
+	r := &fakeRegistry{manifests: map[string]string{}}
+	r.Server = httptest.NewServer(http.HandlerFunc(r.serve))
+	t.Cleanup(r.Close)
+	return r
+}
+
+// Host returns registry hostname (it's accessed via plain HTTP since it's on localhost)
+func (r *fakeRegistry) Host() string {
+	return strings.TrimPrefix(r.URL, "http://")
+}
+
+// AddManifest makes manifest available by given tag (and its digest) and returns its digest
+func (r *fakeRegistry) AddManifest(repo, tag, manifest string) string {
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(manifest)))
+	r.manifests[repo+":"+tag] = manifest
+	r.manifests[repo+"@"+digest] = manifest
+	return digest
+}
+
+func (r *fakeRegistry) Requests() []string {
+	r.requestsLock.Lock()
+	defer r.requestsLock.Unlock()
+	return append([]string{}, r.requests...)
+}
+
+func (r *fakeRegistry) serve(w http.ResponseWriter, req *http.Request) {
+	r.requestsLock.Lock()
+	r.requests = append(r.requests, req.Method+" "+req.URL.Path)
+	r.requestsLock.Unlock()
+
+	if req.URL.Path == "/v2/" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	pieces := strings.SplitN(strings.TrimPrefix(req.URL.Path, "/v2/"), "/manifests/", 2)
+	if len(pieces) != 2 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	sep := ":"
+	if strings.HasPrefix(pieces[1], "sha256:") {
+		sep = "@"
+	}
+
+	manifest, found := r.manifests[pieces[0]+sep+pieces[1]]
+	if !found {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"errors":[{"code":"MANIFEST_UNKNOWN","message":"manifest unknown"}]}`)
+		return
+	}
+
+	w.Header().Set("Content-Type", fakeManifestMediaType(manifest))
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(manifest)))
+	w.Header().Set("Docker-Content-Digest", fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(manifest))))
+	w.WriteHeader(http.StatusOK)
+
+	if req.Method != http.MethodHead {
+		fmt.Fprint(w, manifest)
+	}
+}
+
+func fakeManifestMediaType(manifest string) string {
+	if strings.Contains(manifest, `"manifests"`) {
+		return "application/vnd.oci.image.index.v1+json"
+	}
+	return "application/vnd.oci.image.manifest.v1+json"
+}
+
+// fakeImageManifest returns unique image manifest (blobs it references are not served)
+func fakeImageManifest(id string) string {
+	return fmt.Sprintf(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json",`+
+		`"config":{"mediaType":"application/vnd.oci.image.config.v1+json","size":2,"digest":"sha256:%x"},"layers":[]}`,
+		sha256.Sum256([]byte(id)))
+}
+
+func newMirroredRegistry(t *testing.T, canonical *fakeRegistry, rewrite bool, mirrors ...*fakeRegistry) ctlreg.Registry {
+	var endpoints []string
+	for _, mirror := range mirrors {
+		endpoints = append(endpoints, mirror.Host()+"/mirror")
+	}
+
+	reg, err := ctlreg.NewRegistry(ctlreg.Opts{
+		EnvAuthPrefix: "KBLD_TEST_REGISTRY",
+		Mirrors:       []ctlreg.Mirror{{Registry: canonical.Host(), Endpoints: endpoints, RewriteToMirror: rewrite}},
+	})
+	require.NoError(t, err)
+
+	return reg
+}
+
+func TestRegistryOutputRepositoryUsesServingMirror(t *testing.T) {
+	canonical := newFakeRegistry(t)
+	mirror1 := newFakeRegistry(t)
+	mirror2 := newFakeRegistry(t)
+
+	digest := canonical.AddManifest("app", "v1", fakeImageManifest("v1"))
+	mirror2.AddManifest("mirror/app", "v1", fakeImageManifest("v1"))
+
+	repo, err := regname.NewRepository(canonical.Host() + "/app")
+	require.NoError(t, err)
+
+	t.Run("rewrites to mirror that has content", func(t *testing.T) {
+		reg := newMirroredRegistry(t, canonical, true, mirror1, mirror2)
+
+		outputRepo, err := reg.OutputRepository(context.Background(), repo, digest)
+		require.NoError(t, err)
+		assert.Equal(t, mirror2.Host()+"/mirror/app", outputRepo)
+	})
+
+	t.Run("keeps canonical repository when no mirror has content", func(t *testing.T) {
+		reg := newMirroredRegistry(t, canonical, true, mirror1)
+
+		outputRepo, err := reg.OutputRepository(context.Background(), repo, digest)
+		require.NoError(t, err)
+		assert.Equal(t, canonical.Host()+"/app", outputRepo)
+	})
+
+	t.Run("keeps canonical repository when rewriting is disabled", func(t *testing.T) {
+		reg := newMirroredRegistry(t, canonical, false, mirror1, mirror2)
+
+		outputRepo, err := reg.OutputRepository(context.Background(), repo, digest)
+		require.NoError(t, err)
+		assert.Equal(t, canonical.Host()+"/app", outputRepo)
+	})
+}
+
+func TestRegistryImageAndIndexVerifyMirrorDigests(t *testing.T) {
+	canonical := newFakeRegistry(t)
+	mirror1 := newFakeRegistry(t)
+	mirror2 := newFakeRegistry(t)
+
+	imgManifest := fakeImageManifest("v1")
+	idxManifest := fmt.Sprintf(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.index.v1+json",`+
+		`"manifests":[{"mediaType":"application/vnd.oci.image.manifest.v1+json","size":%d,"digest":"sha256:%x"}]}`,
+		len(imgManifest), sha256.Sum256([]byte(imgManifest)))
+
+	imgDigest := mirror1.AddManifest("mirror/app", "img", imgManifest)
+	mirror2.AddManifest("mirror/app", "img", imgManifest)
+
+	idxDigest := mirror1.AddManifest("mirror/app", "idx", idxManifest)
+	mirror2.AddManifest("mirror/app", "idx", idxManifest)
+
+	// Mirrors disagree on these tags
+	mirror1.AddManifest("mirror/app", "img-mismatch", fakeImageManifest("v1"))
+	mirror2.AddManifest("mirror/app", "img-mismatch", fakeImageManifest("v2"))
+	mirror1.AddManifest("mirror/app", "idx-mismatch", idxManifest)
+	mirror2.AddManifest("mirror/app", "idx-mismatch", fakeImageManifest("v2"))
+
+	reg := newMirroredRegistry(t, canonical, false, mirror1, mirror2)
+
+	t.Run("image is fetched by agreed digest", func(t *testing.T) {
+		ref, err := regname.NewTag(canonical.Host() + "/app:img")
+		require.NoError(t, err)
+
+		img, err := reg.Image(context.Background(), ref)
+		require.NoError(t, err)
+
+		digest, err := img.Digest()
+		require.NoError(t, err)
+		assert.Equal(t, imgDigest, digest.String())
+		assert.Contains(t, mirror1.Requests(), "GET /v2/mirror/app/manifests/"+imgDigest)
+	})
+
+	t.Run("index is fetched by agreed digest", func(t *testing.T) {
+		ref, err := regname.NewTag(canonical.Host() + "/app:idx")
+		require.NoError(t, err)
+
+		idx, err := reg.Index(context.Background(), ref)
+		require.NoError(t, err)
+
+		digest, err := idx.Digest()
+		require.NoError(t, err)
+		assert.Equal(t, idxDigest, digest.String())
+	})
+
+	t.Run("image fails when mirrors disagree", func(t *testing.T) {
+		ref, err := regname.NewTag(canonical.Host() + "/app:img-mismatch")
+		require.NoError(t, err)
+
+		_, err = reg.Image(context.Background(), ref)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "Expected registry mirrors to resolve '"+ref.Name()+"' to the same digest")
+	})
+
+	t.Run("index fails when mirrors disagree", func(t *testing.T) {
+		ref, err := regname.NewTag(canonical.Host() + "/app:idx-mismatch")
+		require.NoError(t, err)
+
+		_, err = reg.Index(context.Background(), ref)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "Expected registry mirrors to resolve '"+ref.Name()+"' to the same digest")
+	})
+
+	assert.Empty(t, canonical.Requests())
+}
+
+func TestRegistryGenericFromMirrors(t *testing.T) {
+	canonical := newFakeRegistry(t)
+	mirror1 := newFakeRegistry(t)
+	mirror2 := newFakeRegistry(t)
+
+	canonicalDigest := canonical.AddManifest("app", "canonical-only", fakeImageManifest("canonical"))
+
+	mirroredDigest := mirror2.AddManifest("mirror/app", "mirror2-only", fakeImageManifest("v1"))
+
+	agreedDigest := mirror1.AddManifest("mirror/app", "agreed", fakeImageManifest("agreed"))
+	mirror2.AddManifest("mirror/app", "agreed", fakeImageManifest("agreed"))
+
+	mismatch1Digest := mirror1.AddManifest("mirror/app", "mismatch", fakeImageManifest("v1"))
+	mismatch2Digest := mirror2.AddManifest("mirror/app", "mismatch", fakeImageManifest("v2"))
+
+	reg := newMirroredRegistry(t, canonical, false, mirror1, mirror2)
+
+	generic := func(refStr string) (string, error) {
+		ref, err := regname.ParseReference(refStr)
+		require.NoError(t, err)
+
+		desc, err := reg.Generic(context.Background(), ref)
+		return desc.Digest.String(), err
+	}
+
+	t.Run("skips mirrors that do not have content", func(t *testing.T) {
+		digest, err := generic(canonical.Host() + "/app:mirror2-only")
+		require.NoError(t, err)
+		assert.Equal(t, mirroredDigest, digest)
+	})
+
+	t.Run("resolves when all mirrors agree", func(t *testing.T) {
+		digest, err := generic(canonical.Host() + "/app:agreed")
+		require.NoError(t, err)
+		assert.Equal(t, agreedDigest, digest)
+	})
+
+	t.Run("resolves digest references within mirrors", func(t *testing.T) {
+		digest, err := generic(canonical.Host() + "/app@" + mirroredDigest)
+		require.NoError(t, err)
+		assert.Equal(t, mirroredDigest, digest)
+		assert.Contains(t, mirror2.Requests(), "HEAD /v2/mirror/app/manifests/"+mirroredDigest)
+	})
+
+	assert.Empty(t, canonical.Requests())
+
+	t.Run("fails when mirrors disagree (reported in mirror order)", func(t *testing.T) {
+		_, err := generic(canonical.Host() + "/app:mismatch")
+		require.Error(t, err)
+		assert.Equal(t, fmt.Sprintf("Expected registry mirrors to resolve '%s/app:mismatch' to the same digest, "+
+			"but '%s/mirror/app:mismatch' resolved to '%s' and '%s/mirror/app:mismatch' resolved to '%s'",
+			canonical.Host(), mirror1.Host(), mismatch1Digest, mirror2.Host(), mismatch2Digest), err.Error())
+	})
+
+	t.Run("falls back to canonical registry when no mirror has content", func(t *testing.T) {
+		digest, err := generic(canonical.Host() + "/app:canonical-only")
+		require.NoError(t, err)
+		assert.Equal(t, canonicalDigest, digest)
+		assert.Contains(t, canonical.Requests(), "HEAD /v2/app/manifests/canonical-only")
+	})
+}
+
+func TestRegistryMirrorsOrder(t *testing.T) {
+	canonical := newFakeRegistry(t)
+	mirror1 := newFakeRegistry(t)
+	mirror2 := newFakeRegistry(t)
+
+	digest := mirror1.AddManifest("mirror/app", "v1", fakeImageManifest("v1"))
+	mirror2.AddManifest("mirror/app", "v1", fakeImageManifest("v1"))
+
+	repo, err := regname.NewRepository(canonical.Host() + "/app")
+	require.NoError(t, err)
+
+	// Mirrors specified multiple times for the same registry are tried in order
+	reg, err := ctlreg.NewRegistry(ctlreg.Opts{
+		EnvAuthPrefix: "KBLD_TEST_REGISTRY",
+		Mirrors: []ctlreg.Mirror{
+			{Registry: canonical.Host(), Endpoints: []string{mirror2.Host() + "/mirror/"}, RewriteToMirror: true},
+			{Registry: canonical.Host(), Endpoints: []string{mirror1.Host() + "/mirror"}},
+		},
+	})
+	require.NoError(t, err)
+
+	outputRepo, err := reg.OutputRepository(context.Background(), repo, digest)
+	require.NoError(t, err)
+	assert.Equal(t, mirror2.Host()+"/mirror/app", outputRepo)
+	assert.Empty(t, mirror1.Requests())
+}
+
+func TestNewRegistryInvalidMirrors(t *testing.T) {
+	type example struct {
+		Mirror ctlreg.Mirror
+		Error  string
+	}
+
+	exs := []example{
+		{
+			Mirror: ctlreg.Mirror{Registry: "docker.io"},
+			Error:  "Expected registry 'docker.io' to have at least one mirror",
+		},
+		{
+			Mirror: ctlreg.Mirror{Registry: "docker.io", Endpoints: []string{"mirror.example.com/UPPER"}},
+			Error:  "Parsing registry mirror 'mirror.example.com/UPPER': ",
+		},
+	}
+
+	for _, ex := range exs {
+		_, err := ctlreg.NewRegistry(ctlreg.Opts{EnvAuthPrefix: "KBLD_TEST_REGISTRY", Mirrors: []ctlreg.Mirror{ex.Mirror}})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), ex.Error)
+	}
+}
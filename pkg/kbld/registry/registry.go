@@ -4,18 +4,20 @@
 package registry
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
 	"os"
 	"time"
 
-	regauthn "github.com/google/go-containerregistry/pkg/authn"
 	regname "github.com/google/go-containerregistry/pkg/name"
 	regv1 "github.com/google/go-containerregistry/pkg/v1"
 	regremote "github.com/google/go-containerregistry/pkg/v1/remote"
+	regtransport "github.com/google/go-containerregistry/pkg/v1/remote/transport"
 )
 
 type Opts struct {
@@ -23,43 +25,133 @@ type Opts struct {
 	VerifyCerts   bool
 	Insecure      bool
 	EnvAuthPrefix string
+	Mirrors       []Mirror
+	RetryPolicy   RetryPolicy
+
+	// AuthFile points to Docker config.json or Podman auth.json
+	// to use instead of default Docker config (optional)
+	AuthFile string
+	// CredHelpers maps registry to Docker credential helper name (optional)
+	CredHelpers map[string]string
+	// ClientCert is used for mutual TLS with registries that do not have
+	// registry specific certificate configured via env variables (optional)
+	ClientCert ClientCertPaths
+	// Keychains lists cloud provider keychains (e.g. ecr, gcr, acr)
+	// that derive credentials for matching registries (optional)
+	Keychains []string
 }
 
 type Registry struct {
-	opts    []regremote.Option
-	refOpts []regname.Option
+	opts        []regremote.Option
+	refOpts     []regname.Option
+	mirrors     mirrors
+	retryPolicy RetryPolicy
+	keychain    sourcedKeychain
 }
 
 func NewRegistry(opts Opts) (Registry, error) {
-	keychain := regauthn.NewMultiKeychain(NewEnvKeychain(opts.EnvAuthPrefix), regauthn.DefaultKeychain)
 	transport, err := newHTTPTransport(opts)
 	if err != nil {
 		return Registry{}, err
 	}
 
+	keychain, err := newSourcedKeychain(opts, newCloudKeychainHTTPClient())
+	if err != nil {
+		return Registry{}, err
+	}
+
 	var refOpts []regname.Option
 	if opts.Insecure {
 		refOpts = append(refOpts, regname.Insecure)
 	}
 
+	mirrors, err := newMirrors(opts.Mirrors)
+	if err != nil {
+		return Registry{}, err
+	}
+
 	return Registry{
 		opts: []regremote.Option{
-			regremote.WithTransport(transport),
-			regremote.WithAuthFromKeychain(keychain),
+			regremote.WithTransport(retryAfterTransport{transport}),
+			// Retries are controlled by retry policy instead
+			regremote.WithRetryStatusCodes(),
+			regremote.WithRetryBackoff(regremote.Backoff{Steps: 1}),
 		},
-		refOpts: refOpts,
+		refOpts:     refOpts,
+		mirrors:     mirrors,
+		retryPolicy: opts.RetryPolicy,
+		keychain:    keychain,
 	}, nil
 }
 
-func (i Registry) Generic(ref regname.Reference) (regv1.Descriptor, error) {
+func (i Registry) Generic(ctx context.Context, ref regname.Reference) (regv1.Descriptor, error) {
 	ref, err := regname.ParseReference(ref.String(), i.refOpts...)
 	if err != nil {
 		return regv1.Descriptor{}, err
 	}
 
-	desc, err := regremote.Head(ref, i.opts...)
+	mirrorRefs, err := i.mirrors.Refs(ref, i.refOpts...)
+	if err != nil {
+		return regv1.Descriptor{}, err
+	}
+
+	if len(mirrorRefs) > 0 {
+		desc, mirrorRef, err := i.genericFromMirrors(ctx, ref, mirrorRefs)
+		if mirrorRef != nil || err != nil {
+			return desc, err
+		}
+	}
+
+	var desc regv1.Descriptor
+
+	err = i.retryPolicy.Do(ctx, ref.Name(), func(ctx context.Context) error {
+		var err error
+		desc, err = i.generic(ctx, ref)
+		return err
+	})
+
+	return desc, err
+}
+
+// genericFromMirrors queries all mirrors to make sure
+// that they agree on the digest of the reference
+// (mirrors are not retried since next mirror or canonical registry is tried instead).
+// Returned reference points to resolved digest within first mirror that served it
+// (nil if none of the mirrors did).
+func (i Registry) genericFromMirrors(ctx context.Context, ref regname.Reference,
+	mirrorRefs []regname.Reference) (regv1.Descriptor, regname.Reference, error) {
+
+	var result regv1.Descriptor
+	var resultRef regname.Reference
+
+	for _, mirrorRef := range mirrorRefs {
+		desc, err := i.generic(ctx, mirrorRef)
+		if err != nil {
+			continue
+		}
+		if resultRef == nil {
+			result = desc
+			resultRef = mirrorRef
+			continue
+		}
+		if desc.Digest != result.Digest {
+			return regv1.Descriptor{}, nil, fmt.Errorf(
+				"Expected registry mirrors to resolve '%s' to the same digest, but '%s' resolved to '%s' and '%s' resolved to '%s'",
+				ref.Name(), resultRef.Name(), result.Digest, mirrorRef.Name(), desc.Digest)
+		}
+	}
+
+	if resultRef == nil {
+		return regv1.Descriptor{}, nil, nil
+	}
+
+	return result, resultRef.Context().Digest(result.Digest.String()), nil
+}
+
+func (i Registry) generic(ctx context.Context, ref regname.Reference) (regv1.Descriptor, error) {
+	desc, err := regremote.Head(ref, i.optsWithContext(ctx)...)
 	if err != nil {
-		getDesc, err := regremote.Get(ref, i.opts...)
+		getDesc, err := regremote.Get(ref, i.optsWithContext(ctx)...)
 		if err != nil {
 			return regv1.Descriptor{}, err
 		}
@@ -69,23 +161,50 @@ func (i Registry) Generic(ref regname.Reference) (regv1.Descriptor, error) {
 	return *desc, nil
 }
 
-func (i Registry) Image(ref regname.Reference) (regv1.Image, error) {
+func (i Registry) Image(ctx context.Context, ref regname.Reference) (regv1.Image, error) {
 	ref, err := regname.ParseReference(ref.String(), i.refOpts...)
 	if err != nil {
 		return nil, err
 	}
 
-	return regremote.Image(ref, i.opts...)
+	mirrorRefs, err := i.mirrors.Refs(ref, i.refOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(mirrorRefs) > 0 {
+		// Content is fetched by digest that all mirrors agreed on
+		_, mirrorRef, err := i.genericFromMirrors(ctx, ref, mirrorRefs)
+		if err != nil {
+			return nil, err
+		}
+		if mirrorRef != nil {
+			img, err := regremote.Image(mirrorRef, i.optsWithContext(ctx)...)
+			if err == nil {
+				return img, nil
+			}
+		}
+	}
+
+	var img regv1.Image
+
+	err = i.retryPolicy.Do(ctx, ref.Name(), func(ctx context.Context) error {
+		var err error
+		img, err = regremote.Image(ref, i.optsWithContext(ctx)...)
+		return err
+	})
+
+	return img, err
 }
 
-func (i Registry) WriteImage(ref regname.Reference, img regv1.Image) error {
+func (i Registry) WriteImage(ctx context.Context, ref regname.Reference, img regv1.Image) error {
 	ref, err := regname.ParseReference(ref.String(), i.refOpts...)
 	if err != nil {
 		return err
 	}
 
-	err = i.retry(func() error {
-		return regremote.Write(ref, img, i.opts...)
+	err = i.retryPolicy.Do(ctx, ref.Name(), func(ctx context.Context) error {
+		return regremote.Write(ref, img, i.optsWithContext(ctx)...)
 	})
 	if err != nil {
 		return fmt.Errorf("Writing image: %s", err)
@@ -94,23 +213,50 @@ func (i Registry) WriteImage(ref regname.Reference, img regv1.Image) error {
 	return nil
 }
 
-func (i Registry) Index(ref regname.Reference) (regv1.ImageIndex, error) {
+func (i Registry) Index(ctx context.Context, ref regname.Reference) (regv1.ImageIndex, error) {
 	ref, err := regname.ParseReference(ref.String(), i.refOpts...)
 	if err != nil {
 		return nil, err
 	}
 
-	return regremote.Index(ref, i.opts...)
+	mirrorRefs, err := i.mirrors.Refs(ref, i.refOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(mirrorRefs) > 0 {
+		// Content is fetched by digest that all mirrors agreed on
+		_, mirrorRef, err := i.genericFromMirrors(ctx, ref, mirrorRefs)
+		if err != nil {
+			return nil, err
+		}
+		if mirrorRef != nil {
+			idx, err := regremote.Index(mirrorRef, i.optsWithContext(ctx)...)
+			if err == nil {
+				return idx, nil
+			}
+		}
+	}
+
+	var idx regv1.ImageIndex
+
+	err = i.retryPolicy.Do(ctx, ref.Name(), func(ctx context.Context) error {
+		var err error
+		idx, err = regremote.Index(ref, i.optsWithContext(ctx)...)
+		return err
+	})
+
+	return idx, err
 }
 
-func (i Registry) WriteIndex(ref regname.Reference, idx regv1.ImageIndex) error {
+func (i Registry) WriteIndex(ctx context.Context, ref regname.Reference, idx regv1.ImageIndex) error {
 	ref, err := regname.ParseReference(ref.String(), i.refOpts...)
 	if err != nil {
 		return err
 	}
 
-	err = i.retry(func() error {
-		return regremote.WriteIndex(ref, idx, i.opts...)
+	err = i.retryPolicy.Do(ctx, ref.Name(), func(ctx context.Context) error {
+		return regremote.WriteIndex(ref, idx, i.optsWithContext(ctx)...)
 	})
 	if err != nil {
 		return fmt.Errorf("Writing image index: %s", err)
@@ -119,7 +265,7 @@ func (i Registry) WriteIndex(ref regname.Reference, idx regv1.ImageIndex) error
 	return nil
 }
 
-func (i Registry) WriteTag(dstRef regname.Tag, srcRef regname.Digest) error {
+func (i Registry) WriteTag(ctx context.Context, dstRef regname.Tag, srcRef regname.Digest) error {
 	dstRef, err := regname.NewTag(dstRef.String(), i.refOpts...)
 	if err != nil {
 		return err
@@ -130,13 +276,13 @@ func (i Registry) WriteTag(dstRef regname.Tag, srcRef regname.Digest) error {
 		return err
 	}
 
-	err = i.retry(func() error {
-		desc, err := regremote.Get(srcRef, i.opts...)
+	err = i.retryPolicy.Do(ctx, dstRef.Name(), func(ctx context.Context) error {
+		desc, err := regremote.Get(srcRef, i.optsWithContext(ctx)...)
 		if err != nil {
 			return err
 		}
 
-		return regremote.Tag(dstRef, desc, i.opts...)
+		return regremote.Tag(dstRef, desc, i.optsWithContext(ctx)...)
 	})
 	if err != nil {
 		return fmt.Errorf("Writing image tag: %s", err)
@@ -145,16 +291,99 @@ func (i Registry) WriteTag(dstRef regname.Tag, srcRef regname.Digest) error {
 	return nil
 }
 
-func (i Registry) ListTags(repo regname.Repository) ([]string, error) {
+func (i Registry) ListTags(ctx context.Context, repo regname.Repository) ([]string, error) {
 	repo, err := regname.NewRepository(repo.Name(), i.refOpts...)
 	if err != nil {
 		return nil, err
 	}
 
-	return regremote.List(repo, i.opts...)
+	// Any tag reference is sufficient to determine mirrored repositories
+	mirrorRefs, err := i.mirrors.Refs(repo.Tag("latest"), i.refOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, mirrorRef := range mirrorRefs {
+		tags, err := regremote.List(mirrorRef.Context(), i.optsWithContext(ctx)...)
+		if err == nil {
+			return tags, nil
+		}
+	}
+
+	var tags []string
+
+	err = i.retryPolicy.Do(ctx, repo.Name(), func(ctx context.Context) error {
+		var err error
+		tags, err = regremote.List(repo, i.optsWithContext(ctx)...)
+		return err
+	})
+
+	return tags, err
+}
+
+// OutputRepository returns repository name that should be recorded
+// in resolved references: if rewriting is enabled, repository of the first
+// mirror that serves given digest, otherwise canonical repository
+func (i Registry) OutputRepository(ctx context.Context, repo regname.Repository, digest string) (string, error) {
+	for _, mirrorRepo := range i.mirrors.RewriteRepositories(repo) {
+		mirrorRef, err := regname.NewDigest(mirrorRepo+"@"+digest, i.refOpts...)
+		if err != nil {
+			return "", fmt.Errorf("Parsing mirrored reference '%s@%s': %s", mirrorRepo, digest, err)
+		}
+
+		// Mirrors that are unavailable or do not have content are skipped
+		desc, err := i.generic(ctx, mirrorRef)
+		if err == nil && desc.Digest.String() == digest {
+			return mirrorRepo, nil
+		}
+	}
+
+	return repo.Name(), nil
+}
+
+// AuthInfo reports which credential source would be used for registry
+func (i Registry) AuthInfo(ctx context.Context, registry string) (AuthInfo, error) {
+	reg, err := regname.NewRegistry(registry, append([]regname.Option{regname.WeakValidation}, i.refOpts...)...)
+	if err != nil {
+		return AuthInfo{}, err
+	}
+
+	auth, source, err := i.keychain.WithContext(ctx).ResolveWithSource(reg)
+	if err != nil {
+		return AuthInfo{}, err
+	}
+
+	authConfig, err := auth.Authorization()
+	if err != nil {
+		return AuthInfo{}, fmt.Errorf("Getting credentials (%s): %s", source, err)
+	}
+
+	return AuthInfo{Source: source, Username: authConfig.Username}, nil
+}
+
+// IsNotFoundErr returns true if error indicates that
+// registry does not have requested manifest or repository
+func IsNotFoundErr(err error) bool {
+	var transportErr *regtransport.Error
+	if !errors.As(err, &transportErr) {
+		return false
+	}
+
+	if transportErr.StatusCode == http.StatusNotFound {
+		return true
+	}
+
+	for _, diagnostic := range transportErr.Errors {
+		switch diagnostic.Code {
+		case regtransport.ManifestUnknownErrorCode, regtransport.NameUnknownErrorCode:
+			return true
+		}
+	}
+
+	return false
 }
 
-func newHTTPTransport(opts Opts) (*http.Transport, error) {
+func newHTTPTransport(opts Opts) (http.RoundTripper, error) {
 	pool, err := x509.SystemCertPool()
 	if err != nil {
 		pool = x509.NewCertPool()
@@ -170,10 +399,15 @@ func newHTTPTransport(opts Opts) (*http.Transport, error) {
 		}
 	}
 
+	certs, err := newClientCerts(opts)
+	if err != nil {
+		return nil, err
+	}
+
 	// Copied from https://github.com/golang/go/blob/release-branch.go1.12/src/net/http/transport.go#L42-L53
 	// We want to use the DefaultTransport but change its TLSClientConfig. There
 	// isn't a clean way to do this yet: https://github.com/golang/go/issues/26013
-	return &http.Transport{
+	transport := &http.Transport{
 		Proxy: http.ProxyFromEnvironment,
 		DialContext: (&net.Dialer{
 			Timeout:   30 * time.Second,
@@ -190,17 +424,20 @@ func newHTTPTransport(opts Opts) (*http.Transport, error) {
 			RootCAs:            pool,
 			InsecureSkipVerify: (opts.VerifyCerts == false),
 		},
-	}, nil
-}
+	}
 
-func (i Registry) retry(doFunc func() error) error {
-	var lastErr error
-	for i := 0; i < 5; i++ {
-		lastErr = doFunc()
-		if lastErr == nil {
-			return nil
-		}
-		time.Sleep(1 * time.Second)
+	if certs.IsEmpty() {
+		return transport, nil
 	}
-	return fmt.Errorf("Retried 5 times: %s", lastErr)
+
+	transport.TLSClientConfig.GetClientCertificate = certs.GetClientCertificate
+
+	return clientCertsTransport{transport}, nil
+}
+
+func (i Registry) optsWithContext(ctx context.Context) []regremote.Option {
+	return append([]regremote.Option{
+		regremote.WithContext(ctx),
+		regremote.WithAuthFromKeychain(i.keychain.WithContext(ctx)),
+	}, i.opts...)
 }
@@ -0,0 +1,75 @@
+// Copyright 2024 The Carvel Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package registry_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	ctlreg "carvel.dev/kbld/pkg/kbld/registry"
+	regname "github.com/google/go-containerregistry/pkg/name"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsNotFoundErr(t *testing.T) {
+	reg, err := ctlreg.NewRegistry(ctlreg.Opts{EnvAuthPrefix: "KBLD_TEST_REGISTRY"})
+	require.NoError(t, err)
+
+	generic := func(host, refStr string) error {
+		ref, err := regname.NewTag(host + "/" + refStr)
+		require.NoError(t, err)
+
+		_, err = reg.Generic(context.Background(), ref)
+		return err
+	}
+
+	t.Run("missing manifest", func(t *testing.T) {
+		server := newFakeRegistry(t)
+
+		err := generic(server.Host(), "app:missing")
+		require.Error(t, err)
+		assert.True(t, ctlreg.IsNotFoundErr(err))
+	})
+
+	t.Run("missing repository", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/v2/" {
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"errors":[{"code":"NAME_UNKNOWN","message":"repository name not known"}]}`)
+		}))
+		defer server.Close()
+
+		err := generic(strings.TrimPrefix(server.URL, "http://"), "app:missing")
+		require.Error(t, err)
+		assert.True(t, ctlreg.IsNotFoundErr(err))
+	})
+
+	t.Run("denied access", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/v2/" {
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"errors":[{"code":"DENIED","message":"requested access to the resource is denied"}]}`)
+		}))
+		defer server.Close()
+
+		err := generic(strings.TrimPrefix(server.URL, "http://"), "app:v1")
+		require.Error(t, err)
+		assert.False(t, ctlreg.IsNotFoundErr(err))
+	})
+
+	t.Run("non registry error", func(t *testing.T) {
+		assert.False(t, ctlreg.IsNotFoundErr(fmt.Errorf("Expected registry mirrors to resolve to the same digest")))
+	})
+}
@@ -0,0 +1,193 @@
+// Copyright 2024 The Carvel Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	ctllog "carvel.dev/kbld/pkg/kbld/logger"
+	regtransport "github.com/google/go-containerregistry/pkg/v1/remote/transport"
+)
+
+const (
+	maxRetryBackoff = 30 * time.Second
+	// Retry-After values are capped so that misbehaving
+	// registries cannot stall operations indefinitely
+	MaxRetryAfter = 2 * time.Minute
+)
+
+// RetryPolicy retries failed registry operations with exponential backoff
+// (with jitter) unless server specifies how long to wait via Retry-After
+type RetryPolicy struct {
+	// Retries is a number of times failed operation is retried
+	Retries int
+	// Backoff is a delay before first retry (doubled for each subsequent retry)
+	Backoff time.Duration
+	// Logger is optionally used to report retry attempts
+	Logger *ctllog.Logger
+}
+
+func (p RetryPolicy) Do(ctx context.Context, description string, doFunc func(context.Context) error) error {
+	for attempt := 0; ; attempt++ {
+		retryAfter := &retryAfterState{}
+
+		err := doFunc(context.WithValue(ctx, retryAfterKey{}, retryAfter))
+		if err == nil {
+			return nil
+		}
+
+		if attempt >= p.Retries || !p.Retryable(err) {
+			if attempt > 0 {
+				return fmt.Errorf("Retried %d times: %s", attempt, err)
+			}
+			return err
+		}
+
+		delay, found := retryAfter.Get()
+		switch {
+		case !found:
+			delay = p.backoff(attempt)
+		case delay > MaxRetryAfter:
+			delay = MaxRetryAfter
+		}
+
+		p.log(description, attempt+1, delay, err)
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("Retried %d times: %s", attempt, err)
+		case <-time.After(delay):
+		}
+	}
+}
+
+// Retryable returns false for errors that will not
+// go away on their own (e.g. unauthorized or not found)
+func (p RetryPolicy) Retryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var transportErr *regtransport.Error
+	if errors.As(err, &transportErr) {
+		switch transportErr.StatusCode {
+		case http.StatusRequestTimeout, http.StatusTooManyRequests:
+			return true
+		default:
+			return transportErr.StatusCode >= 500
+		}
+	}
+
+	// Network level errors are typically transient
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF)
+}
+
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.Backoff
+	for i := 0; i < attempt && delay < maxRetryBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryBackoff {
+		delay = maxRetryBackoff
+	}
+	if delay <= 0 {
+		return 0
+	}
+	// Use random delay between half and full backoff so that
+	// concurrent operations do not retry at the same time
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+func (p RetryPolicy) log(description string, retry int, delay time.Duration, err error) {
+	if p.Logger == nil {
+		return
+	}
+
+	msg := fmt.Sprintf("retrying %s (%d of %d) in %s: %s", description, retry, p.Retries, delay.Round(time.Millisecond), err)
+
+	p.Logger.NewPrefixedWriter("registry | ").WriteStr("%s\n", msg)
+	p.Logger.Event(ctllog.Event{Type: ctllog.EventRegistryRetry, URL: description, Message: msg})
+}
+
+type retryAfterKey struct{}
+
+// retryAfterState records Retry-After duration returned
+// for any of the requests made during an operation attempt
+type retryAfterState struct {
+	lock     sync.Mutex
+	duration time.Duration
+	found    bool
+}
+
+func (s *retryAfterState) Set(duration time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.duration = duration
+	s.found = true
+}
+
+func (s *retryAfterState) Get() (time.Duration, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.duration, s.found
+}
+
+// retryAfterTransport captures Retry-After header of throttled responses
+// since registry client errors do not include response headers
+type retryAfterTransport struct {
+	http.RoundTripper
+}
+
+func (t retryAfterTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.RoundTripper.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		if state, ok := req.Context().Value(retryAfterKey{}).(*retryAfterState); ok {
+			if duration, ok := ParseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+				state.Set(duration)
+			}
+		}
+	}
+
+	return resp, nil
+}
+
+// ParseRetryAfter parses Retry-After header value
+// specified either as seconds or as HTTP date
+func ParseRetryAfter(val string, now time.Time) (time.Duration, bool) {
+	if len(val) == 0 {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(val); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	date, err := http.ParseTime(val)
+	if err != nil {
+		return 0, false
+	}
+
+	if duration := date.Sub(now); duration > 0 {
+		return duration, true
+	}
+	return 0, true
+}
@@ -0,0 +1,125 @@
+// Copyright 2024 The Carvel Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package registry_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	ctllog "carvel.dev/kbld/pkg/kbld/logger"
+	ctlreg "carvel.dev/kbld/pkg/kbld/registry"
+	regname "github.com/google/go-containerregistry/pkg/name"
+	regtransport "github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	duration, found := ctlreg.ParseRetryAfter("7", now)
+	assert.True(t, found)
+	assert.Equal(t, 7*time.Second, duration)
+
+	duration, found = ctlreg.ParseRetryAfter("Mon, 01 Jan 2024 00:00:30 GMT", now)
+	assert.True(t, found)
+	assert.Equal(t, 30*time.Second, duration)
+
+	_, found = ctlreg.ParseRetryAfter("", now)
+	assert.False(t, found)
+
+	_, found = ctlreg.ParseRetryAfter("soon", now)
+	assert.False(t, found)
+}
+
+func TestRetryPolicyHonorsRetryAfterAndStopsOnNonRetryableErrors(t *testing.T) {
+	var manifestRequests int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.URL.Path, "/manifests/") {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		if atomic.AddInt32(&manifestRequests, 1) <= 3 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	// Backoff is long enough to fail the test unless Retry-After is used
+	registry, err := ctlreg.NewRegistry(ctlreg.Opts{
+		Insecure:      true,
+		EnvAuthPrefix: "KBLD_TEST_REGISTRY",
+		RetryPolicy:   ctlreg.RetryPolicy{Retries: 5, Backoff: time.Hour},
+	})
+	require.NoError(t, err)
+
+	ref, err := regname.NewTag(strings.TrimPrefix(server.URL, "http://")+"/app:v1", regname.Insecure)
+	require.NoError(t, err)
+
+	_, err = registry.Generic(context.Background(), ref)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Retried 1 times")
+
+	// First attempt makes HEAD and GET requests (both throttled),
+	// second attempt is throttled on HEAD and fails with not found on GET
+	assert.Equal(t, int32(4), atomic.LoadInt32(&manifestRequests))
+}
+
+func TestRetryPolicyClampsRetryAfter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.URL.Path, "/manifests/") {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	var logOutput bytes.Buffer
+	logger := ctllog.NewLogger(&logOutput)
+
+	registry, err := ctlreg.NewRegistry(ctlreg.Opts{
+		Insecure:      true,
+		EnvAuthPrefix: "KBLD_TEST_REGISTRY",
+		RetryPolicy:   ctlreg.RetryPolicy{Retries: 1, Logger: &logger},
+	})
+	require.NoError(t, err)
+
+	ref, err := regname.NewTag(strings.TrimPrefix(server.URL, "http://")+"/app:v1", regname.Insecure)
+	require.NoError(t, err)
+
+	// Context is cancelled while waiting so that test does not wait for clamped delay
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	_, err = registry.Generic(ctx, ref)
+	require.Error(t, err)
+
+	assert.Contains(t, logOutput.String(), "(1 of 1) in "+ctlreg.MaxRetryAfter.String()+": ")
+}
+
+func TestRetryPolicyRetryable(t *testing.T) {
+	policy := ctlreg.RetryPolicy{}
+
+	assert.False(t, policy.Retryable(context.Canceled))
+	assert.False(t, policy.Retryable(&regtransport.Error{StatusCode: http.StatusUnauthorized}))
+	assert.False(t, policy.Retryable(&regtransport.Error{StatusCode: http.StatusNotFound}))
+	assert.True(t, policy.Retryable(&regtransport.Error{StatusCode: http.StatusTooManyRequests}))
+	assert.True(t, policy.Retryable(&regtransport.Error{StatusCode: http.StatusServiceUnavailable}))
+	assert.False(t, policy.Retryable(errors.New("Unknown env variable")))
+	assert.True(t, policy.Retryable(&net.OpError{Op: "dial", Err: errors.New("connection refused")}))
+}
@@ -0,0 +1,421 @@
+// Copyright 2024 The Carvel Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package resources
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// JSONPath is a subset of JSONPath (https://goessner.net/articles/JsonPath/)
+// sufficient to select fields within a document. Supported syntax:
+//   - child by key: spec.containers, ['spec']
+//   - wildcard: spec.*, containers[*]
+//   - array index: containers[0], containers[-1]
+//   - recursive descent: ..image
+//   - filters: containers[?(@.name=="sidecar")], containers[?(@.image)]
+//
+// Leading '$' and surrounding '{}' (kubectl style) are optional.
+type JSONPath struct {
+	str      string
+	segments []jsonPathSegment
+}
+
+type jsonPathSegment struct {
+	recursive bool
+
+	key      *string
+	wildcard bool
+	index    *int
+	filter   *jsonPathFilter
+}
+
+type jsonPathFilter struct {
+	path JSONPath
+	// Only existence is checked when operator is empty
+	operator string
+	value    interface{}
+}
+
+type jsonPathNode struct {
+	path Path
+	val  interface{}
+}
+
+func NewJSONPath(str string) (JSONPath, error) {
+	trimmed := strings.TrimSpace(str)
+	if strings.HasPrefix(trimmed, "{") && strings.HasSuffix(trimmed, "}") {
+		trimmed = strings.TrimSpace(trimmed[1 : len(trimmed)-1])
+	}
+	trimmed = strings.TrimPrefix(trimmed, "$")
+
+	segments, err := parseJSONPathSegments(trimmed)
+	if err != nil {
+		return JSONPath{}, fmt.Errorf("Parsing JSONPath '%s': %s", str, err)
+	}
+	if len(segments) == 0 {
+		return JSONPath{}, fmt.Errorf("Parsing JSONPath '%s': Expected at least one path segment", str)
+	}
+
+	return JSONPath{str: str, segments: segments}, nil
+}
+
+func (p JSONPath) String() string { return p.str }
+
+// Evaluate returns paths of all fields within document that are selected by this JSONPath
+func (p JSONPath) Evaluate(doc interface{}) []Path {
+	var result []Path
+	for _, node := range p.evaluate(doc) {
+		result = append(result, node.path)
+	}
+	return result
+}
+
+func (p JSONPath) evaluate(doc interface{}) []jsonPathNode {
+	nodes := []jsonPathNode{{path: Path{}, val: doc}}
+
+	for _, segment := range p.segments {
+		if segment.recursive {
+			var expanded []jsonPathNode
+			for _, node := range nodes {
+				expanded = append(expanded, jsonPathDescendants(node)...)
+			}
+			nodes = expanded
+		}
+
+		var selected []jsonPathNode
+		for _, node := range nodes {
+			selected = append(selected, segment.selectFrom(node)...)
+		}
+		nodes = selected
+	}
+
+	return nodes
+}
+
+func (s jsonPathSegment) selectFrom(node jsonPathNode) []jsonPathNode {
+	switch {
+	case s.key != nil:
+		for _, child := range jsonPathChildren(node) {
+			if child.key != nil && *child.key == *s.key {
+				return []jsonPathNode{child.jsonPathNode}
+			}
+		}
+		return nil
+
+	case s.index != nil:
+		typedArr, ok := node.val.([]interface{})
+		if !ok {
+			return nil
+		}
+		idx := *s.index
+		if idx < 0 {
+			idx += len(typedArr)
+		}
+		if idx < 0 || idx >= len(typedArr) {
+			return nil
+		}
+		return []jsonPathNode{{node.path.with(NewPathPartFromIndex(idx)), typedArr[idx]}}
+
+	case s.wildcard:
+		var result []jsonPathNode
+		for _, child := range jsonPathChildren(node) {
+			result = append(result, child.jsonPathNode)
+		}
+		return result
+
+	case s.filter != nil:
+		var result []jsonPathNode
+		for _, child := range jsonPathChildren(node) {
+			if s.filter.matches(child.val) {
+				result = append(result, child.jsonPathNode)
+			}
+		}
+		return result
+
+	default:
+		panic("Unknown JSONPath segment")
+	}
+}
+
+func (f jsonPathFilter) matches(val interface{}) bool {
+	nodes := f.path.evaluate(val)
+	if len(f.operator) == 0 {
+		return len(nodes) > 0
+	}
+
+	for _, node := range nodes {
+		equal := jsonPathValuesEqual(node.val, f.value)
+		if (f.operator == "==" && equal) || (f.operator == "!=" && !equal) {
+			return true
+		}
+	}
+	return false
+}
+
+type jsonPathChild struct {
+	jsonPathNode
+	key *string
+}
+
+func jsonPathChildren(node jsonPathNode) []jsonPathChild {
+	var result []jsonPathChild
+
+	switch typedObj := node.val.(type) {
+	case map[string]interface{}:
+		for _, k := range jsonPathSortedKeys(typedObj) {
+			k := k // copy
+			result = append(result, jsonPathChild{jsonPathNode{node.path.with(NewPathPartFromString(k)), typedObj[k]}, &k})
+		}
+
+	case map[string]string:
+		keys := make([]string, 0, len(typedObj))
+		for k := range typedObj {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			k := k // copy
+			result = append(result, jsonPathChild{jsonPathNode{node.path.with(NewPathPartFromString(k)), typedObj[k]}, &k})
+		}
+
+	case []interface{}:
+		for i, v := range typedObj {
+			result = append(result, jsonPathChild{jsonPathNode{node.path.with(NewPathPartFromIndex(i)), v}, nil})
+		}
+	}
+
+	return result
+}
+
+func jsonPathDescendants(node jsonPathNode) []jsonPathNode {
+	result := []jsonPathNode{node}
+	for _, child := range jsonPathChildren(node) {
+		result = append(result, jsonPathDescendants(child.jsonPathNode)...)
+	}
+	return result
+}
+
+func jsonPathSortedKeys(obj map[string]interface{}) []string {
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func jsonPathValuesEqual(actual, expected interface{}) bool {
+	actualNum, actualIsNum := jsonPathNumber(actual)
+	expectedNum, expectedIsNum := jsonPathNumber(expected)
+	if actualIsNum && expectedIsNum {
+		return actualNum == expectedNum
+	}
+	return reflect.DeepEqual(actual, expected)
+}
+
+func jsonPathNumber(val interface{}) (float64, bool) {
+	switch typedVal := val.(type) {
+	case int:
+		return float64(typedVal), true
+	case int64:
+		return float64(typedVal), true
+	case float64:
+		return typedVal, true
+	default:
+		return 0, false
+	}
+}
+
+func parseJSONPathSegments(str string) ([]jsonPathSegment, error) {
+	var segments []jsonPathSegment
+
+	for i := 0; i < len(str); {
+		var segment jsonPathSegment
+
+		switch {
+		case strings.HasPrefix(str[i:], ".."):
+			segment.recursive = true
+			i += 2
+
+		case str[i] == '.':
+			i++
+
+		case str[i] == '[':
+			// bracket notation does not require a dot
+
+		case i == 0:
+			// allow paths without leading dot (e.g. spec.containers)
+
+		default:
+			return nil, fmt.Errorf("Unexpected character '%c' at position %d", str[i], i)
+		}
+
+		if i < len(str) && str[i] == '[' {
+			end, err := jsonPathBracketEnd(str, i)
+			if err != nil {
+				return nil, err
+			}
+			err = segment.parseBracket(str[i+1 : end])
+			if err != nil {
+				return nil, err
+			}
+			i = end + 1
+		} else {
+			end := i
+			for end < len(str) && str[end] != '.' && str[end] != '[' {
+				end++
+			}
+			name := str[i:end]
+			if len(name) == 0 {
+				return nil, fmt.Errorf("Expected key name at position %d", i)
+			}
+			if name == "*" {
+				segment.wildcard = true
+			} else {
+				segment.key = &name
+			}
+			i = end
+		}
+
+		segments = append(segments, segment)
+	}
+
+	return segments, nil
+}
+
+func (s *jsonPathSegment) parseBracket(content string) error {
+	content = strings.TrimSpace(content)
+
+	switch {
+	case content == "*":
+		s.wildcard = true
+
+	case jsonPathIsQuoted(content):
+		key := content[1 : len(content)-1]
+		s.key = &key
+
+	case strings.HasPrefix(content, "?(") && strings.HasSuffix(content, ")"):
+		filter, err := parseJSONPathFilter(content[2 : len(content)-1])
+		if err != nil {
+			return err
+		}
+		s.filter = &filter
+
+	default:
+		idx, err := strconv.Atoi(content)
+		if err != nil {
+			return fmt.Errorf("Unsupported bracket expression '[%s]'", content)
+		}
+		s.index = &idx
+	}
+
+	return nil
+}
+
+func parseJSONPathFilter(expr string) (jsonPathFilter, error) {
+	expr = strings.TrimSpace(expr)
+
+	var filter jsonPathFilter
+	left := expr
+
+	if opIdx := jsonPathOperatorIndex(expr); opIdx >= 0 {
+		filter.operator = expr[opIdx : opIdx+2]
+		left = strings.TrimSpace(expr[:opIdx])
+
+		val, err := parseJSONPathLiteral(strings.TrimSpace(expr[opIdx+2:]))
+		if err != nil {
+			return jsonPathFilter{}, fmt.Errorf("Parsing filter '%s': %s", expr, err)
+		}
+		filter.value = val
+	}
+
+	if !strings.HasPrefix(left, "@") || len(left) < 2 {
+		return jsonPathFilter{}, fmt.Errorf("Parsing filter '%s': Expected left side to reference current element (e.g. @.name)", expr)
+	}
+
+	segments, err := parseJSONPathSegments(left[1:])
+	if err != nil {
+		return jsonPathFilter{}, fmt.Errorf("Parsing filter '%s': %s", expr, err)
+	}
+
+	filter.path = JSONPath{str: left, segments: segments}
+
+	return filter, nil
+}
+
+func parseJSONPathLiteral(str string) (interface{}, error) {
+	switch {
+	case jsonPathIsQuoted(str):
+		return str[1 : len(str)-1], nil
+	case str == "true":
+		return true, nil
+	case str == "false":
+		return false, nil
+	case str == "null":
+		return nil, nil
+	}
+
+	num, err := strconv.ParseFloat(str, 64)
+	if err != nil {
+		return nil, fmt.Errorf("Unsupported literal '%s'", str)
+	}
+	return num, nil
+}
+
+// jsonPathOperatorIndex finds comparison operator outside of quoted strings
+func jsonPathOperatorIndex(expr string) int {
+	var quote byte
+	for i := 0; i < len(expr)-1; i++ {
+		switch {
+		case quote != 0:
+			if expr[i] == quote {
+				quote = 0
+			}
+		case expr[i] == '"' || expr[i] == '\'':
+			quote = expr[i]
+		case expr[i:i+2] == "==" || expr[i:i+2] == "!=":
+			return i
+		}
+	}
+	return -1
+}
+
+// jsonPathBracketEnd finds closing bracket taking into account quotes and nested brackets
+func jsonPathBracketEnd(str string, start int) (int, error) {
+	var quote byte
+	depth := 0
+
+	for i := start; i < len(str); i++ {
+		switch {
+		case quote != 0:
+			if str[i] == quote {
+				quote = 0
+			}
+		case str[i] == '"' || str[i] == '\'':
+			quote = str[i]
+		case str[i] == '[':
+			depth++
+		case str[i] == ']':
+			depth--
+			if depth == 0 {
+				return i, nil
+			}
+		}
+	}
+
+	return 0, fmt.Errorf("Expected closing bracket for '[' at position %d", start)
+}
+
+func jsonPathIsQuoted(str string) bool {
+	return len(str) >= 2 && ((str[0] == '"' && str[len(str)-1] == '"') ||
+		(str[0] == '\'' && str[len(str)-1] == '\''))
+}
+
+func (p Path) with(part *PathPart) Path {
+	return append(append(Path{}, p...), part)
+}
@@ -0,0 +1,73 @@
+// Copyright 2024 The Carvel Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package resources_test
+
+import (
+	"testing"
+
+	ctlres "carvel.dev/kbld/pkg/kbld/resources"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONPathEvaluate(t *testing.T) {
+	doc := map[string]interface{}{
+		"spec": map[string]interface{}{
+			"replicas": int64(2),
+			"containers": []interface{}{
+				map[string]interface{}{"name": "app", "image": "nginx1", "port": float64(80)},
+				map[string]interface{}{"name": "sidecar", "image": "nginx2"},
+			},
+		},
+	}
+
+	exs := []struct {
+		JSONPath string
+		Paths    []string
+	}{
+		{`spec.containers[0].image`, []string{"spec,containers,0,image"}},
+		{`$.spec.containers[-1].image`, []string{"spec,containers,1,image"}},
+		{`{.spec['replicas']}`, []string{"spec,replicas"}},
+		{`spec.containers[*].name`, []string{"spec,containers,0,name", "spec,containers,1,name"}},
+		{`spec.containers[?(@.name=="sidecar")].image`, []string{"spec,containers,1,image"}},
+		{`spec.containers[?(@.name != 'sidecar')].image`, []string{"spec,containers,0,image"}},
+		{`spec.containers[?(@.port==80)].name`, []string{"spec,containers,0,name"}},
+		{`spec.containers[?(@.port)].name`, []string{"spec,containers,0,name"}},
+		{`..image`, []string{"spec,containers,0,image", "spec,containers,1,image"}},
+		{`spec.missing[0]`, nil},
+	}
+
+	for _, ex := range exs {
+		t.Run(ex.JSONPath, func(t *testing.T) {
+			jsonPath, err := ctlres.NewJSONPath(ex.JSONPath)
+			require.NoError(t, err)
+
+			var paths []string
+			for _, path := range jsonPath.Evaluate(doc) {
+				paths = append(paths, path.AsString())
+			}
+			assert.Equal(t, ex.Paths, paths)
+		})
+	}
+}
+
+func TestJSONPathParseErrors(t *testing.T) {
+	exs := []struct {
+		JSONPath string
+		Error    string
+	}{
+		{``, "Parsing JSONPath '': Expected at least one path segment"},
+		{`spec.containers[0`, "Parsing JSONPath 'spec.containers[0': Expected closing bracket for '[' at position 15"},
+		{`spec..`, "Parsing JSONPath 'spec..': Expected key name at position 6"},
+		{`spec[foo]`, "Parsing JSONPath 'spec[foo]': Unsupported bracket expression '[foo]'"},
+		{`spec[?(name=="a")]`, "Parsing JSONPath 'spec[?(name==\"a\")]': Parsing filter 'name==\"a\"': Expected left side to reference current element (e.g. @.name)"},
+	}
+
+	for _, ex := range exs {
+		t.Run(ex.JSONPath, func(t *testing.T) {
+			_, err := ctlres.NewJSONPath(ex.JSONPath)
+			assert.EqualError(t, err, ex.Error)
+		})
+	}
+}
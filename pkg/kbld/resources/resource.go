@@ -19,6 +19,7 @@ type Resource interface {
 	APIVersion() string
 	APIGroup() string
 
+	Namespace() string
 	Name() string
 	Description() string
 
@@ -0,0 +1,102 @@
+// Copyright 2024 The Carvel Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package resources
+
+import (
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+type ResourceMatcher interface {
+	Matches(Resource) bool
+}
+
+type APIVersionKindMatcher struct {
+	APIVersion string
+	Kind       string
+}
+
+var _ ResourceMatcher = APIVersionKindMatcher{}
+
+func (m APIVersionKindMatcher) Matches(res Resource) bool {
+	if len(m.APIVersion) > 0 && m.APIVersion != res.APIVersion() {
+		return false
+	}
+	if len(m.Kind) > 0 && m.Kind != res.Kind() {
+		return false
+	}
+	return true
+}
+
+type KindNamespaceNameMatcher struct {
+	Kind      string
+	Namespace string
+	Name      string
+}
+
+var _ ResourceMatcher = KindNamespaceNameMatcher{}
+
+func (m KindNamespaceNameMatcher) Matches(res Resource) bool {
+	if len(m.Kind) > 0 && m.Kind != res.Kind() {
+		return false
+	}
+	if len(m.Namespace) > 0 && m.Namespace != res.Namespace() {
+		return false
+	}
+	if len(m.Name) > 0 && m.Name != res.Name() {
+		return false
+	}
+	return true
+}
+
+type LabelSelectorMatcher struct {
+	Selector labels.Selector
+}
+
+var _ ResourceMatcher = LabelSelectorMatcher{}
+
+func (m LabelSelectorMatcher) Matches(res Resource) bool {
+	return m.Selector.Matches(labels.Set(res.Labels()))
+}
+
+// AnyMatcher matches when at least one of matchers matches
+type AnyMatcher struct {
+	Matchers []ResourceMatcher
+}
+
+var _ ResourceMatcher = AnyMatcher{}
+
+func (m AnyMatcher) Matches(res Resource) bool {
+	for _, m := range m.Matchers {
+		if m.Matches(res) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllMatcher matches when all matchers match (hence matches everything if there are no matchers)
+type AllMatcher struct {
+	Matchers []ResourceMatcher
+}
+
+var _ ResourceMatcher = AllMatcher{}
+
+func (m AllMatcher) Matches(res Resource) bool {
+	for _, m := range m.Matchers {
+		if !m.Matches(res) {
+			return false
+		}
+	}
+	return true
+}
+
+type NotMatcher struct {
+	Matcher ResourceMatcher
+}
+
+var _ ResourceMatcher = NotMatcher{}
+
+func (m NotMatcher) Matches(res Resource) bool {
+	return !m.Matcher.Matches(res)
+}
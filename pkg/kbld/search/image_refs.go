@@ -7,6 +7,7 @@ import (
 	"crypto/rand"
 	"encoding/json"
 	"fmt"
+	"regexp"
 	"strings"
 
 	ctlconf "carvel.dev/kbld/pkg/kbld/config"
@@ -25,11 +26,13 @@ func NewImageRefs(res interface{}, searchRules []ctlconf.SearchRule) ImageRefs {
 	return ImageRefs{res, searchRules}
 }
 
-func (refs ImageRefs) Visit(visitorFunc ImageRefsVisitorFunc) {
-	visitorFunc.Apply(refs.res, refs.searchRules)
+// Visit calls visitorFunc for each found image reference. Search rules are
+// user provided, hence invalid rules (e.g. regexps) are reported as errors.
+func (refs ImageRefs) Visit(visitorFunc ImageRefsVisitorFunc) error {
+	return visitorFunc.Apply(refs.res, refs.searchRules)
 }
 
-func (v ImageRefsVisitorFunc) Apply(res interface{}, searchRules []ctlconf.SearchRule) {
+func (v ImageRefsVisitorFunc) Apply(res interface{}, searchRules []ctlconf.SearchRule) error {
 	tmpRefs := map[string]string{}
 	tmpRefPrefix := v.randomPrefix()
 	tmpRefIdx := 0
@@ -50,91 +53,142 @@ func (v ImageRefsVisitorFunc) Apply(res interface{}, searchRules []ctlconf.Searc
 	// Use a single matcher that represents all rules instead
 	// so that each leaf value (string) is found once
 	// even if it matches multiple search rules
-	NewFields(res, RulesMatcher{searchRules}).Visit(v.extractValueFunc(insertTmpRefsFunc))
+	rulesMatcher, err := NewRulesMatcher(searchRules, res)
+	if err != nil {
+		return err
+	}
+
+	// Fields visitor does not propagate errors, hence record first one
+	var visitErr error
+
+	NewFields(res, rulesMatcher).Visit(v.extractValueFunc(insertTmpRefsFunc, &visitErr))
+
+	if visitErr != nil {
+		return visitErr
+	}
+
+	// Tmp refs may be embedded within a larger value (see regexp update strategy)
+	tmpRefRegexp := regexp.MustCompile(regexp.QuoteMeta(tmpRefPrefix) + `[0-9]+__`)
 
 	resolveTmpRefsFunc := func(val string) (string, bool) {
-		if actualRef, found := tmpRefs[val]; found {
-			delete(tmpRefs, val)
-			return actualRef, true
+		var found bool
+		newVal := tmpRefRegexp.ReplaceAllStringFunc(val, func(tmpRefID string) string {
+			if actualRef, ok := tmpRefs[tmpRefID]; ok {
+				delete(tmpRefs, tmpRefID)
+				found = true
+				return actualRef
+			}
+			return tmpRefID
+		})
+		if !found {
+			return "", false // TODO panic?
 		}
-		return "", false // TODO panic?
+		return newVal, true
 	}
 
-	NewFields(res, tmpRefMatcher{tmpRefPrefix}).Visit(v.extractValueFunc(resolveTmpRefsFunc))
+	NewFields(res, tmpRefMatcher{tmpRefPrefix}).Visit(v.extractValueFunc(resolveTmpRefsFunc, &visitErr))
+
+	if visitErr != nil {
+		return visitErr
+	}
 
 	if len(tmpRefs) > 0 {
 		panic("ImageRefs: Expected all tmp refs to be found")
 	}
+
+	return nil
 }
 
-func (v ImageRefsVisitorFunc) extractValueFunc(visitorFunc ImageRefsVisitorFunc) FieldsVisitorFunc {
+func (v ImageRefsVisitorFunc) extractValueFunc(visitorFunc ImageRefsVisitorFunc, visitErr *error) FieldsVisitorFunc {
 	return func(val interface{}, ext ctlconf.SearchRuleUpdateStrategy) (interface{}, bool) {
-		switch {
-		case ext.None != nil:
+		if *visitErr != nil {
 			return val, false
+		}
 
-		case ext.EntireString != nil:
-			valStr, ok := val.(string)
-			if !ok {
-				return val, false
-			}
-			return visitorFunc(valStr)
-
-		case ext.JSON != nil:
-			return v.extractValueAsJSON(val, ext.JSON.SearchRules)
+		newVal, updated, err := v.extractValue(val, ext, visitorFunc)
+		if err != nil {
+			*visitErr = err
+			return val, false
+		}
+		return newVal, updated
+	}
+}
 
-		case ext.YAML != nil:
-			// Prefer to decode as JSON since JSON is valid YAML.
-			// Only works for a single YAML document value.
-			val, updated := v.extractValueAsJSON(val, ext.YAML.SearchRules)
-			if updated {
-				return val, updated
-			}
+func (v ImageRefsVisitorFunc) extractValue(val interface{},
+	ext ctlconf.SearchRuleUpdateStrategy, visitorFunc ImageRefsVisitorFunc) (interface{}, bool, error) {
 
-			return v.extractValueAsYAML(val, ext.YAML.SearchRules)
+	switch {
+	case ext.None != nil:
+		return val, false, nil
 
-		default:
-			panic("Unknown extraction type")
+	case ext.EntireString != nil:
+		valStr, ok := val.(string)
+		if !ok {
+			return val, false, nil
+		}
+		newVal, updated := visitorFunc(valStr)
+		return newVal, updated, nil
+
+	case ext.JSON != nil:
+		return v.extractValueAsJSON(val, ext.JSON.SearchRules)
+
+	case ext.YAML != nil:
+		// Prefer to decode as JSON since JSON is valid YAML.
+		// Only works for a single YAML document value.
+		val, updated, err := v.extractValueAsJSON(val, ext.YAML.SearchRules)
+		if err != nil || updated {
+			return val, updated, err
 		}
+
+		return v.extractValueAsYAML(val, ext.YAML.SearchRules)
+
+	case ext.Regexp != nil:
+		return v.extractValueAsRegexpCapture(val, *ext.Regexp, visitorFunc)
+
+	default:
+		panic("Unknown extraction type")
 	}
 }
 
 func (v ImageRefsVisitorFunc) extractValueAsJSON(val interface{},
-	searchRules []ctlconf.SearchRule) (interface{}, bool) {
+	searchRules []ctlconf.SearchRule) (interface{}, bool, error) {
 
 	valStr, ok := val.(string)
 	if !ok {
-		return val, false
+		return val, false, nil
 	}
 
 	var decodedVal interface{}
 
 	err := json.Unmarshal([]byte(valStr), &decodedVal)
 	if err != nil {
-		return val, false
+		return val, false, nil
 	}
 
-	v.Apply(decodedVal, searchRules)
+	err = v.Apply(decodedVal, searchRules)
+	if err != nil {
+		return val, false, err
+	}
 
 	valBs, err := json.Marshal(decodedVal)
 	if err != nil {
 		panic(fmt.Sprintf("ObjVisitor: Encoding as JSON: %s", err))
 	}
 
-	return string(valBs), true
+	return string(valBs), true, nil
 }
 
 func (v ImageRefsVisitorFunc) extractValueAsYAML(val interface{},
-	searchRules []ctlconf.SearchRule) (interface{}, bool) {
+	searchRules []ctlconf.SearchRule) (interface{}, bool, error) {
 
 	valStr, ok := val.(string)
 	if !ok {
-		return val, false
+		return val, false, nil
 	}
 
 	docs, err := ctlres.NewYAMLFile(ctlres.NewBytesSource([]byte(valStr))).Docs()
 	if err != nil {
-		return val, false
+		return val, false, nil
 	}
 
 	var decodedVals []interface{}
@@ -145,7 +199,7 @@ func (v ImageRefsVisitorFunc) extractValueAsYAML(val interface{},
 
 		err := yaml.Unmarshal(doc, &decodedVal)
 		if err != nil {
-			return val, false
+			return val, false, nil
 		}
 
 		// Skip over empty documents
@@ -157,7 +211,10 @@ func (v ImageRefsVisitorFunc) extractValueAsYAML(val interface{},
 	var result string
 
 	for _, decodedVal := range decodedVals {
-		v.Apply(decodedVal, searchRules)
+		err := v.Apply(decodedVal, searchRules)
+		if err != nil {
+			return val, false, err
+		}
 
 		valBs, err := yaml.Marshal(decodedVal)
 		if err != nil {
@@ -167,7 +224,40 @@ func (v ImageRefsVisitorFunc) extractValueAsYAML(val interface{},
 		result += "---\n" + string(valBs)
 	}
 
-	return result, true
+	return result, true, nil
+}
+
+func (v ImageRefsVisitorFunc) extractValueAsRegexpCapture(val interface{},
+	strategy ctlconf.SearchRuleUpdateStrategyRegexp, visitorFunc ImageRefsVisitorFunc) (interface{}, bool, error) {
+
+	valStr, ok := val.(string)
+	if !ok {
+		return val, false, nil
+	}
+
+	re, err := compiledRegexps.Get(strategy.Regexp)
+	if err != nil {
+		return val, false, err
+	}
+
+	groupIdx, err := strategy.CaptureGroupIndex(re)
+	if err != nil {
+		return val, false, fmt.Errorf("Finding search rule capture group: %s", err)
+	}
+
+	matchIdxs := re.FindStringSubmatchIndex(valStr)
+	if matchIdxs == nil || matchIdxs[2*groupIdx] < 0 {
+		return val, false, nil
+	}
+
+	start, end := matchIdxs[2*groupIdx], matchIdxs[2*groupIdx+1]
+
+	newVal, updated := visitorFunc(valStr[start:end])
+	if !updated {
+		return val, false, nil
+	}
+
+	return valStr[:start] + newVal + valStr[end:], true, nil
 }
 
 func (ImageRefsVisitorFunc) randomPrefix() string {
@@ -191,7 +281,7 @@ var _ Matcher = tmpRefMatcher{}
 
 func (m tmpRefMatcher) Matches(_ ctlres.Path, value interface{}) (bool, ctlconf.SearchRuleUpdateStrategy) {
 	if valStr, ok := value.(string); ok {
-		return strings.HasPrefix(valStr, m.prefix), (ctlconf.SearchRule{}).UpdateStrategyWithDefaults()
+		return strings.Contains(valStr, m.prefix), (ctlconf.SearchRule{}).UpdateStrategyWithDefaults()
 	}
 	return false, ctlconf.SearchRuleUpdateStrategy{}
 }
@@ -260,6 +260,128 @@ path:
 			}},
 			OutputImages: []string{"nginx1", "nginx3"},
 		},
+		// By regexp
+		{
+			InputResource: map[string]interface{}{
+				"nested": map[string]interface{}{
+					"key":   "registry.example.com/team-a/app:1.0",
+					"other": "other.example.com/team-a/app:1.0",
+				},
+			},
+			OutputResource: map[string]interface{}{
+				"nested": map[string]interface{}{
+					"key":   "found:registry.example.com/team-a/app:1.0",
+					"other": "other.example.com/team-a/app:1.0",
+				},
+			},
+			SearchRules: []ctlconf.SearchRule{{
+				ValueMatcher: &ctlconf.SearchRuleValueMatcher{
+					Regexp: `registry\.example\.com/team-.+`,
+				},
+			}},
+			OutputImages: []string{"registry.example.com/team-a/app:1.0"},
+		},
+		// By glob
+		{
+			InputResource: map[string]interface{}{
+				"nested": map[string]interface{}{
+					"key":   "registry.example.com/team-a/app:1.0",
+					"other": "registry.example.com/other/app:1.0",
+				},
+			},
+			OutputResource: map[string]interface{}{
+				"nested": map[string]interface{}{
+					"key":   "found:registry.example.com/team-a/app:1.0",
+					"other": "registry.example.com/other/app:1.0",
+				},
+			},
+			SearchRules: []ctlconf.SearchRule{{
+				ValueMatcher: &ctlconf.SearchRuleValueMatcher{
+					Glob: "*.example.com/team-*/*",
+				},
+			}},
+			OutputImages: []string{"registry.example.com/team-a/app:1.0"},
+		},
+		// Regexp capture group extraction
+		{
+			InputResource: map[string]interface{}{
+				"args": []interface{}{
+					"--sidecar-image=gcr.io/repo:something --verbose",
+					"--other",
+				},
+			},
+			OutputResource: map[string]interface{}{
+				"args": []interface{}{
+					"--sidecar-image=found:gcr.io/repo:something --verbose",
+					"--other",
+				},
+			},
+			SearchRules: []ctlconf.SearchRule{{
+				ValueMatcher: &ctlconf.SearchRuleValueMatcher{
+					Regexp: `--sidecar-image=(?P<image>\S+).*`,
+				},
+				UpdateStrategy: &ctlconf.SearchRuleUpdateStrategy{
+					Regexp: &ctlconf.SearchRuleUpdateStrategyRegexp{
+						CaptureGroup: "image",
+					},
+				},
+			}},
+			OutputImages: []string{"gcr.io/repo:something"},
+		},
+		// By JSONPath with filter
+		{
+			InputResource: map[string]interface{}{
+				"spec": map[string]interface{}{
+					"containers": []interface{}{
+						map[string]interface{}{"name": "app", "image": "nginx1"},
+						map[string]interface{}{"name": "sidecar", "image": "nginx2"},
+					},
+				},
+			},
+			OutputResource: map[string]interface{}{
+				"spec": map[string]interface{}{
+					"containers": []interface{}{
+						map[string]interface{}{"name": "app", "image": "nginx1"},
+						map[string]interface{}{"name": "sidecar", "image": "found:nginx2"},
+					},
+				},
+			},
+			SearchRules: []ctlconf.SearchRule{{
+				KeyMatcher: &ctlconf.SearchRuleKeyMatcher{
+					JSONPath: `spec.containers[?(@.name=="sidecar")].image`,
+				},
+			}},
+			OutputImages: []string{"nginx2"},
+		},
+		// By JSONPath with recursive descent
+		{
+			InputResource: map[string]interface{}{
+				"spec": map[string]interface{}{
+					"template": map[string]interface{}{
+						"runImage": "nginx1",
+					},
+					"runImage": []interface{}{"not-matched"},
+				},
+				"runImage": "nginx2",
+				"other":    "nginx3",
+			},
+			OutputResource: map[string]interface{}{
+				"spec": map[string]interface{}{
+					"template": map[string]interface{}{
+						"runImage": "found:nginx1",
+					},
+					"runImage": []interface{}{"not-matched"},
+				},
+				"runImage": "found:nginx2",
+				"other":    "nginx3",
+			},
+			SearchRules: []ctlconf.SearchRule{{
+				KeyMatcher: &ctlconf.SearchRuleKeyMatcher{
+					JSONPath: `$..runImage`,
+				},
+			}},
+			OutputImages: []string{"nginx1", "nginx2"},
+		},
 		// Matching key within another matching key section
 		{
 			InputResource: map[string]interface{}{
@@ -294,10 +416,13 @@ path:
 		refs := ctlser.NewImageRefs(ex.InputResource, ex.SearchRules)
 
 		foundImages := []string{}
-		refs.Visit(func(val string) (string, bool) {
+		err := refs.Visit(func(val string) (string, bool) {
 			foundImages = append(foundImages, val)
 			return "found:" + val, true
 		})
+		if err != nil {
+			t.Fatalf("Expected %#v to succeed: %s", ex, err)
+		}
 
 		sort.Strings(foundImages)
 
@@ -311,3 +436,61 @@ path:
 		}
 	}
 }
+
+func TestImageRefsInvalidNestedRule(t *testing.T) {
+	res := map[string]interface{}{
+		"config": `{"image": "nginx"}`,
+	}
+
+	rules := []ctlconf.SearchRule{{
+		KeyMatcher: &ctlconf.SearchRuleKeyMatcher{Name: "config"},
+		UpdateStrategy: &ctlconf.SearchRuleUpdateStrategy{
+			JSON: &ctlconf.SearchRuleUpdateStrategyJSON{
+				SearchRules: []ctlconf.SearchRule{{
+					ValueMatcher: &ctlconf.SearchRuleValueMatcher{Regexp: "(unclosed"},
+				}},
+			},
+		},
+	}}
+
+	err := ctlser.NewImageRefs(res, rules).Visit(func(val string) (string, bool) {
+		return "found:" + val, true
+	})
+	if err == nil {
+		t.Fatalf("Expected error for invalid nested regexp")
+	}
+
+	expectedErr := "Compiling search rule regexp '(unclosed': error parsing regexp: missing closing ): `\\A(?:(unclosed)\\z`"
+	if err.Error() != expectedErr {
+		t.Fatalf("Expected error '%s' but was '%s'", expectedErr, err)
+	}
+}
+
+func TestImageRefsInvalidNestedJSONPath(t *testing.T) {
+	res := map[string]interface{}{
+		"config": "spec:\n  image: nginx\n",
+	}
+
+	rules := []ctlconf.SearchRule{{
+		KeyMatcher: &ctlconf.SearchRuleKeyMatcher{Name: "config"},
+		UpdateStrategy: &ctlconf.SearchRuleUpdateStrategy{
+			YAML: &ctlconf.SearchRuleUpdateStrategyYAML{
+				SearchRules: []ctlconf.SearchRule{{
+					KeyMatcher: &ctlconf.SearchRuleKeyMatcher{JSONPath: "spec.containers[0"},
+				}},
+			},
+		},
+	}}
+
+	err := ctlser.NewImageRefs(res, rules).Visit(func(val string) (string, bool) {
+		return "found:" + val, true
+	})
+	if err == nil {
+		t.Fatalf("Expected error for invalid nested JSONPath")
+	}
+
+	expectedErr := "Parsing search rule JSONPath: Parsing JSONPath 'spec.containers[0': Expected closing bracket for '[' at position 15"
+	if err.Error() != expectedErr {
+		t.Fatalf("Expected error '%s' but was '%s'", expectedErr, err)
+	}
+}
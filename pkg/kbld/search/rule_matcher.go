@@ -4,7 +4,11 @@
 package search
 
 import (
+	"fmt"
+	"path"
 	"reflect"
+	"regexp"
+	"sync"
 
 	ctlconf "carvel.dev/kbld/pkg/kbld/config"
 	ctlimg "carvel.dev/kbld/pkg/kbld/image"
@@ -17,10 +21,38 @@ type Matcher interface {
 
 type RuleMatcher struct {
 	rule ctlconf.SearchRule
+	// Populated only for JSONPath key matcher
+	jsonPathMatches []ctlres.Path
+	// Populated only for regexp value matcher
+	valueRegexp *regexp.Regexp
 }
 
 var _ Matcher = RuleMatcher{}
 
+func NewRuleMatcher(rule ctlconf.SearchRule, res interface{}) (RuleMatcher, error) {
+	matcher := RuleMatcher{rule: rule}
+
+	if rule.KeyMatcher != nil && len(rule.KeyMatcher.JSONPath) > 0 {
+		jsonPath, err := ctlres.NewJSONPath(rule.KeyMatcher.JSONPath)
+		if err != nil {
+			return RuleMatcher{}, fmt.Errorf("Parsing search rule JSONPath: %s", err)
+		}
+		// Filters may depend on sibling fields, hence evaluate
+		// against entire document before it's being visited
+		matcher.jsonPathMatches = jsonPath.Evaluate(res)
+	}
+
+	if rule.ValueMatcher != nil && len(rule.ValueMatcher.Regexp) > 0 {
+		re, err := compiledRegexps.Get(rule.ValueMatcher.Regexp)
+		if err != nil {
+			return RuleMatcher{}, err
+		}
+		matcher.valueRegexp = re
+	}
+
+	return matcher, nil
+}
+
 func (m RuleMatcher) Matches(keyPath ctlres.Path, value interface{}) (bool, ctlconf.SearchRuleUpdateStrategy) {
 	var keyMatched, valueMatched bool
 
@@ -33,6 +65,14 @@ func (m RuleMatcher) Matches(keyPath ctlres.Path, value interface{}) (bool, ctlc
 		case len(m.rule.KeyMatcher.Path) > 0:
 			keyMatched = m.rule.KeyMatcher.Path.Matches(keyPath)
 
+		case len(m.rule.KeyMatcher.JSONPath) > 0:
+			for _, path := range m.jsonPathMatches {
+				if path.Matches(keyPath) {
+					keyMatched = true
+					break
+				}
+			}
+
 		default:
 			panic("Unknown search rule key matcher")
 		}
@@ -55,6 +95,17 @@ func (m RuleMatcher) Matches(keyPath ctlres.Path, value interface{}) (bool, ctlc
 				}
 			}
 
+		case len(m.rule.ValueMatcher.Regexp) > 0:
+			if valueStr, ok := value.(string); ok {
+				valueMatched = m.valueRegexp.MatchString(valueStr)
+			}
+
+		case len(m.rule.ValueMatcher.Glob) > 0:
+			if valueStr, ok := value.(string); ok {
+				// Pattern is validated when config is loaded
+				valueMatched, _ = path.Match(m.rule.ValueMatcher.Glob, valueStr)
+			}
+
 		default:
 			panic("Unknown search rule value matcher")
 		}
@@ -64,3 +115,28 @@ func (m RuleMatcher) Matches(keyPath ctlres.Path, value interface{}) (bool, ctlc
 
 	return keyMatched && valueMatched, m.rule.UpdateStrategyWithDefaults()
 }
+
+var compiledRegexps = &regexpCache{regexps: map[string]*regexp.Regexp{}}
+
+// regexpCache avoids recompiling same search rule regexps for every visited value
+type regexpCache struct {
+	regexps map[string]*regexp.Regexp
+	lock    sync.Mutex
+}
+
+func (c *regexpCache) Get(str string) (*regexp.Regexp, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if re, found := c.regexps[str]; found {
+		return re, nil
+	}
+
+	re, err := ctlconf.NewAnchoredRegexp(str)
+	if err != nil {
+		return nil, fmt.Errorf("Compiling search rule regexp '%s': %s", str, err)
+	}
+
+	c.regexps[str] = re
+	return re, nil
+}
@@ -9,18 +9,29 @@ import (
 )
 
 type RulesMatcher struct {
-	rules []ctlconf.SearchRule
+	matchers []RuleMatcher
 }
 
-func NewRulesMatcher(rules []ctlconf.SearchRule) RulesMatcher {
-	return RulesMatcher{rules}
+// NewRulesMatcher prepares matchers for given rules;
+// some rules (e.g. JSONPath key matchers) need to inspect
+// the entire document that's about to be visited.
+func NewRulesMatcher(rules []ctlconf.SearchRule, res interface{}) (RulesMatcher, error) {
+	var matchers []RuleMatcher
+	for _, rule := range rules {
+		matcher, err := NewRuleMatcher(rule, res)
+		if err != nil {
+			return RulesMatcher{}, err
+		}
+		matchers = append(matchers, matcher)
+	}
+	return RulesMatcher{matchers}, nil
 }
 
-var _ Matcher = RuleMatcher{}
+var _ Matcher = RulesMatcher{}
 
 func (m RulesMatcher) Matches(keyPath ctlres.Path, value interface{}) (bool, ctlconf.SearchRuleUpdateStrategy) {
-	for _, rule := range m.rules {
-		matches, extraction := (RuleMatcher{rule}).Matches(keyPath, value)
+	for _, matcher := range m.matchers {
+		matches, extraction := matcher.Matches(keyPath, value)
 		if matches {
 			return true, extraction
 		}
@@ -103,3 +103,39 @@ spec:
 		t.Fatalf("Expected >>>%s<<< to match >>>%s<<<", out, expectedOut)
 	}
 }
+
+func TestDockerBuildxMultiPlatformBuildRecordsPlatforms(t *testing.T) {
+	env := BuildEnv(t)
+	kbld := Kbld{t, env.KbldBinaryPath, Logger{}}
+
+	input := env.WithRegistries(`
+kind: Object
+spec:
+- image: docker.io/*username*/kbld-e2e-tests-build
+---
+apiVersion: kbld.k14s.io/v1alpha1
+kind: Sources
+sources:
+- image: docker.io/*username*/kbld-e2e-tests-build
+  path: assets/simple-app
+  docker:
+    buildx:
+      platforms: [linux/amd64, linux/arm64]
+      provenance: false
+---
+apiVersion: kbld.k14s.io/v1alpha1
+kind: ImageDestinations
+destinations:
+- image: docker.io/*username*/kbld-e2e-tests-build
+`)
+
+	out, _ := kbld.RunWithOpts([]string{"-f", "-"}, RunOpts{
+		StdinReader: strings.NewReader(input),
+	})
+
+	for _, expected := range []string{"builtPlatform:", "architecture: amd64", "architecture: arm64"} {
+		if !strings.Contains(out, expected) {
+			t.Fatalf("Expected >>>%s<<< to include '%s'", out, expected)
+		}
+	}
+}
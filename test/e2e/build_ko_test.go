@@ -6,6 +6,7 @@
 package e2e
 
 import (
+	"bytes"
 	"regexp"
 	"strings"
 	"testing"
@@ -57,3 +58,52 @@ spec:
 		t.Fatalf("Expected >>>%s<<< to match >>>%s<<<", out, expectedOut)
 	}
 }
+
+func TestKoBuildAndPushDaemonlessSuccessful(t *testing.T) {
+	env := BuildEnv(t)
+	kbld := Kbld{t, env.KbldBinaryPath, Logger{}}
+
+	input := env.WithRegistries(`
+kind: Object
+spec:
+- image: docker.io/*username*/kbld-e2e-tests-build
+---
+apiVersion: kbld.k14s.io/v1alpha1
+kind: Sources
+sources:
+- image: docker.io/*username*/kbld-e2e-tests-build
+  path: assets/simple-app
+  ko:
+    build:
+---
+apiVersion: kbld.k14s.io/v1alpha1
+kind: ImageDestinations
+destinations:
+- image: docker.io/*username*/kbld-e2e-tests-build
+`)
+
+	var stderr bytes.Buffer
+
+	out, _ := kbld.RunWithOpts([]string{"-f", "-", "--images-annotation=false", "--push-daemonless", "--log-format=json"}, RunOpts{
+		StdinReader:  strings.NewReader(input),
+		StderrWriter: &stderr,
+	})
+
+	out = strings.Replace(out, regexp.MustCompile("sha256:[a-z0-9]{64}").FindString(out), "SHA256-REPLACED", -1)
+
+	expectedOut := env.WithRegistries(`---
+kind: Object
+spec:
+- image: index.docker.io/*username*/kbld-e2e-tests-build@SHA256-REPLACED
+`)
+
+	if out != expectedOut {
+		t.Fatalf("Expected >>>%s<<< to match >>>%s<<<", out, expectedOut)
+	}
+
+	// Image is pushed from ko produced tarball without going through Docker daemon
+	pushBuilders := pushEventBuilders(stderr.String())
+	if len(pushBuilders) != 1 || pushBuilders[0] != "ko" {
+		t.Fatalf("Expected single push from ko tarball, but was: %v", pushBuilders)
+	}
+}
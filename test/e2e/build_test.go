@@ -6,6 +6,8 @@
 package e2e
 
 import (
+	"bytes"
+	"encoding/json"
 	"regexp"
 	"strings"
 	"testing"
@@ -71,6 +73,54 @@ spec:
 	}
 }
 
+func TestDockerBuildOnceForIdenticalSources(t *testing.T) {
+	env := BuildEnv(t)
+	kbld := Kbld{t, env.KbldBinaryPath, Logger{}}
+
+	input := `
+kind: Object
+spec:
+- image: simple-app-one
+- image: simple-app-two
+- image: simple-app-three
+---
+apiVersion: kbld.k14s.io/v1alpha1
+kind: Sources
+sources:
+- image: simple-app-one
+  path: assets/simple-app
+- image: simple-app-two
+  path: assets/simple-app
+- image: simple-app-three
+  path: assets/simple-app
+  docker:
+    build:
+      target: build-env
+`
+
+	var stderr bytes.Buffer
+
+	out, _ := kbld.RunWithOpts([]string{"-f", "-", "--images-annotation=false"}, RunOpts{
+		StdinReader:  strings.NewReader(input),
+		StderrWriter: &stderr,
+	})
+
+	if count := strings.Count(stderr.String(), "starting build (using Docker)"); count != 2 {
+		t.Fatalf("Expected exactly two builds, but found %d in >>>%s<<<", count, stderr.String())
+	}
+
+	images := regexp.MustCompile("image: (.+)").FindAllStringSubmatch(out, -1)
+	if len(images) != 3 {
+		t.Fatalf("Expected to find three images in >>>%s<<<", out)
+	}
+	if images[0][1] != images[1][1] {
+		t.Fatalf("Expected identical sources to resolve to same image, but were '%s' and '%s'", images[0][1], images[1][1])
+	}
+	if images[0][1] == images[2][1] {
+		t.Fatalf("Expected different build options to resolve to different image")
+	}
+}
+
 func TestDockerBuildAndPushSuccessful(t *testing.T) {
 	env := BuildEnv(t)
 	kbld := Kbld{t, env.KbldBinaryPath, Logger{}}
@@ -163,3 +213,126 @@ spec:
 		t.Fatalf("Expected >>>%s<<< to match >>>%s<<<", out, expectedOut)
 	}
 }
+
+func TestDockerBuildSkippedForUnchangedSources(t *testing.T) {
+	env := BuildEnv(t)
+	kbld := Kbld{t, env.KbldBinaryPath, Logger{}}
+
+	input := env.WithRegistries(`
+kind: Object
+spec:
+- image: docker.io/*username*/kbld-e2e-tests-build
+---
+apiVersion: kbld.k14s.io/v1alpha1
+kind: Sources
+sources:
+- image: docker.io/*username*/kbld-e2e-tests-build
+  path: assets/simple-app
+---
+apiVersion: kbld.k14s.io/v1alpha1
+kind: ImageDestinations
+destinations:
+- image: docker.io/*username*/kbld-e2e-tests-build
+`)
+
+	// First run either builds or reuses image from previous test runs;
+	// either way fingerprint tag is present after it completes
+	firstOut, _ := kbld.RunWithOpts([]string{"-f", "-", "--skip-unchanged-builds"}, RunOpts{
+		StdinReader: strings.NewReader(input),
+	})
+
+	var stderr bytes.Buffer
+
+	secondOut, _ := kbld.RunWithOpts([]string{"-f", "-", "--skip-unchanged-builds"}, RunOpts{
+		StdinReader:  strings.NewReader(input),
+		StderrWriter: &stderr,
+	})
+
+	if strings.Contains(stderr.String(), "starting build") {
+		t.Fatalf("Expected build to be skipped, but found >>>%s<<<", stderr.String())
+	}
+	if !strings.Contains(secondOut, "cached:\n") || !strings.Contains(secondOut, "fingerprint: ") {
+		t.Fatalf("Expected cached origin in >>>%s<<<", secondOut)
+	}
+
+	digestRegexp := regexp.MustCompile("sha256:[a-z0-9]{64}")
+	if digestRegexp.FindString(firstOut) != digestRegexp.FindString(secondOut) {
+		t.Fatalf("Expected same image to be reused, but found >>>%s<<< and >>>%s<<<", firstOut, secondOut)
+	}
+}
+
+// Docker builder always pushes via 'docker push' so that
+// pushed layers (and image digests) match ones produced by Docker
+func TestDockerBuildAndPushIgnoresPushDaemonless(t *testing.T) {
+	env := BuildEnv(t)
+	kbld := Kbld{t, env.KbldBinaryPath, Logger{}}
+
+	input := env.WithRegistries(`
+kind: Object
+spec:
+- image: docker.io/*username*/kbld-e2e-tests-build
+---
+apiVersion: kbld.k14s.io/v1alpha1
+kind: Sources
+sources:
+- image: docker.io/*username*/kbld-e2e-tests-build
+  path: assets/simple-app
+---
+apiVersion: kbld.k14s.io/v1alpha1
+kind: ImageDestinations
+destinations:
+- image: docker.io/*username*/kbld-e2e-tests-build
+`)
+
+	var stderr bytes.Buffer
+
+	out, _ := kbld.RunWithOpts([]string{"-f", "-", "--images-annotation=false", "--push-daemonless", "--log-format=json"}, RunOpts{
+		StdinReader:  strings.NewReader(input),
+		StderrWriter: &stderr,
+	})
+
+	out = strings.Replace(out, regexp.MustCompile("sha256:[a-z0-9]{64}").FindString(out), "SHA256-REPLACED", -1)
+
+	expectedOut := env.WithRegistries(`---
+kind: Object
+spec:
+- image: index.docker.io/*username*/kbld-e2e-tests-build@SHA256-REPLACED
+`)
+
+	if out != expectedOut {
+		t.Fatalf("Expected >>>%s<<< to match >>>%s<<<", out, expectedOut)
+	}
+
+	pushBuilders := pushEventBuilders(stderr.String())
+	if len(pushBuilders) != 1 || pushBuilders[0] != "docker" {
+		t.Fatalf("Expected single push via docker, but was: %v", pushBuilders)
+	}
+}
+
+// pushEventBuilders returns builders used for pushing images based on JSON log events
+func pushEventBuilders(stderr string) []string {
+	var builders []string
+
+	for _, line := range strings.Split(stderr, "\n") {
+		if len(strings.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		var event struct {
+			Type    string `json:"type"`
+			Builder string `json:"builder"`
+		}
+
+		// Skip output that is not produced by kbld's logger
+		err := json.Unmarshal([]byte(line), &event)
+		if err != nil {
+			continue
+		}
+
+		if event.Type == "push-start" {
+			builders = append(builders, event.Builder)
+		}
+	}
+
+	return builders
+}
@@ -0,0 +1,114 @@
+//go:build e2e
+
+// Copyright 2024 The Carvel Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package e2e
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLockDiff(t *testing.T) {
+	env := BuildEnv(t)
+	kbld := Kbld{t, env.KbldBinaryPath, Logger{}}
+
+	oldLock := `
+apiVersion: imgpkg.carvel.dev/v1alpha1
+kind: ImagesLock
+images:
+- image: index.docker.io/library/nginx@sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa
+  annotations:
+    kbld.carvel.dev/id: nginx:1.14
+- image: gcr.io/foo/app@sha256:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb
+  annotations:
+    kbld.carvel.dev/id: app
+- image: gcr.io/foo/gone@sha256:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb
+  annotations:
+    kbld.carvel.dev/id: gone
+`
+
+	newLock := `
+apiVersion: imgpkg.carvel.dev/v1alpha1
+kind: ImagesLock
+images:
+- image: index.docker.io/library/nginx@sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa
+  annotations:
+    kbld.carvel.dev/id: nginx:1.14
+- image: gcr.io/foo/app@sha256:cccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccc
+  annotations:
+    kbld.carvel.dev/id: app
+    kbld.carvel.dev/origins: |
+      - git:
+          sha: abc123
+          dirty: true
+          remoteURL: x
+- image: gcr.io/foo/new@sha256:cccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccc
+  annotations:
+    kbld.carvel.dev/id: new
+`
+
+	dir := t.TempDir()
+	oldPath := filepath.Join(dir, "old.yml")
+	newPath := filepath.Join(dir, "new.yml")
+
+	require.NoError(t, os.WriteFile(oldPath, []byte(oldLock), 0600))
+	require.NoError(t, os.WriteFile(newPath, []byte(newLock), 0600))
+
+	type diffResp struct {
+		Tables []struct {
+			Rows []map[string]string
+		}
+	}
+
+	t.Run("shows added, removed and repinned images", func(t *testing.T) {
+		out, _ := kbld.RunWithOpts([]string{"lock", "diff", oldPath, newPath, "--json"}, RunOpts{})
+
+		var resp diffResp
+		require.NoError(t, json.Unmarshal([]byte(out), &resp))
+		require.Len(t, resp.Tables, 1)
+
+		expectedRows := []map[string]string{
+			{
+				"image":   "app",
+				"change":  "repinned",
+				"old":     "gcr.io/foo/app@sha256:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb",
+				"new":     "gcr.io/foo/app@sha256:cccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccc",
+				"origins": "git: abc123 (dirty)",
+			},
+			{
+				"image":   "gone",
+				"change":  "removed",
+				"old":     "gcr.io/foo/gone@sha256:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb",
+				"new":     "",
+				"origins": "",
+			},
+			{
+				"image":   "new",
+				"change":  "added",
+				"old":     "",
+				"new":     "gcr.io/foo/new@sha256:cccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccc",
+				"origins": "",
+			},
+		}
+		require.Equal(t, expectedRows, resp.Tables[0].Rows)
+	})
+
+	t.Run("fails when changes are outside allowed repositories", func(t *testing.T) {
+		var stderr strings.Builder
+
+		_, err := kbld.RunWithOpts([]string{"lock", "diff", oldPath, newPath, "--allowed-repo", "gcr.io/foo/app"}, RunOpts{
+			AllowError:   true,
+			StderrWriter: &stderr,
+		})
+		require.Error(t, err)
+		require.Contains(t, stderr.String(),
+			"Expected lock changes only within allowed repositories, but found changes in: gone, new")
+	})
+}
@@ -0,0 +1,96 @@
+//go:build e2e
+
+// Copyright 2024 The Carvel Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package e2e
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolvePlanDoesNotBuildOrResolve(t *testing.T) {
+	env := BuildEnv(t)
+	kbld := Kbld{t, env.KbldBinaryPath, Logger{}}
+
+	input := `
+kind: Object
+spec:
+- image: docker.io/library/nginx:1.14.2
+- image: unknown
+- image: kbld-e2e-tests-build
+- image: nginx@sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa
+---
+apiVersion: kbld.k14s.io/v1alpha1
+kind: Config
+sources:
+- image: kbld-e2e-tests-build
+  path: does-not-exist
+destinations:
+- image: kbld-e2e-tests-build
+  newImage: docker.io/unknown/kbld-e2e-tests-build
+  tags: [latest]
+overrides:
+- image: unknown
+  newImage: docker.io/library/nginx:1.14.2
+  preresolved: true
+`
+
+	out, _ := kbld.RunWithOpts([]string{"-f", "-", "--plan", "--json"}, RunOpts{
+		StdinReader: strings.NewReader(input),
+	})
+
+	var resp struct {
+		Tables []struct {
+			Rows []map[string]string
+		}
+	}
+
+	require.NoError(t, json.Unmarshal([]byte(out), &resp))
+	require.Len(t, resp.Tables, 1)
+
+	expectedRows := []map[string]string{
+		{
+			"image":        "docker.io/library/nginx:1.14.2",
+			"action":       "resolve",
+			"override":     "",
+			"source":       "",
+			"destination":  "",
+			"search_rules": `{"keyMatcher":{"name":"image"}}`,
+			"resources":    "object/ () cluster",
+		},
+		{
+			"image":        "kbld-e2e-tests-build",
+			"action":       "build",
+			"override":     "",
+			"source":       "does-not-exist (docker)",
+			"destination":  "docker.io/unknown/kbld-e2e-tests-build (tags: latest)",
+			"search_rules": `{"keyMatcher":{"name":"image"}}`,
+			"resources":    "object/ () cluster",
+		},
+		{
+			"image":        "nginx@sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa",
+			"action":       "digested",
+			"override":     "",
+			"source":       "",
+			"destination":  "",
+			"search_rules": `{"keyMatcher":{"name":"image"}}`,
+			"resources":    "object/ () cluster",
+		},
+		{
+			"image":        "unknown",
+			"action":       "preresolved",
+			"override":     "docker.io/library/nginx:1.14.2 (preresolved)",
+			"source":       "",
+			"destination":  "",
+			"search_rules": `{"keyMatcher":{"name":"image"}}`,
+			"resources":    "object/ () cluster",
+		},
+	}
+
+	require.Equal(t, expectedRows, resp.Tables[0].Rows)
+}